@@ -0,0 +1,49 @@
+package broker
+
+import (
+	"context"
+	"errors"
+)
+
+type contextKey string
+
+const manualAckKey contextKey = "manual-ack"
+
+// ErrRequeueNotSupported is returned by Acknowledger.Nack when message is rejected with requeue, but message broker
+// cannot redeliver single message (e.g. Kafka). Message can be rejected without requeue then.
+var ErrRequeueNotSupported = errors.New("Message broker does not support requeue of rejected message")
+
+// Acknowledger represents mechanism which acknowledges processing of the message to message broker.
+type Acknowledger interface {
+	Ack() error              // confirms that message was processed
+	Nack(requeue bool) error // rejects message, optionally requeuing it for redelivery
+}
+
+// ManualAck returns context which turns on manual acknowledgement when passed to MessageBroker.Subscribe.
+// Each received message must then be confirmed with Message.Ack or rejected with Message.Nack.
+func ManualAck(ctx context.Context) context.Context {
+	return context.WithValue(ctx, manualAckKey, true)
+}
+
+// IsManualAck indicates if manual acknowledgement is turned on in context.
+func IsManualAck(ctx context.Context) bool {
+	manual, _ := ctx.Value(manualAckKey).(bool)
+	return manual
+}
+
+// Ack confirms that message was processed. It does nothing if message was received with automatic acknowledgement.
+func (m Message) Ack() error {
+	if m.Acknowledger == nil {
+		return nil
+	}
+	return m.Acknowledger.Ack()
+}
+
+// Nack rejects message. If requeue is true message is redelivered by message broker.
+// It does nothing if message was received with automatic acknowledgement.
+func (m Message) Nack(requeue bool) error {
+	if m.Acknowledger == nil {
+		return nil
+	}
+	return m.Acknowledger.Nack(requeue)
+}
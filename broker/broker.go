@@ -2,6 +2,8 @@ package broker
 
 import (
 	"context"
+	"strings"
+	"unicode"
 
 	"github.com/gkarlik/quark-go/system"
 )
@@ -11,9 +13,10 @@ type MessageContext map[string]interface{}
 
 // Message represents structure which will be passed to message broker.
 type Message struct {
-	Topic   string         // message topic
-	Value   interface{}    // message value - typically JSON payload
-	Context MessageContext // message context
+	Topic        string         // message topic
+	Value        interface{}    // message value - encoded with codec selected by content type in message context, received value is []byte
+	Context      MessageContext // message context
+	Acknowledger Acknowledger   // message acknowledgement handle - set only if subscription uses manual acknowledgement
 }
 
 // MessageBroker represents pub/sub mechanism.
@@ -23,3 +26,33 @@ type MessageBroker interface {
 
 	system.Disposer
 }
+
+// BatchPublisher represents message broker which publishes batch of messages at once (e.g. Kafka).
+type BatchPublisher interface {
+	PublishMessages(ctx context.Context, messages []Message) error
+}
+
+// PublishMessages publishes batch of messages using message broker. If message broker does not implement BatchPublisher,
+// messages are published one by one and the first error is returned.
+func PublishMessages(ctx context.Context, b MessageBroker, messages []Message) error {
+	if bp, ok := b.(BatchPublisher); ok {
+		return bp.PublishMessages(ctx, messages)
+	}
+
+	for _, m := range messages {
+		if err := b.PublishMessage(ctx, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MetricName creates metric name for the topic (topic characters not allowed in metric names are replaced with underscores).
+func MetricName(name, topic string) string {
+	return name + "_" + strings.Map(func(r rune) rune {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return r
+		}
+		return '_'
+	}, topic)
+}
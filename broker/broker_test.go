@@ -0,0 +1,77 @@
+package broker_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/gkarlik/quark-go/broker"
+	"github.com/stretchr/testify/assert"
+)
+
+type TestAcknowledger struct {
+	acked   bool
+	nacked  bool
+	requeue bool
+}
+
+func (a *TestAcknowledger) Ack() error {
+	a.acked = true
+	return nil
+}
+
+func (a *TestAcknowledger) Nack(requeue bool) error {
+	a.nacked = true
+	a.requeue = requeue
+	return nil
+}
+
+func TestManualAck(t *testing.T) {
+	ctx := context.Background()
+	assert.False(t, broker.IsManualAck(ctx))
+
+	ctx = broker.ManualAck(ctx)
+	assert.True(t, broker.IsManualAck(ctx))
+}
+
+func TestTemporary(t *testing.T) {
+	ctx := context.Background()
+	assert.False(t, broker.IsTemporary(ctx))
+
+	ctx = broker.Temporary(ctx)
+	assert.True(t, broker.IsTemporary(ctx))
+}
+
+func TestMessageAck(t *testing.T) {
+	m := broker.Message{}
+	assert.NoError(t, m.Ack(), "Ack returned an error")
+	assert.NoError(t, m.Nack(true), "Nack returned an error")
+
+	a := &TestAcknowledger{}
+	m.Acknowledger = a
+
+	m.Ack()
+	assert.True(t, a.acked)
+
+	m.Nack(true)
+	assert.True(t, a.nacked)
+	assert.True(t, a.requeue)
+}
+
+func TestErrorHandler(t *testing.T) {
+	// does nothing if error handler is not set
+	broker.HandleError(context.Background(), errors.New("test error"))
+
+	var handled error
+	ctx := broker.WithErrorHandler(context.Background(), func(err error) {
+		handled = err
+	})
+
+	err := errors.New("test error")
+	broker.HandleError(ctx, err)
+	assert.Equal(t, err, handled)
+}
+
+func TestMetricName(t *testing.T) {
+	assert.Equal(t, "messages_consumed_orders_created_v1", broker.MetricName("messages_consumed", "orders.created-v1"))
+}
@@ -0,0 +1,206 @@
+package broker
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+)
+
+const (
+	// ContentTypeKey defines message context key of content type which message value is encoded with.
+	ContentTypeKey = "content-type"
+
+	// ContentTypeJSON defines content type of JSON encoded message value.
+	ContentTypeJSON = "application/json"
+	// ContentTypeProtobuf defines content type of protocol buffers encoded message value.
+	ContentTypeProtobuf = "application/x-protobuf"
+	// ContentTypeRaw defines content type of message value which is passed as raw bytes.
+	ContentTypeRaw = "application/octet-stream"
+
+	codecComponentName = "MessageCodec"
+)
+
+// Codec represents mechanism which encodes and decodes message values.
+type Codec interface {
+	ContentType() string                        // content type of encoded value
+	Marshal(v interface{}) ([]byte, error)      // encodes value
+	Unmarshal(data []byte, v interface{}) error // decodes data into value
+}
+
+// Encoded represents message value which is already encoded with codec selected by message content type.
+// Encoded value is published as is (e.g. when received message is republished).
+type Encoded []byte
+
+// JSONCodec represents codec which encodes message values as JSON.
+type JSONCodec struct{}
+
+// ContentType returns JSON content type.
+func (JSONCodec) ContentType() string {
+	return ContentTypeJSON
+}
+
+// Marshal encodes value as JSON.
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal decodes JSON data into value.
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// ProtobufCodec represents codec which encodes message values using protocol buffers. Values must implement proto.Message.
+type ProtobufCodec struct{}
+
+// ContentType returns protocol buffers content type.
+func (ProtobufCodec) ContentType() string {
+	return ContentTypeProtobuf
+}
+
+// Marshal encodes protocol buffers message.
+func (ProtobufCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("[%s]: Cannot encode value of type %T - value must be proto.Message", codecComponentName, v)
+	}
+	return proto.Marshal(m)
+}
+
+// Unmarshal decodes data into protocol buffers message.
+func (ProtobufCodec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("[%s]: Cannot decode value of type %T - value must be proto.Message", codecComponentName, v)
+	}
+	return proto.Unmarshal(data, m)
+}
+
+// RawCodec represents codec which passes message values as raw bytes. Values must be []byte or string.
+type RawCodec struct{}
+
+// ContentType returns raw bytes content type.
+func (RawCodec) ContentType() string {
+	return ContentTypeRaw
+}
+
+// Marshal returns value as raw bytes.
+func (RawCodec) Marshal(v interface{}) ([]byte, error) {
+	switch raw := v.(type) {
+	case []byte:
+		return raw, nil
+	case string:
+		return []byte(raw), nil
+	}
+	return nil, fmt.Errorf("[%s]: Cannot encode value of type %T - value must be []byte or string", codecComponentName, v)
+}
+
+// Unmarshal copies data into value.
+func (RawCodec) Unmarshal(data []byte, v interface{}) error {
+	switch raw := v.(type) {
+	case *[]byte:
+		*raw = append([]byte(nil), data...)
+		return nil
+	case *string:
+		*raw = string(data)
+		return nil
+	}
+	return fmt.Errorf("[%s]: Cannot decode value of type %T - value must be *[]byte or *string", codecComponentName, v)
+}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[string]Codec{
+		ContentTypeJSON:     JSONCodec{},
+		ContentTypeProtobuf: ProtobufCodec{},
+		ContentTypeRaw:      RawCodec{},
+	}
+)
+
+// RegisterCodec registers codec for its content type. Registered codec replaces previous codec with the same content type.
+func RegisterCodec(c Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+
+	codecs[mediaType(c.ContentType())] = c
+}
+
+// CodecFor returns codec registered for content type. JSON codec is returned if content type is empty.
+func CodecFor(contentType string) (Codec, error) {
+	if contentType == "" {
+		return JSONCodec{}, nil
+	}
+
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+
+	c, ok := codecs[mediaType(contentType)]
+	if !ok {
+		return nil, fmt.Errorf("[%s]: Codec for content type %q is not registered", codecComponentName, contentType)
+	}
+	return c, nil
+}
+
+// mediaType returns content type without parameters (e.g. charset).
+func mediaType(contentType string) string {
+	if i := strings.Index(contentType, ";"); i >= 0 {
+		contentType = contentType[:i]
+	}
+	return strings.ToLower(strings.TrimSpace(contentType))
+}
+
+// ContentType returns content type stored in message context. It returns JSON content type if message context
+// does not contain content type.
+func ContentType(m Message) string {
+	if ct, ok := m.Context[ContentTypeKey].(string); ok && ct != "" {
+		return ct
+	}
+	return ContentTypeJSON
+}
+
+// Encode encodes message value using codec selected by content type stored in message context (JSON by default).
+// It returns encoded value and its content type which should be passed by message broker with the message.
+func Encode(m Message) ([]byte, string, error) {
+	contentType := ContentType(m)
+
+	if v, ok := m.Value.(Encoded); ok {
+		return v, contentType, nil
+	}
+
+	c, err := CodecFor(contentType)
+	if err != nil {
+		return nil, contentType, err
+	}
+
+	data, err := c.Marshal(m.Value)
+	return data, contentType, err
+}
+
+// Decode decodes message value into v using codec selected by content type stored in message context (JSON by default).
+// Received message values are decoded in the same way regardless of message broker. Value which was not encoded yet
+// is encoded first, so Decode can be used with messages which were not passed through message broker.
+func Decode(m Message, v interface{}) error {
+	var data []byte
+
+	switch raw := m.Value.(type) {
+	case Encoded:
+		data = raw
+	case []byte:
+		data = raw
+	case json.RawMessage:
+		data = raw
+	default:
+		var err error
+		if data, _, err = Encode(m); err != nil {
+			return err
+		}
+	}
+
+	c, err := CodecFor(ContentType(m))
+	if err != nil {
+		return err
+	}
+	return c.Unmarshal(data, v)
+}
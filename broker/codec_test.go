@@ -0,0 +1,108 @@
+package broker_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/gkarlik/quark-go/broker"
+	"github.com/gkarlik/quark-go/broker/memory"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"github.com/stretchr/testify/assert"
+)
+
+type UpperCodec struct{}
+
+func (UpperCodec) ContentType() string {
+	return "text/upper"
+}
+
+func (UpperCodec) Marshal(v interface{}) ([]byte, error) {
+	return []byte(strings.ToUpper(v.(string))), nil
+}
+
+func (UpperCodec) Unmarshal(data []byte, v interface{}) error {
+	*v.(*string) = string(data)
+	return nil
+}
+
+func TestCodecs(t *testing.T) {
+	c, err := broker.CodecFor("")
+	assert.NoError(t, err, "CodecFor returned an error")
+	assert.Equal(t, broker.ContentTypeJSON, c.ContentType())
+
+	c, err = broker.CodecFor("application/json; charset=utf-8")
+	assert.NoError(t, err, "CodecFor returned an error")
+	assert.Equal(t, broker.ContentTypeJSON, c.ContentType())
+
+	_, err = broker.CodecFor("application/unknown")
+	assert.Error(t, err, "CodecFor should return an error")
+
+	_, err = broker.ProtobufCodec{}.Marshal("Test")
+	assert.Error(t, err, "Marshal should return an error")
+
+	_, err = broker.RawCodec{}.Marshal(1)
+	assert.Error(t, err, "Marshal should return an error")
+
+	broker.RegisterCodec(UpperCodec{})
+
+	data, contentType, err := broker.Encode(broker.Message{Value: "test", Context: broker.MessageContext{broker.ContentTypeKey: "text/upper"}})
+	assert.NoError(t, err, "Encode returned an error")
+	assert.Equal(t, "text/upper", contentType)
+	assert.Equal(t, []byte("TEST"), data)
+}
+
+func TestEncodeDecode(t *testing.T) {
+	// value which was not passed through message broker is encoded before it is decoded
+	var payload TestPayload
+	err := broker.Decode(broker.Message{Value: &TestPayload{Text: "Test"}}, &payload)
+	assert.NoError(t, err, "Decode returned an error")
+	assert.Equal(t, "Test", payload.Text)
+
+	data, contentType, err := broker.Encode(broker.Message{Value: broker.Encoded("{}")})
+	assert.NoError(t, err, "Encode returned an error")
+	assert.Equal(t, broker.ContentTypeJSON, contentType)
+	assert.Equal(t, []byte("{}"), data)
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	topic := "TestTopic"
+
+	b := memory.NewMessageBroker()
+	defer b.Dispose()
+
+	messages, err := b.Subscribe(context.Background(), topic)
+	assert.NoError(t, err, "Subscribe returned an error")
+
+	publish := func(contentType string, value interface{}) broker.Message {
+		err := b.PublishMessage(context.Background(), broker.Message{
+			Topic:   topic,
+			Value:   value,
+			Context: broker.MessageContext{broker.ContentTypeKey: contentType},
+		})
+		assert.NoError(t, err, "Publish returned an error")
+
+		return <-messages
+	}
+
+	m := publish(broker.ContentTypeJSON, &TestPayload{Text: "Test"})
+	assert.Equal(t, broker.ContentTypeJSON, m.Context[broker.ContentTypeKey])
+
+	var payload TestPayload
+	assert.NoError(t, broker.Decode(m, &payload), "Decode returned an error")
+	assert.Equal(t, "Test", payload.Text)
+
+	m = publish(broker.ContentTypeProtobuf, &wrappers.StringValue{Value: "Test"})
+	assert.Equal(t, broker.ContentTypeProtobuf, m.Context[broker.ContentTypeKey])
+
+	var pb wrappers.StringValue
+	assert.NoError(t, broker.Decode(m, &pb), "Decode returned an error")
+	assert.Equal(t, "Test", pb.Value)
+
+	m = publish(broker.ContentTypeRaw, "Test")
+	assert.Equal(t, broker.ContentTypeRaw, m.Context[broker.ContentTypeKey])
+
+	var raw string
+	assert.NoError(t, broker.Decode(m, &raw), "Decode returned an error")
+	assert.Equal(t, "Test", raw)
+}
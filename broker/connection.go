@@ -0,0 +1,141 @@
+package broker
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/gkarlik/quark-go/logger"
+	"github.com/gkarlik/quark-go/metrics"
+)
+
+// ConnectionState represents state of message broker connection.
+type ConnectionState int
+
+const (
+	// Disconnected represents state of lost connection - message broker is reconnecting.
+	Disconnected ConnectionState = iota
+	// Connected represents state of established connection.
+	Connected
+)
+
+// String returns name of the state.
+func (s ConnectionState) String() string {
+	switch s {
+	case Disconnected:
+		return "disconnected"
+	case Connected:
+		return "connected"
+	}
+	return fmt.Sprintf("unknown state: %d", s)
+}
+
+// ConnectionReporter represents message broker which tracks state of its connection (e.g. RabbitMQ and Kafka).
+type ConnectionReporter interface {
+	State() ConnectionState          // returns current connection state
+	ExposeMetrics(m metrics.Exposer) // exposes connection state and number of reconnections using metrics exposer
+}
+
+// State returns connection state of message broker. Message broker which does not implement ConnectionReporter
+// (e.g. in-memory broker) is always connected.
+func State(b MessageBroker) ConnectionState {
+	if cr, ok := b.(ConnectionReporter); ok {
+		return cr.State()
+	}
+	return Connected
+}
+
+// ExposeConnectionMetrics exposes connection metrics of message broker if it implements ConnectionReporter.
+func ExposeConnectionMetrics(b MessageBroker, m metrics.Exposer) {
+	if cr, ok := b.(ConnectionReporter); ok {
+		cr.ExposeMetrics(m)
+	}
+}
+
+const (
+	connectionStateMetricName = "_connection_state"
+	connectionStateMetricDesc = "State of message broker connection (1 - connected, 0 - disconnected)"
+	reconnectsMetricName      = "_reconnects"
+	reconnectsMetricDesc      = "Number of message broker reconnections"
+)
+
+// ConnectionMonitor tracks state of message broker connection. State changes are logged and exposed as metrics
+// (connection state gauge and reconnections counter) if metrics exposer is set. It is used by MessageBroker implementations.
+type ConnectionMonitor struct {
+	component string // name of message broker component
+
+	mu         sync.Mutex
+	state      ConnectionState
+	gauge      metrics.Gauge
+	reconnects metrics.Counter
+}
+
+// NewConnectionMonitor creates connection monitor of message broker component in connected state.
+func NewConnectionMonitor(component string) *ConnectionMonitor {
+	return &ConnectionMonitor{
+		component: component,
+		state:     Connected,
+	}
+}
+
+// ExposeMetrics creates connection metrics with name prefix (e.g. "rabbitmq") using metrics exposer.
+func (c *ConnectionMonitor) ExposeMetrics(m metrics.Exposer, prefix string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gauge = m.CreateGauge(prefix+connectionStateMetricName, connectionStateMetricDesc)
+	c.reconnects = m.CreateCounter(prefix+reconnectsMetricName, reconnectsMetricDesc)
+
+	c.gauge.Set(float64(c.state))
+}
+
+// State returns current connection state.
+func (c *ConnectionMonitor) State() ConnectionState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.state
+}
+
+// Disconnected records that connection was lost because of an error.
+func (c *ConnectionMonitor) Disconnected(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.state == Disconnected {
+		return
+	}
+	c.state = Disconnected
+
+	logger.Log().ErrorWithFields(logger.Fields{
+		"error":     err,
+		"state":     c.state.String(),
+		"component": c.component,
+	}, "Connection to message broker lost - reconnecting")
+
+	if c.gauge != nil {
+		c.gauge.Set(float64(c.state))
+	}
+}
+
+// Connected records that connection was established again.
+func (c *ConnectionMonitor) Connected() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.state == Connected {
+		return
+	}
+	c.state = Connected
+
+	logger.Log().InfoWithFields(logger.Fields{
+		"state":     c.state.String(),
+		"component": c.component,
+	}, "Reconnected to message broker")
+
+	if c.gauge != nil {
+		c.gauge.Set(float64(c.state))
+	}
+	if c.reconnects != nil {
+		c.reconnects.Inc()
+	}
+}
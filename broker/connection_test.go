@@ -0,0 +1,28 @@
+package broker_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gkarlik/quark-go/broker"
+	"github.com/gkarlik/quark-go/metrics/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnectionMonitor(t *testing.T) {
+	m := prometheus.NewMetricsExposer()
+	defer m.Dispose()
+
+	c := broker.NewConnectionMonitor("TestBroker")
+	c.ExposeMetrics(m, "test")
+
+	assert.Equal(t, broker.Connected, c.State())
+
+	c.Disconnected(errors.New("test error"))
+	assert.Equal(t, broker.Disconnected, c.State())
+	assert.Equal(t, "disconnected", c.State().String())
+
+	c.Connected()
+	assert.Equal(t, broker.Connected, c.State())
+	assert.Equal(t, "connected", c.State().String())
+}
@@ -0,0 +1,422 @@
+package broker
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gkarlik/quark-go/logger"
+)
+
+const (
+	// DeadLetterIDKey defines message context key of dead-lettered message identifier.
+	DeadLetterIDKey = "dead-letter-id"
+	// OriginalTopicKey defines message context key of topic which dead-lettered message was received from.
+	OriginalTopicKey = "original-topic"
+	// ErrorKey defines message context key of last error returned by handler of dead-lettered message.
+	ErrorKey = "error"
+	// AttemptsKey defines message context key of number of delivery attempts of the message.
+	AttemptsKey = "attempts"
+
+	deadLetterComponentName = "DeadLetterQueue"
+	deadLetterSuffix        = ".dlq"
+	defaultMaxAttempts      = 3
+	defaultRetryDelay       = 1 * time.Second
+)
+
+// Handler represents function which processes received message. Returned error means that message was not processed.
+type Handler func(ctx context.Context, m Message) error
+
+// DeadLetterOption represents function which is used to apply dead-letter policy options.
+type DeadLetterOption func(*DeadLetterOptions)
+
+// DeadLetterOptions represents dead-letter policy options.
+type DeadLetterOptions struct {
+	MaxAttempts int           // maximum number of delivery attempts before message is dead-lettered
+	RetryDelay  time.Duration // delay between delivery attempts
+	Topic       string        // dead-letter topic
+}
+
+// MaxAttempts allows to set maximum number of delivery attempts before message is dead-lettered. Default is 3 attempts.
+func MaxAttempts(n int) DeadLetterOption {
+	return func(o *DeadLetterOptions) {
+		o.MaxAttempts = n
+	}
+}
+
+// RetryDelay allows to set delay between delivery attempts. Default delay is 1 second.
+func RetryDelay(d time.Duration) DeadLetterOption {
+	return func(o *DeadLetterOptions) {
+		o.RetryDelay = d
+	}
+}
+
+// DeadLetterTopic allows to set topic which dead-lettered messages are published to.
+// By default messages are published to original topic with ".dlq" suffix.
+func DeadLetterTopic(topic string) DeadLetterOption {
+	return func(o *DeadLetterOptions) {
+		o.Topic = topic
+	}
+}
+
+// DeadLetterPolicy represents consumer-side policy which retries processing of the message and republishes message
+// which cannot be processed (poison message) to dead-letter topic.
+type DeadLetterPolicy struct {
+	Broker  MessageBroker     // message broker used to publish dead-lettered messages
+	Options DeadLetterOptions // dead-letter policy options
+}
+
+// NewDeadLetterPolicy creates dead-letter policy which publishes dead-lettered messages using message broker.
+func NewDeadLetterPolicy(b MessageBroker, opts ...DeadLetterOption) *DeadLetterPolicy {
+	p := &DeadLetterPolicy{
+		Broker: b,
+		Options: DeadLetterOptions{
+			MaxAttempts: defaultMaxAttempts,
+			RetryDelay:  defaultRetryDelay,
+		},
+	}
+
+	for _, opt := range opts {
+		opt(&p.Options)
+	}
+
+	return p
+}
+
+// TopicFor returns dead-letter topic for the original topic.
+func (p *DeadLetterPolicy) TopicFor(topic string) string {
+	if p.Options.Topic != "" {
+		return p.Options.Topic
+	}
+	return topic + deadLetterSuffix
+}
+
+// Wrap returns handler which calls h until message is processed or maximum number of delivery attempts is reached.
+// Message which cannot be processed is published to dead-letter topic with original topic, last error and number of attempts
+// stored in message context and wrapped handler returns nil, so message can be acknowledged. Error is returned only
+// if context is done or message cannot be dead-lettered.
+func (p *DeadLetterPolicy) Wrap(h Handler) Handler {
+	return func(ctx context.Context, m Message) error {
+		attempts := Attempts(m)
+
+		var err error
+		for {
+			attempts++
+
+			if err = h(ctx, m); err == nil {
+				return nil
+			}
+
+			logger.Log().WarningWithFields(logger.Fields{
+				"error":     err,
+				"topic":     m.Topic,
+				"attempt":   attempts,
+				"component": deadLetterComponentName,
+			}, "Cannot process message")
+
+			if attempts >= p.Options.MaxAttempts {
+				break
+			}
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(p.Options.RetryDelay):
+			}
+		}
+
+		return p.deadLetter(ctx, m, err, attempts)
+	}
+}
+
+func (p *DeadLetterPolicy) deadLetter(ctx context.Context, m Message, cause error, attempts int) error {
+	id, err := newDeadLetterID()
+	if err != nil {
+		return err
+	}
+
+	dl := Message{
+		Topic:   p.TopicFor(m.Topic),
+		Value:   encoded(m.Value),
+		Context: MessageContext{},
+	}
+
+	for k, v := range m.Context {
+		dl.Context[k] = v
+	}
+	dl.Context[DeadLetterIDKey] = id
+	dl.Context[OriginalTopicKey] = m.Topic
+	dl.Context[ErrorKey] = cause.Error()
+	dl.Context[AttemptsKey] = strconv.Itoa(attempts)
+
+	if err := p.Broker.PublishMessage(ctx, dl); err != nil {
+		logger.Log().ErrorWithFields(logger.Fields{
+			"error":     err,
+			"topic":     dl.Topic,
+			"component": deadLetterComponentName,
+		}, "Cannot publish dead-lettered message")
+
+		return err
+	}
+
+	logger.Log().WarningWithFields(logger.Fields{
+		"id":        id,
+		"topic":     m.Topic,
+		"dlq":       dl.Topic,
+		"error":     cause,
+		"attempts":  attempts,
+		"component": deadLetterComponentName,
+	}, "Message dead-lettered")
+
+	return nil
+}
+
+// Attempts returns number of delivery attempts stored in message context. It returns 0 if message was not attempted yet.
+func Attempts(m Message) int {
+	switch v := m.Context[AttemptsKey].(type) {
+	case int:
+		return v
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	case string:
+		n, _ := strconv.Atoi(v)
+		return n
+	case []byte:
+		n, _ := strconv.Atoi(string(v))
+		return n
+	}
+	return 0
+}
+
+// encoded prevents received message value from being encoded again when message is republished.
+func encoded(v interface{}) interface{} {
+	if raw, ok := v.([]byte); ok {
+		return Encoded(raw)
+	}
+	return v
+}
+
+func newDeadLetterID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// DeadLetter represents message which was dead-lettered.
+type DeadLetter struct {
+	ID            string    // dead-lettered message identifier
+	OriginalTopic string    // topic which message was received from
+	Error         string    // last error returned by message handler
+	Attempts      int       // number of delivery attempts
+	Received      time.Time // time when dead-lettered message was received by dead-letter queue
+	Message       Message   // dead-lettered message
+
+	seq uint64 // order in which message was received
+}
+
+// DeadLetterQueue represents dead-letter topic consumer which allows to list and replay dead-lettered messages.
+// Dead-lettered messages are acknowledged only when they are replayed or discarded, so they are kept by message broker
+// until then (it requires broker supporting manual acknowledgement, e.g. Kafka consumer group has to be passed in context).
+// Messages are acknowledged in order they were received - message which is replayed or discarded before earlier messages
+// is acknowledged when all earlier messages are handled, because some brokers (e.g. Kafka) acknowledge messages cumulatively.
+// Such message is received again if dead-letter queue is restarted before.
+type DeadLetterQueue struct {
+	Broker MessageBroker // message broker
+	Topic  string        // dead-letter topic
+
+	mu      sync.RWMutex
+	letters map[string]DeadLetter
+	seq     uint64
+	cancel  context.CancelFunc
+
+	unacked []string           // identifiers of messages which are not acknowledged in order they were received
+	handled map[string]Message // messages which are replayed or discarded but not acknowledged yet
+}
+
+// NewDeadLetterQueue subscribes to dead-letter topic and collects dead-lettered messages until context is done
+// or dead-letter queue is disposed. Context is passed to MessageBroker.Subscribe with manual acknowledgement turned on.
+func NewDeadLetterQueue(ctx context.Context, b MessageBroker, topic string) (*DeadLetterQueue, error) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	messages, err := b.Subscribe(ManualAck(ctx), topic)
+	if err != nil {
+		cancel()
+
+		logger.Log().ErrorWithFields(logger.Fields{
+			"error":     err,
+			"topic":     topic,
+			"component": deadLetterComponentName,
+		}, "Cannot subscribe to dead-letter topic")
+
+		return nil, err
+	}
+
+	q := &DeadLetterQueue{
+		Broker:  b,
+		Topic:   topic,
+		letters: make(map[string]DeadLetter),
+		cancel:  cancel,
+		handled: make(map[string]Message),
+	}
+
+	go func() {
+		for m := range messages {
+			q.add(m)
+		}
+	}()
+
+	return q, nil
+}
+
+func (q *DeadLetterQueue) add(m Message) {
+	id, _ := m.Context[DeadLetterIDKey].(string)
+	if id == "" {
+		// message was not published by dead-letter policy
+		id, _ = newDeadLetterID()
+	}
+	topic, _ := m.Context[OriginalTopicKey].(string)
+	cause, _ := m.Context[ErrorKey].(string)
+
+	q.mu.Lock()
+	if _, ok := q.letters[id]; !ok {
+		q.unacked = append(q.unacked, id)
+	}
+	q.seq++
+	q.letters[id] = DeadLetter{
+		ID:            id,
+		OriginalTopic: topic,
+		Error:         cause,
+		Attempts:      Attempts(m),
+		Received:      time.Now(),
+		Message:       m,
+		seq:           q.seq,
+	}
+	q.mu.Unlock()
+}
+
+// List returns dead-lettered messages in order they were received.
+func (q *DeadLetterQueue) List() []DeadLetter {
+	q.mu.RLock()
+	letters := make([]DeadLetter, 0, len(q.letters))
+	for _, dl := range q.letters {
+		letters = append(letters, dl)
+	}
+	q.mu.RUnlock()
+
+	sort.Slice(letters, func(i, j int) bool {
+		return letters[i].seq < letters[j].seq
+	})
+
+	return letters
+}
+
+// Replay publishes dead-lettered message with specified identifier back to its original topic with delivery attempts reset.
+func (q *DeadLetterQueue) Replay(ctx context.Context, id string) error {
+	dl, err := q.get(id)
+	if err != nil {
+		return err
+	}
+
+	if dl.OriginalTopic == "" {
+		return fmt.Errorf("[%s]: Cannot replay message %q - original topic is unknown", deadLetterComponentName, id)
+	}
+
+	m := Message{
+		Topic:   dl.OriginalTopic,
+		Value:   encoded(dl.Message.Value),
+		Context: MessageContext{},
+	}
+
+	for k, v := range dl.Message.Context {
+		m.Context[k] = v
+	}
+	// replayed message gets new identifier, so it is not dropped as duplicate of dead-lettered message
+	for _, k := range []string{DeadLetterIDKey, OriginalTopicKey, ErrorKey, AttemptsKey, MessageIDKey} {
+		delete(m.Context, k)
+	}
+
+	if err := q.Broker.PublishMessage(ctx, m); err != nil {
+		logger.Log().ErrorWithFields(logger.Fields{
+			"error":     err,
+			"id":        id,
+			"topic":     m.Topic,
+			"component": deadLetterComponentName,
+		}, "Cannot replay dead-lettered message")
+
+		return err
+	}
+
+	logger.Log().InfoWithFields(logger.Fields{
+		"id":        id,
+		"topic":     m.Topic,
+		"component": deadLetterComponentName,
+	}, "Dead-lettered message replayed")
+
+	return q.remove(dl)
+}
+
+// Discard removes dead-lettered message with specified identifier without replaying it.
+func (q *DeadLetterQueue) Discard(id string) error {
+	dl, err := q.get(id)
+	if err != nil {
+		return err
+	}
+	return q.remove(dl)
+}
+
+func (q *DeadLetterQueue) get(id string) (DeadLetter, error) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	dl, ok := q.letters[id]
+	if !ok {
+		return dl, fmt.Errorf("[%s]: Dead-lettered message %q not found", deadLetterComponentName, id)
+	}
+	return dl, nil
+}
+
+// remove removes handled message and acknowledges it together with next handled messages once all earlier messages are handled.
+func (q *DeadLetterQueue) remove(dl DeadLetter) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.letters, dl.ID)
+	q.handled[dl.ID] = dl.Message
+
+	for len(q.unacked) > 0 {
+		m, ok := q.handled[q.unacked[0]]
+		if !ok {
+			return nil
+		}
+
+		if err := m.Ack(); err != nil {
+			logger.Log().ErrorWithFields(logger.Fields{
+				"error":     err,
+				"id":        q.unacked[0],
+				"component": deadLetterComponentName,
+			}, "Cannot acknowledge dead-lettered message")
+
+			return err
+		}
+
+		delete(q.handled, q.unacked[0])
+		q.unacked = q.unacked[1:]
+	}
+	return nil
+}
+
+// Dispose cancels subscription to dead-letter topic.
+func (q *DeadLetterQueue) Dispose() {
+	logger.Log().InfoWithFields(logger.Fields{"component": deadLetterComponentName}, "Disposing dead-letter queue")
+
+	q.cancel()
+}
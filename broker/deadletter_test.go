@@ -0,0 +1,185 @@
+package broker_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gkarlik/quark-go/broker"
+	"github.com/gkarlik/quark-go/broker/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+type TestPayload struct {
+	Text string `json:"text"`
+}
+
+func TestDeadLetterPolicy(t *testing.T) {
+	topic := "TestTopic"
+
+	b := memory.NewMessageBroker()
+	defer b.Dispose()
+
+	p := broker.NewDeadLetterPolicy(b, broker.MaxAttempts(2), broker.RetryDelay(time.Millisecond))
+	assert.Equal(t, "TestTopic.dlq", p.TopicFor(topic))
+
+	dlq, err := b.Subscribe(context.Background(), p.TopicFor(topic))
+	assert.NoError(t, err, "Subscribe returned an error")
+
+	calls := 0
+	h := p.Wrap(func(ctx context.Context, m broker.Message) error {
+		calls++
+		return errors.New("test error")
+	})
+
+	m := broker.Message{Topic: topic, Value: []byte(`{"text":"Test"}`), Context: broker.MessageContext{"TestKey": "TestValue"}}
+
+	err = h(context.Background(), m)
+	assert.NoError(t, err, "Handler returned an error")
+	assert.Equal(t, 2, calls)
+
+	dl := <-dlq
+	assert.Equal(t, topic, dl.Context[broker.OriginalTopicKey])
+	assert.Equal(t, "test error", dl.Context[broker.ErrorKey])
+	assert.Equal(t, 2, broker.Attempts(dl))
+	assert.Equal(t, "TestValue", dl.Context["TestKey"])
+	assert.NotEmpty(t, dl.Context[broker.DeadLetterIDKey])
+
+	var payload TestPayload
+	err = json.Unmarshal(dl.Value.([]byte), &payload)
+	assert.NoError(t, err, "Unmarshal returned an error")
+	assert.Equal(t, "Test", payload.Text)
+}
+
+func TestDeadLetterPolicyRetry(t *testing.T) {
+	b := memory.NewMessageBroker()
+	defer b.Dispose()
+
+	p := broker.NewDeadLetterPolicy(b, broker.RetryDelay(time.Millisecond))
+
+	calls := 0
+	h := p.Wrap(func(ctx context.Context, m broker.Message) error {
+		calls++
+		if calls == 1 {
+			return errors.New("test error")
+		}
+		return nil
+	})
+
+	err := h(context.Background(), broker.Message{Topic: "TestTopic", Value: 1})
+	assert.NoError(t, err, "Handler returned an error")
+	assert.Equal(t, 2, calls)
+}
+
+func TestDeadLetterPolicyCancellation(t *testing.T) {
+	b := memory.NewMessageBroker()
+	defer b.Dispose()
+
+	p := broker.NewDeadLetterPolicy(b, broker.RetryDelay(time.Hour))
+	h := p.Wrap(func(ctx context.Context, m broker.Message) error {
+		return errors.New("test error")
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := h(ctx, broker.Message{Topic: "TestTopic", Value: 1})
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestDeadLetterQueue(t *testing.T) {
+	topic := "TestTopic"
+
+	b := memory.NewMessageBroker()
+	defer b.Dispose()
+
+	p := broker.NewDeadLetterPolicy(b, broker.MaxAttempts(1), broker.DeadLetterTopic("TestDeadLetters"))
+
+	q, err := broker.NewDeadLetterQueue(context.Background(), b, p.TopicFor(topic))
+	assert.NoError(t, err, "NewDeadLetterQueue returned an error")
+	defer q.Dispose()
+
+	messages, err := b.Subscribe(context.Background(), topic)
+	assert.NoError(t, err, "Subscribe returned an error")
+
+	h := p.Wrap(func(ctx context.Context, m broker.Message) error {
+		return errors.New("test error")
+	})
+
+	for _, text := range []string{"First", "Second"} {
+		err = h(context.Background(), broker.Message{Topic: topic, Value: []byte(`{"text":"` + text + `"}`)})
+		assert.NoError(t, err, "Handler returned an error")
+	}
+
+	assert.Eventually(t, func() bool { return len(q.List()) == 2 }, time.Second, time.Millisecond)
+
+	letters := q.List()
+	assert.Equal(t, topic, letters[0].OriginalTopic)
+	assert.Equal(t, "test error", letters[0].Error)
+	assert.Equal(t, 1, letters[0].Attempts)
+
+	assert.Error(t, q.Replay(context.Background(), "unknown"), "Replay should return an error")
+
+	err = q.Replay(context.Background(), letters[0].ID)
+	assert.NoError(t, err, "Replay returned an error")
+
+	m := <-messages
+	assert.Equal(t, 0, broker.Attempts(m))
+	assert.Nil(t, m.Context[broker.OriginalTopicKey])
+
+	var payload TestPayload
+	err = json.Unmarshal(m.Value.([]byte), &payload)
+	assert.NoError(t, err, "Unmarshal returned an error")
+	assert.Equal(t, "First", payload.Text)
+
+	assert.NoError(t, q.Discard(letters[1].ID), "Discard returned an error")
+	assert.Empty(t, q.List())
+}
+
+// ChannelBroker delivers messages from channel to subscriber.
+type ChannelBroker struct {
+	*memory.MessageBroker
+
+	messages chan broker.Message
+}
+
+func (b *ChannelBroker) Subscribe(ctx context.Context, topic string) (<-chan broker.Message, error) {
+	return b.messages, nil
+}
+
+func TestDeadLetterQueueAckOrder(t *testing.T) {
+	b := &ChannelBroker{MessageBroker: memory.NewMessageBroker(), messages: make(chan broker.Message, 3)}
+	defer b.Dispose()
+
+	var acks []*TestAcknowledger
+	for _, id := range []string{"1", "2", "3"} {
+		a := &TestAcknowledger{}
+		acks = append(acks, a)
+
+		b.messages <- broker.Message{
+			Topic:        "TestDeadLetters",
+			Context:      broker.MessageContext{broker.DeadLetterIDKey: id},
+			Acknowledger: a,
+		}
+	}
+
+	q, err := broker.NewDeadLetterQueue(context.Background(), b, "TestDeadLetters")
+	assert.NoError(t, err, "NewDeadLetterQueue returned an error")
+	defer q.Dispose()
+
+	assert.Eventually(t, func() bool { return len(q.List()) == 3 }, time.Second, time.Millisecond)
+
+	// later messages are not acknowledged before earlier ones
+	assert.NoError(t, q.Discard("3"), "Discard returned an error")
+	assert.NoError(t, q.Discard("2"), "Discard returned an error")
+	assert.False(t, acks[1].acked)
+	assert.False(t, acks[2].acked)
+
+	assert.NoError(t, q.Discard("1"), "Discard returned an error")
+	for _, a := range acks {
+		assert.True(t, a.acked)
+	}
+	assert.Empty(t, q.List())
+}
@@ -0,0 +1,56 @@
+package broker
+
+import (
+	"time"
+)
+
+// DeliverAtKey defines message context key of time (RFC3339 string) when message should be delivered to subscribers.
+const DeliverAtKey = "deliver-at"
+
+// PublishAt returns message which is delivered to subscribers not earlier than at time t. Message context is copied.
+// RabbitMQ message broker delays such messages natively (up to 24 hours), other message brokers (e.g. Kafka) return an error
+// and require scheduler which stores message until it is due (see gorm.Scheduler). Message with time in the past is delivered
+// immediately.
+func PublishAt(m Message, t time.Time) Message {
+	mc := make(MessageContext, len(m.Context)+1)
+	for k, v := range m.Context {
+		mc[k] = v
+	}
+	mc[DeliverAtKey] = t.UTC().Format(time.RFC3339Nano)
+
+	m.Context = mc
+	return m
+}
+
+// Delay returns message which is delivered to subscribers after delay d. See PublishAt.
+func Delay(m Message, d time.Duration) Message {
+	return PublishAt(m, time.Now().Add(d))
+}
+
+// DeliverAt returns time when message should be delivered to subscribers. It returns false if message is not delayed.
+func DeliverAt(m Message) (time.Time, bool) {
+	switch v := m.Context[DeliverAtKey].(type) {
+	case string:
+		t, err := time.Parse(time.RFC3339Nano, v)
+		return t, err == nil
+	case []byte:
+		t, err := time.Parse(time.RFC3339Nano, string(v))
+		return t, err == nil
+	case time.Time:
+		return v, true
+	}
+	return time.Time{}, false
+}
+
+// Due returns delay after which message should be delivered to subscribers. It returns zero if message is not delayed
+// or its delivery time has already passed.
+func Due(m Message) time.Duration {
+	t, ok := DeliverAt(m)
+	if !ok {
+		return 0
+	}
+	if d := time.Until(t); d > 0 {
+		return d
+	}
+	return 0
+}
@@ -0,0 +1,32 @@
+package broker_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gkarlik/quark-go/broker"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPublishAt(t *testing.T) {
+	m := broker.Message{Topic: "TestTopic", Context: broker.MessageContext{"TestKey": "TestValue"}}
+
+	_, ok := broker.DeliverAt(m)
+	assert.False(t, ok)
+	assert.Equal(t, time.Duration(0), broker.Due(m))
+
+	at := time.Now().Add(time.Hour)
+	d := broker.PublishAt(m, at)
+
+	// context of original message is not modified
+	assert.Nil(t, m.Context[broker.DeliverAtKey])
+	assert.Equal(t, "TestValue", d.Context["TestKey"])
+
+	deliverAt, ok := broker.DeliverAt(d)
+	assert.True(t, ok)
+	assert.True(t, at.Equal(deliverAt))
+	assert.True(t, broker.Due(d) > 59*time.Minute)
+
+	// message with time in the past is due
+	assert.Equal(t, time.Duration(0), broker.Due(broker.Delay(m, -time.Minute)))
+}
@@ -0,0 +1,126 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gkarlik/quark-go/logger"
+	uuid "github.com/satori/go.uuid"
+)
+
+const (
+	// MessageIDKey defines message context key of unique message identifier. It is set automatically when message is published.
+	MessageIDKey = "message-id"
+
+	inboxComponentName = "MessageInbox"
+)
+
+// ErrMessageInProgress is returned by Deduplicate handler when message is delivered again while it is still processed.
+// Message must not be acknowledged, so it is redelivered if processing fails.
+var ErrMessageInProgress = fmt.Errorf("[%s]: Cannot process message - the same message is being processed", inboxComponentName)
+
+// MessageID returns unique message identifier stored in message context. It returns empty string if identifier is not set.
+func MessageID(m Message) string {
+	id, _ := m.Context[MessageIDKey].(string)
+	return id
+}
+
+// WithMessageID returns message with unique identifier stored in message context. If message already has identifier
+// it is returned unchanged, otherwise message context is copied and new identifier is generated.
+// It is used by MessageBroker implementations when message is published.
+func WithMessageID(m Message) Message {
+	if MessageID(m) != "" {
+		return m
+	}
+
+	mc := make(MessageContext, len(m.Context)+1)
+	for k, v := range m.Context {
+		mc[k] = v
+	}
+	mc[MessageIDKey] = uuid.NewV4().String()
+
+	m.Context = mc
+	return m
+}
+
+// Inbox represents store of identifiers of processed messages which is used to detect redelivered messages.
+type Inbox interface {
+	Add(id string, ttl time.Duration) (bool, error) // records identifier for ttl, returns false if identifier is already recorded
+	Remove(id string) error                         // removes identifier, so message can be processed again
+}
+
+// Deduplicate returns handler which drops messages already processed by h (duplicates) using identifiers recorded in inbox.
+// Message identifier is recorded before message is processed and removed if h returns an error, so redelivered message
+// can be processed again. Duplicate delivered while the message is processed by the same handler is not dropped -
+// ErrMessageInProgress is returned, so it is redelivered and not lost if processing fails. Identifiers are kept for ttl,
+// so ttl should be longer than period in which message broker can redeliver message. Messages without identifier are not deduplicated.
+func Deduplicate(inbox Inbox, ttl time.Duration, h Handler) Handler {
+	var mu sync.Mutex
+	inProgress := map[string]bool{} // identifiers of messages processed by h
+
+	done := func(id string) {
+		mu.Lock()
+		delete(inProgress, id)
+		mu.Unlock()
+	}
+
+	return func(ctx context.Context, m Message) error {
+		id := MessageID(m)
+		if id == "" {
+			return h(ctx, m)
+		}
+
+		mu.Lock()
+		if inProgress[id] {
+			mu.Unlock()
+
+			logger.Log().WarningWithFields(logger.Fields{
+				"id":        id,
+				"topic":     m.Topic,
+				"component": inboxComponentName,
+			}, "Duplicated message is still processed")
+
+			return ErrMessageInProgress
+		}
+		inProgress[id] = true
+		mu.Unlock()
+
+		defer done(id)
+
+		added, err := inbox.Add(id, ttl)
+		if err != nil {
+			logger.Log().ErrorWithFields(logger.Fields{
+				"error":     err,
+				"id":        id,
+				"component": inboxComponentName,
+			}, "Cannot record message identifier")
+
+			return err
+		}
+
+		if !added {
+			logger.Log().InfoWithFields(logger.Fields{
+				"id":        id,
+				"topic":     m.Topic,
+				"component": inboxComponentName,
+			}, "Duplicated message dropped")
+
+			return nil
+		}
+
+		if err := h(ctx, m); err != nil {
+			if rerr := inbox.Remove(id); rerr != nil {
+				logger.Log().ErrorWithFields(logger.Fields{
+					"error":     rerr,
+					"id":        id,
+					"component": inboxComponentName,
+				}, "Cannot remove message identifier")
+			}
+			return err
+		}
+
+		return nil
+	}
+}
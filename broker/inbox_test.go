@@ -0,0 +1,94 @@
+package broker_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gkarlik/quark-go/broker"
+	"github.com/gkarlik/quark-go/broker/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessageID(t *testing.T) {
+	m := broker.Message{Topic: "TestTopic"}
+	assert.Empty(t, broker.MessageID(m))
+
+	m = broker.WithMessageID(m)
+	id := broker.MessageID(m)
+	assert.NotEmpty(t, id)
+
+	// identifier is not changed once it is set
+	m = broker.WithMessageID(m)
+	assert.Equal(t, id, broker.MessageID(m))
+
+	// message context is copied
+	mc := broker.MessageContext{"TestKey": "TestValue"}
+	m = broker.WithMessageID(broker.Message{Context: mc})
+	assert.NotEmpty(t, broker.MessageID(m))
+	assert.Empty(t, mc[broker.MessageIDKey])
+}
+
+func TestDeduplicate(t *testing.T) {
+	calls := 0
+	fail := true
+
+	h := broker.Deduplicate(memory.NewInbox(), time.Minute, func(ctx context.Context, m broker.Message) error {
+		calls++
+		if fail {
+			return errors.New("test error")
+		}
+		return nil
+	})
+
+	m := broker.WithMessageID(broker.Message{Topic: "TestTopic"})
+
+	// failed message can be processed again
+	assert.Error(t, h(context.Background(), m), "Handler should return an error")
+
+	fail = false
+	assert.NoError(t, h(context.Background(), m), "Handler returned an error")
+	assert.NoError(t, h(context.Background(), m), "Handler returned an error")
+	assert.Equal(t, 2, calls)
+
+	// messages without identifier are not deduplicated
+	m = broker.Message{Topic: "TestTopic"}
+	assert.NoError(t, h(context.Background(), m), "Handler returned an error")
+	assert.NoError(t, h(context.Background(), m), "Handler returned an error")
+	assert.Equal(t, 4, calls)
+}
+
+func TestDeduplicateInProgress(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	calls := 0
+
+	h := broker.Deduplicate(memory.NewInbox(), time.Minute, func(ctx context.Context, m broker.Message) error {
+		calls++
+		if calls == 1 {
+			close(started)
+			<-release
+			return errors.New("test error")
+		}
+		return nil
+	})
+
+	m := broker.WithMessageID(broker.Message{Topic: "TestTopic"})
+
+	errs := make(chan error)
+	go func() {
+		errs <- h(context.Background(), m)
+	}()
+	<-started
+
+	// duplicate delivered while message is processed is not acknowledged
+	assert.Equal(t, broker.ErrMessageInProgress, h(context.Background(), m))
+
+	close(release)
+	assert.Error(t, <-errs, "Handler should return an error")
+
+	// message which failed is processed again
+	assert.NoError(t, h(context.Background(), m), "Handler returned an error")
+	assert.Equal(t, 2, calls)
+}
@@ -0,0 +1,297 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/gkarlik/quark-go/broker"
+	"github.com/gkarlik/quark-go/logger"
+)
+
+// Delivery represents delivery report of message published asynchronously.
+type Delivery struct {
+	Message   broker.Message // published message
+	Partition int32          // partition message was written to
+	Offset    int64          // offset of message in partition
+	Error     error          // error if message could not be delivered
+}
+
+// DeliveryCallback represents function which is called with delivery report of each message published asynchronously.
+// It is called from single goroutine, so it should not block.
+type DeliveryCallback func(d Delivery)
+
+// AsyncOption represents function which is used to apply asynchronous publishing options.
+type AsyncOption func(*AsyncOptions)
+
+// AsyncOptions represents asynchronous publishing options.
+type AsyncOptions struct {
+	BatchSize  int              // number of messages which triggers sending of batch
+	BatchBytes int              // size of messages in bytes which triggers sending of batch
+	Linger     time.Duration    // maximum time messages wait for batch to be sent
+	BufferSize int              // number of messages buffered before publishing blocks
+	OnDelivery DeliveryCallback // callback called with delivery reports
+}
+
+// BatchSize allows to set number of messages which triggers sending of batch. By default batch size is not limited.
+func BatchSize(n int) AsyncOption {
+	return func(o *AsyncOptions) {
+		o.BatchSize = n
+	}
+}
+
+// BatchBytes allows to set size of messages in bytes which triggers sending of batch. By default batch size is not limited.
+func BatchBytes(n int) AsyncOption {
+	return func(o *AsyncOptions) {
+		o.BatchBytes = n
+	}
+}
+
+// Linger allows to set maximum time messages wait for batch to be sent. By default messages are sent as soon as possible.
+func Linger(d time.Duration) AsyncOption {
+	return func(o *AsyncOptions) {
+		o.Linger = d
+	}
+}
+
+// BufferSize allows to set number of messages buffered by producer. Publishing blocks (until message is buffered or
+// context is done) when buffer is full. Default is taken from Kafka client configuration (256 messages).
+func BufferSize(n int) AsyncOption {
+	return func(o *AsyncOptions) {
+		o.BufferSize = n
+	}
+}
+
+// OnDelivery allows to set callback which is called with delivery report of each message published asynchronously.
+func OnDelivery(f DeliveryCallback) AsyncOption {
+	return func(o *AsyncOptions) {
+		o.OnDelivery = f
+	}
+}
+
+// batch represents messages published together which PublishMessages waits for.
+type batch struct {
+	wg   sync.WaitGroup
+	mu   sync.Mutex
+	errs []error
+}
+
+func (b *batch) done(err error) {
+	if err != nil {
+		b.mu.Lock()
+		b.errs = append(b.errs, err)
+		b.mu.Unlock()
+	}
+	b.wg.Done()
+}
+
+// pending represents message published asynchronously which waits for delivery report. It is passed as producer message metadata.
+type pending struct {
+	message broker.Message // published message
+	batch   *batch         // batch of the message, nil if message was published by PublishMessage
+}
+
+// EnableAsync switches message broker to asynchronous publish mode. Messages are buffered and sent in batches by
+// separate asynchronous producer - PublishMessage returns as soon as message is buffered and delivery is reported
+// to OnDelivery callback. Batching is configured by BatchSize, BatchBytes and Linger options.
+func (b *MessageBroker) EnableAsync(opts ...AsyncOption) error {
+	o := AsyncOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	b.pmu.Lock()
+	defer b.pmu.Unlock()
+
+	if b.AsyncProducer != nil {
+		return fmt.Errorf("[%s]: Asynchronous publish mode is already enabled", componentName)
+	}
+
+	if b.Client == nil {
+		logger.Log().ErrorWithFields(logger.Fields{"component": componentName}, "Not connected to Kafka broker")
+
+		return fmt.Errorf("[%s]: Not connected to Kafka server. Please check logs and network connection", componentName)
+	}
+
+	// batching settings must not delay synchronous producer, so asynchronous producer uses its own client
+	cfg := *b.Client.Config()
+	cfg.Producer.Return.Successes = true
+	cfg.Producer.Return.Errors = true
+	cfg.Producer.Flush.Messages = o.BatchSize
+	cfg.Producer.Flush.Bytes = o.BatchBytes
+	cfg.Producer.Flush.Frequency = o.Linger
+	if o.BufferSize > 0 {
+		cfg.ChannelBufferSize = o.BufferSize
+	}
+
+	client, err := sarama.NewClient(b.addrs, &cfg)
+	if err != nil {
+		logger.Log().ErrorWithFields(logger.Fields{
+			"error":     err,
+			"addrs":     b.addrs,
+			"component": componentName,
+		}, "Cannot create Kafka client")
+
+		return err
+	}
+
+	producer, err := sarama.NewAsyncProducerFromClient(client)
+	if err != nil {
+		logger.Log().ErrorWithFields(logger.Fields{
+			"error":     err,
+			"addrs":     b.addrs,
+			"component": componentName,
+		}, "Cannot create Kafka asynchronous producer")
+
+		client.Close()
+		return err
+	}
+
+	b.AsyncProducer = producer
+	b.asyncClient = client
+	b.onDelivery = o.OnDelivery
+
+	b.deliveries.Add(1)
+	go b.report(producer)
+
+	logger.Log().InfoWithFields(logger.Fields{
+		"batchSize":  o.BatchSize,
+		"batchBytes": o.BatchBytes,
+		"linger":     o.Linger,
+		"component":  componentName,
+	}, "Asynchronous publish mode enabled")
+
+	return nil
+}
+
+// report passes delivery reports of asynchronous producer to callback and batches until producer is closed.
+func (b *MessageBroker) report(producer sarama.AsyncProducer) {
+	defer b.deliveries.Done()
+
+	successes, errors := producer.Successes(), producer.Errors()
+	for successes != nil || errors != nil {
+		var d Delivery
+		var p *pending
+
+		select {
+		case msg, ok := <-successes:
+			if !ok {
+				successes = nil
+				continue
+			}
+			p, _ = msg.Metadata.(*pending)
+			d = Delivery{Partition: msg.Partition, Offset: msg.Offset}
+		case perr, ok := <-errors:
+			if !ok {
+				errors = nil
+				continue
+			}
+			p, _ = perr.Msg.Metadata.(*pending)
+			d = Delivery{Partition: perr.Msg.Partition, Offset: perr.Msg.Offset, Error: perr.Err}
+
+			logger.Log().ErrorWithFields(logger.Fields{
+				"error":     perr.Err,
+				"topic":     perr.Msg.Topic,
+				"component": componentName,
+			}, "Cannot publish message")
+		}
+
+		if p == nil {
+			continue
+		}
+		d.Message = p.message
+
+		if b.onDelivery != nil {
+			b.onDelivery(d)
+		}
+		if p.batch != nil {
+			p.batch.done(d.Error)
+		}
+	}
+}
+
+// enqueue passes message to asynchronous producer. It blocks until message is buffered or context is done.
+func (b *MessageBroker) enqueue(ctx context.Context, msg *sarama.ProducerMessage) error {
+	select {
+	case b.AsyncProducer.Input() <- msg:
+		return nil
+	case <-ctx.Done():
+		logger.Log().ErrorWithFields(logger.Fields{
+			"error":     ctx.Err(),
+			"topic":     msg.Topic,
+			"component": componentName,
+		}, "Cannot publish message - producer buffer is full")
+
+		return ctx.Err()
+	}
+}
+
+// PublishMessages publishes batch of messages to Kafka broker and waits until all of them are delivered or context is done.
+// In asynchronous publish mode messages are buffered (blocking when buffer is full) and delivery reports are passed to
+// OnDelivery callback too. The first delivery error is returned.
+func (b *MessageBroker) PublishMessages(ctx context.Context, ms []broker.Message) error {
+	logger.Log().InfoWithFields(logger.Fields{
+		"messages":  len(ms),
+		"component": componentName,
+	}, "Publishing messages")
+
+	b.pmu.RLock()
+	defer b.pmu.RUnlock()
+
+	if b.Producer == nil {
+		logger.Log().ErrorWithFields(logger.Fields{"component": componentName}, "Not connected to Kafka broker")
+
+		return fmt.Errorf("[%s]: Not connected to Kafka server. Please check logs and network connection", componentName)
+	}
+
+	msgs := make([]*sarama.ProducerMessage, 0, len(ms))
+	for _, m := range ms {
+		msg, err := producerMessage(m)
+		if err != nil {
+			return err
+		}
+		msgs = append(msgs, msg)
+	}
+
+	if b.AsyncProducer == nil {
+		if err := b.Producer.SendMessages(msgs); err != nil {
+			logger.Log().ErrorWithFields(logger.Fields{
+				"error":     err,
+				"component": componentName,
+			}, "Cannot publish messages")
+
+			return err
+		}
+		return nil
+	}
+
+	bt := &batch{}
+	for _, msg := range msgs {
+		msg.Metadata.(*pending).batch = bt
+
+		bt.wg.Add(1)
+		if err := b.enqueue(ctx, msg); err != nil {
+			bt.wg.Done()
+			return err
+		}
+	}
+
+	delivered := make(chan struct{})
+	go func() {
+		bt.wg.Wait()
+		close(delivered)
+	}()
+
+	select {
+	case <-delivered:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if len(bt.errs) > 0 {
+		return bt.errs[0]
+	}
+	return nil
+}
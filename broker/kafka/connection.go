@@ -0,0 +1,51 @@
+package kafka
+
+import (
+	"time"
+
+	"github.com/gkarlik/quark-go/broker"
+	"github.com/gkarlik/quark-go/metrics"
+)
+
+const (
+	metricsPrefix = "kafka"
+
+	// period of checking connection to Kafka cluster
+	healthCheckInterval = 5 * time.Second
+)
+
+// State returns state of connection to Kafka cluster.
+func (b *MessageBroker) State() broker.ConnectionState {
+	return b.monitor.State()
+}
+
+// ExposeMetrics exposes connection state and number of reconnections using metrics exposer.
+func (b *MessageBroker) ExposeMetrics(m metrics.Exposer) {
+	b.monitor.ExposeMetrics(m, metricsPrefix)
+}
+
+// supervise periodically refreshes cluster metadata to check connection to Kafka cluster until broker is disposed.
+// Kafka client reconnects to brokers on its own, so supervisor only tracks connection state.
+func (b *MessageBroker) supervise() {
+	defer b.supervisor.Done()
+
+	ticker := time.NewTicker(healthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := b.Client.RefreshMetadata(); err != nil {
+			if b.ctx.Err() != nil {
+				return
+			}
+			b.monitor.Disconnected(err)
+			continue
+		}
+		b.monitor.Connected()
+	}
+}
@@ -0,0 +1,165 @@
+package kafka
+
+import (
+	"context"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/gkarlik/quark-go/broker"
+	"github.com/gkarlik/quark-go/logger"
+)
+
+// sessionAcknowledger acknowledges Kafka message by marking its offset in consumer group session.
+type sessionAcknowledger struct {
+	session sarama.ConsumerGroupSession // consumer group session
+	message *sarama.ConsumerMessage     // consumed message
+}
+
+// Ack confirms that message was processed by marking it in consumer group session.
+func (a sessionAcknowledger) Ack() error {
+	a.session.MarkMessage(a.message, "")
+	return nil
+}
+
+// Nack rejects message and skips it by marking it in consumer group session. Requeue is not supported
+// (see acknowledger.Nack) and error is returned if requeue is true.
+func (a sessionAcknowledger) Nack(requeue bool) error {
+	if requeue {
+		return ErrRequeueNotSupported
+	}
+	return a.Ack()
+}
+
+// groupHandler handles consumer group sessions and merges messages from all claimed partitions into single channel.
+type groupHandler struct {
+	group     string                // consumer group
+	messages  chan<- broker.Message // merged messages
+	manualAck bool                  // indicates if messages are acknowledged manually
+}
+
+// Setup is called at the beginning of new session, after partitions are assigned to the consumer.
+func (h groupHandler) Setup(s sarama.ConsumerGroupSession) error {
+	logger.Log().InfoWithFields(logger.Fields{
+		"group":      h.group,
+		"member":     s.MemberID(),
+		"generation": s.GenerationID(),
+		"claims":     s.Claims(),
+		"component":  componentName,
+	}, "Consumer group rebalanced - partitions assigned")
+
+	return nil
+}
+
+// Cleanup is called at the end of session, before partitions are revoked from the consumer.
+func (h groupHandler) Cleanup(s sarama.ConsumerGroupSession) error {
+	logger.Log().InfoWithFields(logger.Fields{
+		"group":      h.group,
+		"member":     s.MemberID(),
+		"generation": s.GenerationID(),
+		"claims":     s.Claims(),
+		"component":  componentName,
+	}, "Consumer group rebalancing - partitions revoked")
+
+	return nil
+}
+
+// ConsumeClaim consumes messages from claimed partition. Messages are marked as consumed after they are passed to the subscriber
+// unless manual acknowledgement is turned on.
+func (h groupHandler) ConsumeClaim(s sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for msg := range claim.Messages() {
+		m := newMessage(msg)
+
+		if h.manualAck {
+			m.Acknowledger = sessionAcknowledger{session: s, message: msg}
+		}
+
+		select {
+		case h.messages <- m:
+		case <-s.Context().Done():
+			return nil
+		}
+
+		if !h.manualAck {
+			s.MarkMessage(msg, "")
+		}
+	}
+	return nil
+}
+
+// subscribeGroup joins consumer group and consumes messages from all partitions of the topic assigned to this group member.
+// Consumer group requires Kafka version 0.10.2 or newer to be set in client configuration.
+func (b *MessageBroker) subscribeGroup(ctx context.Context, group string, topic string) (<-chan broker.Message, error) {
+	cg, err := sarama.NewConsumerGroupFromClient(group, b.Client)
+	if err != nil {
+		logger.Log().ErrorWithFields(logger.Fields{
+			"error":     err,
+			"group":     group,
+			"component": componentName,
+		}, "Cannot create consumer group")
+
+		return nil, err
+	}
+
+	logger.Log().InfoWithFields(logger.Fields{
+		"group":     group,
+		"topic":     topic,
+		"component": componentName,
+	}, "Joining consumer group")
+
+	mgs := make(chan broker.Message)
+	handler := groupHandler{
+		group:     group,
+		messages:  mgs,
+		manualAck: broker.IsManualAck(ctx),
+	}
+
+	ctx, done := b.subscription(ctx)
+
+	go func() {
+		for err := range cg.Errors() {
+			logger.Log().ErrorWithFields(logger.Fields{
+				"error":     err,
+				"group":     group,
+				"component": componentName,
+			}, "Consumer group error")
+
+			broker.HandleError(ctx, err)
+		}
+	}()
+
+	backoff := b.Client.Config().Consumer.Retry.Backoff
+
+	go func() {
+		defer done()
+		defer close(mgs)
+		// leave consumer group when subscription ends
+		defer cg.Close()
+
+		// Consume returns on each rebalance, so it has to be called in a loop
+		for {
+			if err := cg.Consume(ctx, []string{topic}, handler); err != nil {
+				if err == sarama.ErrClosedConsumerGroup {
+					return
+				}
+
+				logger.Log().ErrorWithFields(logger.Fields{
+					"error":     err,
+					"group":     group,
+					"topic":     topic,
+					"component": componentName,
+				}, "Cannot consume messages in consumer group")
+
+				broker.HandleError(ctx, err)
+			}
+
+			// Consume may return immediately (e.g. when no partitions are claimed), so it is not called again without backoff
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+		}
+	}()
+
+	return mgs, nil
+}
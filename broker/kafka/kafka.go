@@ -2,8 +2,9 @@ package kafka
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"math"
+	"sync"
 
 	"github.com/Shopify/sarama"
 	"github.com/gkarlik/quark-go/broker"
@@ -20,27 +21,85 @@ const (
 	Partition = "partition"
 	// Timestamp defines Kafka message timestamp.
 	Timestamp = "timestamp"
+	// Group defines Kafka consumer group used to commit offsets.
+	Group = "group"
 
 	componentName = "KafkaBroker"
 )
 
-// MessageBroker represents message broker based on Kafka.
+// ErrRequeueNotSupported is returned when message is rejected with requeue. Kafka offsets are committed cumulatively,
+// so single message cannot be redelivered.
+var ErrRequeueNotSupported = broker.ErrRequeueNotSupported
+
+// ErrDelayNotSupported is returned when delayed message (see broker.PublishAt) is published before it is due. Kafka delivers
+// messages immediately, so delayed messages must be stored by scheduler until they are due (see gorm.Schedule).
+var ErrDelayNotSupported = fmt.Errorf("[%s]: Cannot publish message - delayed delivery is not supported by Kafka", componentName)
+
+// MessageBroker represents message broker based on Kafka. Partition subscriptions are re-established automatically
+// when partition consumer fails.
 type MessageBroker struct {
+	Client   sarama.Client       // kafka client
 	Consumer sarama.Consumer     // message consumer
 	Producer sarama.SyncProducer // message producer
+
+	AsyncProducer sarama.AsyncProducer // asynchronous message producer, nil unless asynchronous publish mode is enabled
+
+	addrs       []string         // addresses of Kafka brokers
+	asyncClient sarama.Client    // kafka client of asynchronous producer
+	onDelivery  DeliveryCallback // callback called with delivery reports of asynchronous producer
+	pmu         sync.RWMutex     // mutex for synchronizing publishing with enabling asynchronous mode and disposing
+	deliveries  sync.WaitGroup   // waits for delivery reports of asynchronous producer
+
+	opts       []cb.Option               // retry policy options used to connect to Kafka broker
+	monitor    *broker.ConnectionMonitor // connection state
+	ctx        context.Context           // context which is cancelled on Dispose
+	cancel     context.CancelFunc        // cancels connection supervisor
+	supervisor sync.WaitGroup            // waits for connection supervisor
+
+	mu            sync.Mutex                 // mutex for synchronizing subscriptions
+	subscriptions map[int]context.CancelFunc // active subscriptions which are cancelled on Dispose
+	nextID        int                        // identifier of next subscription
+	wg            sync.WaitGroup             // waits for subscriptions to release consumers
+}
+
+// acknowledger acknowledges Kafka message by marking its offset in consumer group offset manager.
+type acknowledger struct {
+	pom    sarama.PartitionOffsetManager // partition offset manager
+	offset int64                         // message offset
+}
+
+// Ack confirms that message was processed by marking next offset to be committed.
+func (a acknowledger) Ack() error {
+	a.pom.MarkOffset(a.offset+1, "")
+	return nil
+}
+
+// Nack rejects message and skips it by marking its offset. Kafka offsets are cumulative - acknowledging later message
+// moves committed offset past rejected one, so requeue is not supported and error is returned if requeue is true.
+func (a acknowledger) Nack(requeue bool) error {
+	if requeue {
+		return ErrRequeueNotSupported
+	}
+	return a.Ack()
 }
 
 // NewMessageBroker creates instance of Kafka client message broker which is connected to provided addresses.
-// Additional options passed as arguments are used to configure Kafka client and circuit breaker pattern to connect to Kafka instance.
-// Panics if cannot create an instance (producer and/or consumer).
+// Additional options passed as arguments are used to configure Kafka client and retry policy (backoff, jitter, cancellation context etc.) to connect to Kafka instance.
+// The same options are used to consume partition again when partition consumer fails, but number of attempts is not limited.
+// Panics if cannot create an instance (client, producer and/or consumer).
 func NewMessageBroker(addrs []string, cfg *sarama.Config, opts ...cb.Option) *MessageBroker {
-	consumer, err := new(cb.DefaultCircuitBreaker).Execute(func() (interface{}, error) {
+	if cfg == nil {
+		cfg = sarama.NewConfig()
+		cfg.Producer.Return.Successes = true
+	}
+
+	client, err := new(cb.RetryPolicy).Execute(func() (interface{}, error) {
 		logger.Log().InfoWithFields(logger.Fields{
 			"addrs":     addrs,
 			"component": componentName,
-		}, "Creating Kafka consumer")
+		}, "Creating Kafka client")
 
-		return sarama.NewConsumer(addrs, cfg)
+		return sarama.NewClient(addrs, cfg)
 	}, opts...)
 
 	if err != nil {
@@ -48,18 +107,21 @@ func NewMessageBroker(addrs []string, cfg *sarama.Config, opts ...cb.Option) *Me
 			"error":     err,
 			"addrs":     addrs,
 			"component": componentName,
-		}, "Cannot create Kafka consumer")
+		}, "Cannot create Kafka client")
 	}
 
-	producer, err := new(cb.DefaultCircuitBreaker).Execute(func() (interface{}, error) {
-		logger.Log().InfoWithFields(logger.Fields{
+	c := client.(sarama.Client)
+
+	consumer, err := sarama.NewConsumerFromClient(c)
+	if err != nil {
+		logger.Log().PanicWithFields(logger.Fields{
+			"error":     err,
 			"addrs":     addrs,
 			"component": componentName,
-		}, "Creating Kafka producer")
-
-		return sarama.NewSyncProducer(addrs, cfg)
-	}, opts...)
+		}, "Cannot create Kafka consumer")
+	}
 
+	producer, err := sarama.NewSyncProducerFromClient(c)
 	if err != nil {
 		logger.Log().PanicWithFields(logger.Fields{
 			"error":     err,
@@ -73,48 +135,52 @@ func NewMessageBroker(addrs []string, cfg *sarama.Config, opts ...cb.Option) *Me
 		"component": componentName,
 	}, "Connected to Kafka broker")
 
-	return &MessageBroker{
-		Consumer: consumer.(sarama.Consumer),
-		Producer: producer.(sarama.SyncProducer),
+	ctx, cancel := context.WithCancel(context.Background())
+
+	b := &MessageBroker{
+		Client:   c,
+		Consumer: consumer,
+		Producer: producer,
+		addrs:    addrs,
+		opts:     opts,
+		monitor:  broker.NewConnectionMonitor(componentName),
+		ctx:      ctx,
+		cancel:   cancel,
 	}
+
+	b.supervisor.Add(1)
+	go b.supervise()
+
+	return b
 }
 
-// PublishMessage publishes message to Kafka broker.
-func (b MessageBroker) PublishMessage(ctx context.Context, m broker.Message) error {
+// PublishMessage publishes message to Kafka broker. Message key is taken from message context (Key) and selects partition.
+// In asynchronous publish mode it returns as soon as message is buffered (see EnableAsync).
+// Delayed messages (see broker.PublishAt) are not supported - ErrDelayNotSupported is returned if message is not due yet.
+func (b *MessageBroker) PublishMessage(ctx context.Context, m broker.Message) error {
 	logger.Log().InfoWithFields(logger.Fields{
 		"message":   m,
 		"component": componentName,
 	}, "Publishing message")
 
+	b.pmu.RLock()
+	defer b.pmu.RUnlock()
+
 	if b.Producer == nil {
 		logger.Log().ErrorWithFields(logger.Fields{"component": componentName}, "Not connected to Kafka broker")
 
 		return fmt.Errorf("[%s]: Not connected to Kafka server. Please check logs and network connection", componentName)
 	}
 
-	if m.Topic == "" {
-		logger.Log().ErrorWithFields(logger.Fields{"component": componentName}, "Cannot publish message - message topic cannot be empty")
-
-		return fmt.Errorf("[%s]: Cannot publish message - message topic cannot be empty", componentName)
-	}
-
-	body, err := json.Marshal(m.Value)
+	msg, err := producerMessage(m)
 	if err != nil {
-		logger.Log().ErrorWithFields(logger.Fields{
-			"error":     err,
-			"message":   m,
-			"component": componentName,
-		}, "Cannot parse message body")
-
 		return err
 	}
 
-	var key string
-	if k, ok := m.Context[Key]; ok {
-		key = k.(string)
+	if b.AsyncProducer != nil {
+		return b.enqueue(ctx, msg)
 	}
 
-	msg := &sarama.ProducerMessage{Topic: m.Topic, Key: sarama.StringEncoder(key), Value: sarama.StringEncoder(body)}
 	partition, offset, err := b.Producer.SendMessage(msg)
 
 	if err != nil {
@@ -123,7 +189,7 @@ func (b MessageBroker) PublishMessage(ctx context.Context, m broker.Message) err
 			"component": componentName,
 			"topic":     m.Topic,
 			"value":     m.Value,
-			"key":       key,
+			"key":       msg.Key,
 		}, "Cannot publish message")
 
 		return err
@@ -131,7 +197,7 @@ func (b MessageBroker) PublishMessage(ctx context.Context, m broker.Message) err
 
 	logger.Log().InfoWithFields(logger.Fields{
 		"component": componentName,
-		"key":       key,
+		"key":       msg.Key,
 		"topic":     m.Topic,
 		"partition": partition,
 		"offset":    offset,
@@ -141,9 +207,59 @@ func (b MessageBroker) PublishMessage(ctx context.Context, m broker.Message) err
 	return nil
 }
 
-// Subscribe subscribes to specified topic in Kafka broker.
-// Using context (ctx) parameter it is possible to pass additional arguments such as kafka.Partition (int32) and kafka.Offset (int64).
-func (b MessageBroker) Subscribe(ctx context.Context, topic string) (<-chan broker.Message, error) {
+// producerMessage creates Kafka producer message from broker message. Message is passed as metadata, so it can be
+// reported together with asynchronous delivery.
+func producerMessage(m broker.Message) (*sarama.ProducerMessage, error) {
+	if m.Topic == "" {
+		logger.Log().ErrorWithFields(logger.Fields{"component": componentName}, "Cannot publish message - message topic cannot be empty")
+
+		return nil, fmt.Errorf("[%s]: Cannot publish message - message topic cannot be empty", componentName)
+	}
+
+	if broker.Due(m) > 0 {
+		logger.Log().ErrorWithFields(logger.Fields{
+			"message":   m,
+			"component": componentName,
+		}, "Cannot publish message - delayed delivery is not supported")
+
+		return nil, ErrDelayNotSupported
+	}
+
+	m = broker.WithMessageID(m)
+
+	body, contentType, err := broker.Encode(m)
+	if err != nil {
+		logger.Log().ErrorWithFields(logger.Fields{
+			"error":     err,
+			"message":   m,
+			"component": componentName,
+		}, "Cannot parse message body")
+
+		return nil, err
+	}
+
+	var key string
+	if k, ok := m.Context[Key]; ok {
+		key = k.(string)
+	}
+
+	return &sarama.ProducerMessage{
+		Topic:    m.Topic,
+		Key:      sarama.StringEncoder(key),
+		Value:    sarama.ByteEncoder(body),
+		Headers:  headers(m.Context, contentType),
+		Metadata: &pending{message: m},
+	}, nil
+}
+
+// Subscribe subscribes to specified topic in Kafka broker. Subscription ends when context is done or broker is disposed -
+// underlying consumer is closed and returned channel is closed. Subscription errors are passed to broker.WithErrorHandler.
+// Using context (ctx) parameter it is possible to pass additional arguments such as kafka.Partition (int32), kafka.Offset (int64) and kafka.Group (string).
+// If kafka.Group is specified without kafka.Partition, subscription joins consumer group - partitions are assigned, rebalanced
+// and committed automatically and messages from all assigned partitions are merged into returned channel.
+// If context is created with broker.ManualAck, consumer group (kafka.Group) is required. Acknowledged offsets are committed for the group
+// and consuming starts from last committed offset unless kafka.Offset is specified.
+func (b *MessageBroker) Subscribe(ctx context.Context, topic string) (<-chan broker.Message, error) {
 	logger.Log().InfoWithFields(logger.Fields{
 		"topic":     topic,
 		"component": componentName,
@@ -161,6 +277,10 @@ func (b MessageBroker) Subscribe(ctx context.Context, topic string) (<-chan brok
 		return nil, fmt.Errorf("[%s]: Cannot subscribe to messages - message topic cannot be empty", componentName)
 	}
 
+	if group, _ := ctx.Value(Group).(string); group != "" && ctx.Value(Partition) == nil {
+		return b.subscribeGroup(ctx, group, topic)
+	}
+
 	var partition int32
 	if p := ctx.Value(Partition); p != nil {
 		partition = p.(int32)
@@ -171,6 +291,19 @@ func (b MessageBroker) Subscribe(ctx context.Context, topic string) (<-chan brok
 		offset = o.(int64)
 	}
 
+	var pom sarama.PartitionOffsetManager
+	var om sarama.OffsetManager
+	if broker.IsManualAck(ctx) {
+		var err error
+		if om, pom, err = b.managePartition(ctx, topic, partition); err != nil {
+			return nil, err
+		}
+
+		if ctx.Value(Offset) == nil {
+			offset, _ = pom.NextOffset()
+		}
+	}
+
 	partitionConsumer, err := b.Consumer.ConsumePartition(topic, partition, offset)
 	if err != nil {
 		logger.Log().ErrorWithFields(logger.Fields{
@@ -180,42 +313,293 @@ func (b MessageBroker) Subscribe(ctx context.Context, topic string) (<-chan brok
 			"partition": partition,
 			"offset":    offset,
 		}, "Cannot consume message")
+
+		if om != nil {
+			pom.Close()
+			om.Close()
+		}
+		return nil, err
 	}
 
+	ctx, done := b.subscription(ctx)
 	mgs := make(chan broker.Message)
 
 	go func() {
+		defer done()
+		defer close(mgs)
+		defer func() {
+			if partitionConsumer != nil {
+				partitionConsumer.Close()
+			}
+
+			// partition offset manager must be closed before offset manager
+			if om != nil {
+				pom.Close()
+				om.Close()
+			}
+		}()
+
+		next := offset
 		for {
-			select {
-			case msg := <-partitionConsumer.Messages():
-				mgs <- broker.Message{
-					Topic: msg.Topic,
-					Value: string(msg.Value),
-					Context: map[string]interface{}{
-						Key:       msg.Topic,
-						Offset:    msg.Offset,
-						Partition: msg.Partition,
-						Timestamp: msg.Timestamp,
-					},
+			err := deliver(ctx, partitionConsumer, pom, mgs, &next)
+			partitionConsumer.Close()
+			partitionConsumer = nil
+
+			if err == nil {
+				logger.Log().InfoWithFields(logger.Fields{
+					"topic":     topic,
+					"partition": partition,
+					"component": componentName,
+				}, "Subscription cancelled")
+				return
+			}
+
+			logger.Log().ErrorWithFields(logger.Fields{
+				"error":     err,
+				"component": componentName,
+			}, "Subscription failed")
+
+			broker.HandleError(ctx, err)
+
+			// not acknowledged messages are consumed again
+			if pom != nil {
+				next, _ = pom.NextOffset()
+			}
+
+			if partitionConsumer, err = b.consumePartition(ctx, topic, partition, next); err != nil {
+				if ctx.Err() == nil {
+					broker.HandleError(ctx, err)
 				}
+				return
 			}
+
+			logger.Log().InfoWithFields(logger.Fields{
+				"topic":     topic,
+				"partition": partition,
+				"offset":    next,
+				"component": componentName,
+			}, "Subscription re-established")
 		}
 	}()
 
 	return mgs, nil
 }
 
-// Dispose closes Kafka client instance.
+// deliver passes messages consumed from partition to subscriber until context is done (nil is returned) or message stream
+// is closed. Offset of next message is stored in next.
+func deliver(ctx context.Context, pc sarama.PartitionConsumer, pom sarama.PartitionOffsetManager, mgs chan<- broker.Message, next *int64) error {
+	errors := pc.Errors()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err, ok := <-errors:
+			if !ok {
+				// closed channel is not selected again
+				errors = nil
+				continue
+			}
+
+			logger.Log().ErrorWithFields(logger.Fields{
+				"error":     err,
+				"topic":     err.Topic,
+				"partition": err.Partition,
+				"component": componentName,
+			}, "Cannot consume message")
+
+			broker.HandleError(ctx, err)
+		case msg, ok := <-pc.Messages():
+			if !ok {
+				return fmt.Errorf("[%s]: Message stream was closed", componentName)
+			}
+
+			m := newMessage(msg)
+
+			if pom != nil {
+				m.Acknowledger = acknowledger{pom: pom, offset: msg.Offset}
+			}
+
+			select {
+			case mgs <- m:
+				*next = msg.Offset + 1
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	}
+}
+
+// consumePartition consumes partition again from offset. Attempts are retried with backoff until context is done or
+// offset is out of range.
+func (b *MessageBroker) consumePartition(ctx context.Context, topic string, partition int32, offset int64) (sarama.PartitionConsumer, error) {
+	opts := append(append([]cb.Option{}, b.opts...), cb.Retry(math.MaxInt32), cb.RetryIf(func(err error) bool {
+		return err != sarama.ErrOffsetOutOfRange
+	}))
+
+	pc, err := new(cb.RetryPolicy).ExecuteContext(ctx, func() (interface{}, error) {
+		logger.Log().InfoWithFields(logger.Fields{
+			"topic":     topic,
+			"partition": partition,
+			"offset":    offset,
+			"component": componentName,
+		}, "Consuming partition again")
+
+		return b.Consumer.ConsumePartition(topic, partition, offset)
+	}, opts...)
+
+	if err != nil {
+		logger.Log().ErrorWithFields(logger.Fields{
+			"error":     err,
+			"topic":     topic,
+			"partition": partition,
+			"offset":    offset,
+			"component": componentName,
+		}, "Cannot consume partition")
+
+		return nil, err
+	}
+
+	return pc.(sarama.PartitionConsumer), nil
+}
+
+// subscription registers subscription which is cancelled when broker is disposed.
+// Returned context is cancelled on Dispose and returned function must be called when subscription ends.
+func (b *MessageBroker) subscription(ctx context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	b.mu.Lock()
+	if b.subscriptions == nil {
+		b.subscriptions = make(map[int]context.CancelFunc)
+	}
+	id := b.nextID
+	b.nextID++
+	b.subscriptions[id] = cancel
+	b.wg.Add(1)
+	b.mu.Unlock()
+
+	return ctx, func() {
+		cancel()
+
+		b.mu.Lock()
+		delete(b.subscriptions, id)
+		b.mu.Unlock()
+
+		b.wg.Done()
+	}
+}
+
+func newMessage(msg *sarama.ConsumerMessage) broker.Message {
+	context := map[string]interface{}{}
+	for _, h := range msg.Headers {
+		if h != nil {
+			context[string(h.Key)] = string(h.Value)
+		}
+	}
+
+	context[Key] = string(msg.Key)
+	context[Offset] = msg.Offset
+	context[Partition] = msg.Partition
+	context[Timestamp] = msg.Timestamp
+
+	return broker.Message{
+		Topic:   msg.Topic,
+		Value:   msg.Value,
+		Context: context,
+	}
+}
+
+// headers converts message context and content type to Kafka record headers (requires Kafka version 0.11 or newer to be set in client configuration).
+// Kafka specific context values such as kafka.Key or kafka.Offset are not passed as headers.
+func headers(context broker.MessageContext, contentType string) []sarama.RecordHeader {
+	headers := []sarama.RecordHeader{{Key: []byte(broker.ContentTypeKey), Value: []byte(contentType)}}
+	for k, v := range context {
+		switch k {
+		case Key, Offset, Partition, Timestamp, broker.ContentTypeKey:
+			continue
+		}
+		headers = append(headers, sarama.RecordHeader{Key: []byte(k), Value: []byte(fmt.Sprint(v))})
+	}
+	return headers
+}
+
+func (b *MessageBroker) managePartition(ctx context.Context, topic string, partition int32) (sarama.OffsetManager, sarama.PartitionOffsetManager, error) {
+	group, _ := ctx.Value(Group).(string)
+	if group == "" {
+		logger.Log().ErrorWithFields(logger.Fields{"component": componentName}, "Cannot subscribe to messages - consumer group is required for manual acknowledgement")
+
+		return nil, nil, fmt.Errorf("[%s]: Cannot subscribe to messages - consumer group is required for manual acknowledgement", componentName)
+	}
+
+	om, err := sarama.NewOffsetManagerFromClient(group, b.Client)
+	if err != nil {
+		logger.Log().ErrorWithFields(logger.Fields{
+			"error":     err,
+			"group":     group,
+			"component": componentName,
+		}, "Cannot create offset manager")
+
+		return nil, nil, err
+	}
+
+	pom, err := om.ManagePartition(topic, partition)
+	if err != nil {
+		logger.Log().ErrorWithFields(logger.Fields{
+			"error":     err,
+			"group":     group,
+			"topic":     topic,
+			"partition": partition,
+			"component": componentName,
+		}, "Cannot manage partition offsets")
+
+		om.Close()
+		return nil, nil, err
+	}
+
+	return om, pom, nil
+}
+
+// Dispose cancels all subscriptions and closes Kafka client instance.
 func (b *MessageBroker) Dispose() {
 	logger.Log().InfoWithFields(logger.Fields{"component": componentName}, "Disposing message broker component")
 
+	if b.cancel != nil {
+		b.cancel()
+	}
+	b.supervisor.Wait()
+
+	b.mu.Lock()
+	for _, cancel := range b.subscriptions {
+		cancel()
+	}
+	b.mu.Unlock()
+
+	// partition consumers must be closed before consumer
+	b.wg.Wait()
+
 	if b.Consumer != nil {
 		b.Consumer.Close()
 		b.Consumer = nil
 	}
 
+	b.pmu.Lock()
+	if b.AsyncProducer != nil {
+		// buffered messages are flushed before delivery reports are closed
+		b.AsyncProducer.AsyncClose()
+		b.deliveries.Wait()
+		b.AsyncProducer = nil
+
+		b.asyncClient.Close()
+		b.asyncClient = nil
+	}
+
 	if b.Producer != nil {
 		b.Producer.Close()
 		b.Producer = nil
 	}
+	b.pmu.Unlock()
+
+	if b.Client != nil {
+		b.Client.Close()
+		b.Client = nil
+	}
 }
@@ -60,7 +60,7 @@ func TestPublishSubscribe(t *testing.T) {
 
 			var payload TestPayload
 
-			err := json.Unmarshal([]byte(msg.Value.(string)), &payload)
+			err := json.Unmarshal(msg.Value.([]byte), &payload)
 			assert.NoError(t, err, "Unmarshal returned an error")
 
 			assert.Equal(t, text, payload.Text)
@@ -120,6 +120,21 @@ func TestPublishSubscribeEmptyTopic(t *testing.T) {
 	assert.Error(t, err, "Subscribe should return an error")
 }
 
+func TestPublishDelayedMessage(t *testing.T) {
+	brokerAddr := "localhost:9092"
+
+	b := kafka.NewMessageBroker([]string{brokerAddr}, nil)
+	defer b.Dispose()
+
+	m := broker.Delay(broker.Message{Topic: "TestTopic", Value: "TestValue"}, time.Minute)
+
+	err := b.PublishMessage(context.Background(), m)
+	assert.Equal(t, kafka.ErrDelayNotSupported, err)
+
+	err = b.PublishMessages(context.Background(), []broker.Message{m})
+	assert.Equal(t, kafka.ErrDelayNotSupported, err)
+}
+
 func TestBrokenConnection(t *testing.T) {
 	addr, _ := quark.GetHostAddress(1234)
 
@@ -168,3 +183,185 @@ func TestBrokenNetworkConnection(t *testing.T) {
 		defer ts.Dispose()
 	})
 }
+
+func TestSubscribeManualAck(t *testing.T) {
+	topic := "TestManualAckTopic"
+
+	b := kafka.NewMessageBroker([]string{"localhost:9092"}, nil)
+	defer b.Dispose()
+
+	// consumer group is required to commit offsets
+	_, err := b.Subscribe(broker.ManualAck(context.Background()), topic)
+	assert.Error(t, err, "Subscribe should return an error")
+
+	ctx := context.WithValue(broker.ManualAck(context.Background()), kafka.Group, "TestGroup")
+	messages, err := b.Subscribe(ctx, topic)
+	assert.NoError(t, err, "Subscribe returned an error")
+
+	time.Sleep(1 * time.Second)
+
+	err = b.PublishMessage(context.Background(), broker.Message{Topic: topic, Value: &TestPayload{Text: "Test"}})
+	assert.NoError(t, err, "Publish returned an error")
+
+	msg := <-messages
+	assert.NotNil(t, msg.Acknowledger, "Message should have acknowledgement handle")
+	assert.Equal(t, kafka.ErrRequeueNotSupported, msg.Nack(true))
+	assert.NoError(t, msg.Ack(), "Ack returned an error")
+}
+
+func TestSubscribeConsumerGroup(t *testing.T) {
+	topic := "TestGroupTopic"
+	text := "This is a test message"
+
+	cfg := sarama.NewConfig()
+	cfg.Version = sarama.V0_10_2_0
+	cfg.Producer.Return.Successes = true
+	cfg.Consumer.Offsets.Initial = sarama.OffsetOldest
+
+	b := kafka.NewMessageBroker([]string{"localhost:9092"}, cfg)
+	defer b.Dispose()
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), kafka.Group, "TestGroup"))
+	defer cancel()
+
+	messages, err := b.Subscribe(ctx, topic)
+	assert.NoError(t, err, "Subscribe returned an error")
+
+	err = b.PublishMessage(context.Background(), broker.Message{Topic: topic, Value: &TestPayload{Text: text}})
+	assert.NoError(t, err, "Publish returned an error")
+
+	msg := <-messages
+	assert.Equal(t, topic, msg.Topic)
+
+	var payload TestPayload
+	err = json.Unmarshal(msg.Value.([]byte), &payload)
+	assert.NoError(t, err, "Unmarshal returned an error")
+	assert.Equal(t, text, payload.Text)
+
+	cancel()
+
+	// channel is closed when subscription context is done
+	for range messages {
+	}
+}
+
+func TestSubscriptionCancellation(t *testing.T) {
+	topic := "TestCancellationTopic"
+
+	b := kafka.NewMessageBroker([]string{"localhost:9092"}, nil)
+	defer b.Dispose()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	messages, err := b.Subscribe(ctx, topic)
+	assert.NoError(t, err, "Subscribe returned an error")
+
+	cancel()
+
+	for range messages {
+	}
+
+	// partition can be consumed again after previous consumer is closed
+	messages, err = b.Subscribe(context.Background(), topic)
+	assert.NoError(t, err, "Subscribe returned an error")
+
+	b.Dispose()
+
+	_, ok := <-messages
+	assert.False(t, ok, "Channel should be closed")
+}
+
+func TestMessageContextHeaders(t *testing.T) {
+	topic := "TestHeadersTopic"
+	key, value := "TestKey", "TestValue"
+
+	// record headers require Kafka version 0.11 or newer
+	cfg := sarama.NewConfig()
+	cfg.Version = sarama.V0_11_0_0
+	cfg.Producer.Return.Successes = true
+	cfg.Consumer.Offsets.Initial = sarama.OffsetOldest
+
+	b := kafka.NewMessageBroker([]string{"localhost:9092"}, cfg)
+	defer b.Dispose()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	messages, err := b.Subscribe(ctx, topic)
+	assert.NoError(t, err, "Subscribe returned an error")
+
+	err = b.PublishMessage(context.Background(), broker.Message{
+		Topic:   topic,
+		Value:   &TestPayload{Text: "Test"},
+		Context: broker.MessageContext{key: value, kafka.Key: "TestMessageKey"},
+	})
+	assert.NoError(t, err, "Publish returned an error")
+
+	msg := <-messages
+	assert.Equal(t, value, msg.Context[key])
+	assert.Equal(t, "TestMessageKey", msg.Context[kafka.Key])
+	assert.Equal(t, broker.ContentTypeJSON, msg.Context[broker.ContentTypeKey])
+
+	var payload TestPayload
+	err = broker.Decode(msg, &payload)
+	assert.NoError(t, err, "Decode returned an error")
+	assert.Equal(t, "Test", payload.Text)
+}
+
+func TestAsyncPublish(t *testing.T) {
+	topic := "TestAsyncTopic"
+
+	b := kafka.NewMessageBroker([]string{"localhost:9092"}, nil)
+	defer b.Dispose()
+
+	deliveries := make(chan kafka.Delivery, 10)
+
+	err := b.EnableAsync(kafka.BatchSize(5), kafka.Linger(100*time.Millisecond), kafka.OnDelivery(func(d kafka.Delivery) {
+		deliveries <- d
+	}))
+	assert.NoError(t, err, "EnableAsync returned an error")
+
+	err = b.EnableAsync()
+	assert.Error(t, err, "EnableAsync should return an error")
+
+	err = b.PublishMessage(context.Background(), broker.Message{
+		Topic:   topic,
+		Value:   &TestPayload{Text: "Test"},
+		Context: broker.MessageContext{kafka.Key: "TestKey"},
+	})
+	assert.NoError(t, err, "Publish returned an error")
+
+	d := <-deliveries
+	assert.NoError(t, d.Error)
+	assert.Equal(t, topic, d.Message.Topic)
+	assert.NotEmpty(t, broker.MessageID(d.Message))
+}
+
+func TestPublishMessages(t *testing.T) {
+	topic := "TestBatchTopic"
+
+	ms := []broker.Message{
+		{Topic: topic, Value: &TestPayload{Text: "Test1"}},
+		{Topic: topic, Value: &TestPayload{Text: "Test2"}},
+		{Topic: topic, Value: &TestPayload{Text: "Test3"}},
+	}
+
+	b := kafka.NewMessageBroker([]string{"localhost:9092"}, nil)
+	defer b.Dispose()
+
+	err := b.PublishMessages(context.Background(), ms)
+	assert.NoError(t, err, "PublishMessages returned an error")
+
+	delivered := 0
+	err = b.EnableAsync(kafka.OnDelivery(func(d kafka.Delivery) {
+		delivered++
+	}))
+	assert.NoError(t, err, "EnableAsync returned an error")
+
+	err = b.PublishMessages(context.Background(), ms)
+	assert.NoError(t, err, "PublishMessages returned an error")
+	assert.Equal(t, len(ms), delivered)
+
+	err = b.PublishMessages(context.Background(), []broker.Message{{Value: "TestValue"}})
+	assert.Error(t, err, "PublishMessages should return an error")
+}
@@ -0,0 +1,2 @@
+// Package memory provides in-memory message broker for tests and single-process deployments.
+package memory
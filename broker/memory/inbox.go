@@ -0,0 +1,67 @@
+package memory
+
+import (
+	"sync"
+	"time"
+)
+
+const purgeInterval = 1 * time.Minute
+
+// Inbox represents in-memory store of identifiers of processed messages (broker.Inbox implementation).
+// Expired identifiers are purged periodically when new identifiers are added.
+type Inbox struct {
+	mu        sync.Mutex
+	ids       map[string]time.Time // expiration time by message identifier
+	lastPurge time.Time            // time of last purge of expired identifiers
+}
+
+// NewInbox creates instance of in-memory inbox.
+func NewInbox() *Inbox {
+	return &Inbox{
+		ids:       make(map[string]time.Time),
+		lastPurge: time.Now(),
+	}
+}
+
+// Add records message identifier for ttl. It returns false if identifier is already recorded and not expired.
+func (i *Inbox) Add(id string, ttl time.Duration) (bool, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(i.lastPurge) > purgeInterval {
+		i.purge(now)
+	}
+
+	if expires, ok := i.ids[id]; ok && expires.After(now) {
+		return false, nil
+	}
+
+	i.ids[id] = now.Add(ttl)
+	return true, nil
+}
+
+// Remove removes message identifier.
+func (i *Inbox) Remove(id string) error {
+	i.mu.Lock()
+	delete(i.ids, id)
+	i.mu.Unlock()
+
+	return nil
+}
+
+// Purge removes expired message identifiers.
+func (i *Inbox) Purge() {
+	i.mu.Lock()
+	i.purge(time.Now())
+	i.mu.Unlock()
+}
+
+func (i *Inbox) purge(now time.Time) {
+	for id, expires := range i.ids {
+		if !expires.After(now) {
+			delete(i.ids, id)
+		}
+	}
+	i.lastPurge = now
+}
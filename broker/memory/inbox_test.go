@@ -0,0 +1,40 @@
+package memory_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gkarlik/quark-go/broker/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInbox(t *testing.T) {
+	i := memory.NewInbox()
+
+	added, err := i.Add("TestID", time.Minute)
+	assert.NoError(t, err, "Add returned an error")
+	assert.True(t, added)
+
+	added, err = i.Add("TestID", time.Minute)
+	assert.NoError(t, err, "Add returned an error")
+	assert.False(t, added)
+
+	assert.NoError(t, i.Remove("TestID"), "Remove returned an error")
+
+	added, err = i.Add("TestID", time.Minute)
+	assert.NoError(t, err, "Add returned an error")
+	assert.True(t, added)
+}
+
+func TestInboxExpiration(t *testing.T) {
+	i := memory.NewInbox()
+
+	added, _ := i.Add("TestID", time.Millisecond)
+	assert.True(t, added)
+
+	time.Sleep(5 * time.Millisecond)
+	i.Purge()
+
+	added, _ = i.Add("TestID", time.Millisecond)
+	assert.True(t, added)
+}
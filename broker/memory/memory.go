@@ -0,0 +1,341 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/gkarlik/quark-go/broker"
+	"github.com/gkarlik/quark-go/logger"
+)
+
+const (
+	componentName     = "MemoryBroker"
+	defaultBufferSize = 100
+)
+
+// ErrDelayNotSupported is returned when delayed message (see broker.PublishAt) is published before it is due. Delayed messages
+// must be stored by scheduler until they are due (see gorm.Schedule).
+var ErrDelayNotSupported = fmt.Errorf("[%s]: Cannot publish message - delayed delivery is not supported by in-memory broker", componentName)
+
+// Option represents function which is used to apply in-memory message broker options.
+type Option func(*Options)
+
+// Options represents in-memory message broker options.
+type Options struct {
+	BufferSize int // size of subscriber channel buffer
+}
+
+// BufferSize allows to set size of subscriber channel buffer. Default size is 100 messages.
+func BufferSize(size int) Option {
+	return func(o *Options) {
+		o.BufferSize = size
+	}
+}
+
+type subscriber struct {
+	messages  chan broker.Message // subscriber channel
+	done      chan struct{}       // closed when subscription is cancelled
+	manualAck bool                // indicates if subscriber acknowledges messages manually
+	once      sync.Once
+
+	mu     sync.RWMutex // guards sending to subscriber channel against closing it
+	closed bool         // indicates if subscriber channel is closed
+
+	redeliveries sync.WaitGroup // pending redeliveries of rejected messages
+}
+
+func (s *subscriber) cancel() {
+	s.once.Do(func() {
+		close(s.done)
+	})
+}
+
+// send sends message to subscriber channel. It blocks if channel buffer is full until message is delivered, subscription
+// is cancelled, context is done or broker is disposed (disposed is closed).
+func (s *subscriber) send(ctx context.Context, m broker.Message, disposed <-chan struct{}) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return nil
+	}
+
+	select {
+	case s.messages <- m:
+	case <-s.done:
+	case <-disposed:
+		return fmt.Errorf("[%s]: Cannot publish message - message broker is disposed", componentName)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return nil
+}
+
+// redeliver sends rejected message to subscriber channel asynchronously - subscriber may be blocked on its own full channel.
+// Redelivery ends when message is delivered, subscription is cancelled or broker is disposed (disposed is closed).
+func (s *subscriber) redeliver(m broker.Message, disposed <-chan struct{}) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return
+	}
+	s.redeliveries.Add(1)
+
+	go func() {
+		defer s.redeliveries.Done()
+
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+
+		if s.closed {
+			return
+		}
+
+		select {
+		case s.messages <- m:
+		case <-s.done:
+		case <-disposed:
+		}
+	}()
+}
+
+// close cancels subscription, closes subscriber channel when pending sends are released and waits for pending redeliveries.
+func (s *subscriber) close() {
+	s.cancel()
+
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.messages)
+	}
+	s.mu.Unlock()
+
+	s.redeliveries.Wait()
+}
+
+// acknowledger acknowledges message delivered to in-memory subscriber. Rejected message can be redelivered to the same subscriber.
+type acknowledger struct {
+	broker     *MessageBroker // message broker
+	subscriber *subscriber    // message subscriber
+	message    broker.Message // delivered message
+}
+
+// Ack confirms that message was processed.
+func (a *acknowledger) Ack() error {
+	return nil
+}
+
+// Nack rejects message. If requeue is true message is redelivered to the subscriber.
+func (a *acknowledger) Nack(requeue bool) error {
+	if !requeue {
+		return nil
+	}
+
+	m := a.message
+	m.Acknowledger = a
+
+	a.subscriber.redeliver(m, a.broker.done)
+	return nil
+}
+
+// MessageBroker represents in-memory message broker. Every message is delivered to all subscribers of its topic (fan-out).
+// Message value is encoded with codec selected by message content type ([]byte) the same way as network message brokers do,
+// so the same handlers can be used.
+type MessageBroker struct {
+	Options Options // options
+
+	mu          sync.RWMutex
+	subscribers map[string][]*subscriber // subscribers by topic
+	done        chan struct{}            // closed when broker is disposed
+	disposed    bool                     // indicates if broker is disposed
+	disposeOnce sync.Once
+}
+
+// NewMessageBroker creates instance of in-memory message broker configured with options passed as arguments.
+func NewMessageBroker(opts ...Option) *MessageBroker {
+	options := Options{
+		BufferSize: defaultBufferSize,
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+
+	return &MessageBroker{
+		Options:     options,
+		subscribers: make(map[string][]*subscriber),
+		done:        make(chan struct{}),
+	}
+}
+
+// PublishMessage publishes message to all subscribers of message topic.
+// It blocks if subscriber channel buffer is full until message is delivered, context is done or broker is disposed.
+// Delayed messages (see broker.PublishAt) are not supported - ErrDelayNotSupported is returned if message is not due yet.
+func (b *MessageBroker) PublishMessage(ctx context.Context, m broker.Message) error {
+	logger.Log().InfoWithFields(logger.Fields{
+		"message":   m,
+		"component": componentName,
+	}, "Publishing message")
+
+	if m.Topic == "" {
+		logger.Log().ErrorWithFields(logger.Fields{"component": componentName}, "Cannot publish message - message topic cannot be empty")
+
+		return fmt.Errorf("[%s]: Cannot publish message - message topic cannot be empty", componentName)
+	}
+
+	if broker.Due(m) > 0 {
+		logger.Log().ErrorWithFields(logger.Fields{
+			"message":   m,
+			"component": componentName,
+		}, "Cannot publish message - delayed delivery is not supported")
+
+		return ErrDelayNotSupported
+	}
+
+	m = broker.WithMessageID(m)
+
+	body, contentType, err := broker.Encode(m)
+	if err != nil {
+		logger.Log().ErrorWithFields(logger.Fields{
+			"error":     err,
+			"message":   m,
+			"component": componentName,
+		}, "Cannot parse message body")
+
+		return err
+	}
+
+	// messages are sent without lock, so handlers blocked by publishing do not block subscribing
+	b.mu.RLock()
+	disposed := b.disposed
+	subs := append([]*subscriber(nil), b.subscribers[m.Topic]...)
+	b.mu.RUnlock()
+
+	if disposed {
+		logger.Log().ErrorWithFields(logger.Fields{"component": componentName}, "Message broker is disposed")
+
+		return fmt.Errorf("[%s]: Cannot publish message - message broker is disposed", componentName)
+	}
+
+	for _, s := range subs {
+		msg := broker.Message{
+			Topic:   m.Topic,
+			Value:   body,
+			Context: copyContext(m.Context),
+		}
+		msg.Context[broker.ContentTypeKey] = contentType
+
+		if s.manualAck {
+			msg.Acknowledger = &acknowledger{broker: b, subscriber: s, message: msg}
+		}
+
+		if err := s.send(ctx, msg, b.done); err != nil {
+			logger.Log().ErrorWithFields(logger.Fields{
+				"error":     err,
+				"topic":     m.Topic,
+				"component": componentName,
+			}, "Cannot publish message")
+
+			return err
+		}
+	}
+
+	logger.Log().InfoWithFields(logger.Fields{
+		"topic":     m.Topic,
+		"component": componentName,
+	}, "Message successfully published")
+
+	return nil
+}
+
+// Subscribe subscribes to specified topic. Returned channel is closed when context is done or broker is disposed.
+// If context is created with broker.ManualAck, messages rejected with Nack(true) are redelivered to the subscriber.
+func (b *MessageBroker) Subscribe(ctx context.Context, topic string) (<-chan broker.Message, error) {
+	logger.Log().InfoWithFields(logger.Fields{
+		"topic":     topic,
+		"component": componentName,
+	}, "Subscribing to messages with topic")
+
+	if topic == "" {
+		logger.Log().ErrorWithFields(logger.Fields{"component": componentName}, "Cannot subscribe to messages - message topic cannot be empty")
+
+		return nil, fmt.Errorf("[%s]: Cannot subscribe to messages - message topic cannot be empty", componentName)
+	}
+
+	s := &subscriber{
+		messages:  make(chan broker.Message, b.Options.BufferSize),
+		done:      make(chan struct{}),
+		manualAck: broker.IsManualAck(ctx),
+	}
+
+	b.mu.Lock()
+	if b.disposed {
+		b.mu.Unlock()
+
+		logger.Log().ErrorWithFields(logger.Fields{"component": componentName}, "Message broker is disposed")
+
+		return nil, fmt.Errorf("[%s]: Cannot subscribe to messages - message broker is disposed", componentName)
+	}
+	b.subscribers[topic] = append(b.subscribers[topic], s)
+	b.mu.Unlock()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			b.unsubscribe(topic, s)
+		case <-b.done:
+		}
+	}()
+
+	return s.messages, nil
+}
+
+func (b *MessageBroker) unsubscribe(topic string, s *subscriber) {
+	b.mu.Lock()
+	subs := b.subscribers[topic]
+	for i, sub := range subs {
+		if sub == s {
+			b.subscribers[topic] = append(subs[:i], subs[i+1:]...)
+			break
+		}
+	}
+
+	if len(b.subscribers[topic]) == 0 {
+		delete(b.subscribers, topic)
+	}
+	b.mu.Unlock()
+
+	// subscriber channel is closed without broker lock, publishers blocked on this subscriber are released first
+	s.close()
+}
+
+// Dispose closes all subscriber channels and cleans up in-memory message broker instance.
+func (b *MessageBroker) Dispose() {
+	logger.Log().InfoWithFields(logger.Fields{"component": componentName}, "Disposing message broker component")
+
+	b.disposeOnce.Do(func() {
+		// release publishers blocked on full subscriber channels
+		close(b.done)
+
+		b.mu.Lock()
+		subscribers := b.subscribers
+		b.subscribers = make(map[string][]*subscriber)
+		b.disposed = true
+		b.mu.Unlock()
+
+		for _, subs := range subscribers {
+			for _, s := range subs {
+				s.close()
+			}
+		}
+	})
+}
+
+func copyContext(c broker.MessageContext) broker.MessageContext {
+	ctx := make(broker.MessageContext, len(c))
+	for k, v := range c {
+		ctx[k] = v
+	}
+	return ctx
+}
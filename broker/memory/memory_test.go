@@ -0,0 +1,279 @@
+package memory_test
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gkarlik/quark-go"
+	"github.com/gkarlik/quark-go/broker"
+	"github.com/gkarlik/quark-go/broker/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+type TestService struct {
+	*quark.ServiceBase
+}
+
+type TestPayload struct {
+	Text string `json:"text"`
+}
+
+func TestPublishSubscribe(t *testing.T) {
+	topic := "TestTopic"
+	text := "This is a test message"
+	key, value := "TestKey", "TestValue"
+
+	addr, _ := quark.GetHostAddress(1234)
+
+	ts := &TestService{
+		ServiceBase: quark.NewService(
+			quark.Name("TestService"),
+			quark.Version("1.0"),
+			quark.Address(addr),
+			quark.Broker(memory.NewMessageBroker()),
+		),
+	}
+	defer ts.Dispose()
+
+	// two subscribers of the same topic - each should receive message
+	var subscriptions []<-chan broker.Message
+	for i := 0; i < 2; i++ {
+		messages, err := ts.Broker().Subscribe(context.Background(), topic)
+		assert.NoError(t, err, "Subscribe returned an error")
+
+		subscriptions = append(subscriptions, messages)
+	}
+
+	var wg sync.WaitGroup
+
+	wg.Add(len(subscriptions))
+	for _, messages := range subscriptions {
+		go func(messages <-chan broker.Message) {
+			msg := <-messages
+			assert.Equal(t, topic, msg.Topic)
+
+			var payload TestPayload
+			err := json.Unmarshal(msg.Value.([]byte), &payload)
+			assert.NoError(t, err, "Unmarshal returned an error")
+
+			assert.Equal(t, text, payload.Text)
+			assert.Equal(t, value, msg.Context[key])
+			assert.NotEmpty(t, broker.MessageID(msg))
+			wg.Done()
+		}(messages)
+	}
+
+	ctx := broker.MessageContext{}
+	ctx[key] = value
+
+	m := broker.Message{
+		Context: ctx,
+		Topic:   topic,
+		Value: &TestPayload{
+			Text: text,
+		},
+	}
+
+	err := ts.Broker().PublishMessage(context.Background(), m)
+	assert.NoError(t, err, "Publish returned an error")
+
+	wg.Wait()
+}
+
+func TestPublishSubscribeEmptyTopic(t *testing.T) {
+	b := memory.NewMessageBroker()
+	defer b.Dispose()
+
+	m := broker.Message{
+		Value: "TestValue",
+	}
+
+	err := b.PublishMessage(context.Background(), m)
+	assert.Error(t, err, "Publish should return an error")
+
+	_, err = b.Subscribe(context.Background(), "")
+	assert.Error(t, err, "Subscribe should return an error")
+}
+
+func TestPublishInvalidValue(t *testing.T) {
+	b := memory.NewMessageBroker()
+	defer b.Dispose()
+
+	err := b.PublishMessage(context.Background(), broker.Message{Topic: "TestTopic", Value: make(chan int)})
+	assert.Error(t, err, "Publish should return an error")
+}
+
+func TestPublishDelayedMessage(t *testing.T) {
+	topic := "TestTopic"
+
+	b := memory.NewMessageBroker()
+	defer b.Dispose()
+
+	messages, err := b.Subscribe(context.Background(), topic)
+	assert.NoError(t, err, "Subscribe returned an error")
+
+	err = b.PublishMessage(context.Background(), broker.Delay(broker.Message{Topic: topic, Value: 1}, time.Minute))
+	assert.Equal(t, memory.ErrDelayNotSupported, err)
+
+	// message which is already due is delivered immediately
+	err = b.PublishMessage(context.Background(), broker.Delay(broker.Message{Topic: topic, Value: 2}, -time.Minute))
+	assert.NoError(t, err, "Publish returned an error")
+
+	msg := <-messages
+	assert.Equal(t, []byte("2"), msg.Value)
+}
+
+func TestPublishFullBuffer(t *testing.T) {
+	topic := "TestTopic"
+
+	b := memory.NewMessageBroker(memory.BufferSize(1))
+	defer b.Dispose()
+
+	_, err := b.Subscribe(context.Background(), topic)
+	assert.NoError(t, err, "Subscribe returned an error")
+
+	err = b.PublishMessage(context.Background(), broker.Message{Topic: topic, Value: 1})
+	assert.NoError(t, err, "Publish returned an error")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	err = b.PublishMessage(ctx, broker.Message{Topic: topic, Value: 2})
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestPublishFromHandlerWhileSubscribing(t *testing.T) {
+	topic := "TestTopic"
+
+	b := memory.NewMessageBroker(memory.BufferSize(1))
+	defer b.Dispose()
+
+	messages, err := b.Subscribe(context.Background(), topic)
+	assert.NoError(t, err, "Subscribe returned an error")
+
+	// handler publishes message when it processes message
+	process := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		<-messages
+		<-process
+		done <- b.PublishMessage(context.Background(), broker.Message{Topic: "OtherTopic", Value: 3})
+	}()
+
+	for i := 0; i < 2; i++ {
+		err = b.PublishMessage(context.Background(), broker.Message{Topic: topic, Value: i})
+		assert.NoError(t, err, "Publish returned an error")
+	}
+
+	// publisher is blocked on full subscriber channel
+	go b.PublishMessage(context.Background(), broker.Message{Topic: topic, Value: 2})
+	time.Sleep(20 * time.Millisecond)
+
+	// subscriber is added while publisher is blocked
+	go b.Subscribe(context.Background(), "OtherTopic")
+	time.Sleep(20 * time.Millisecond)
+
+	close(process)
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err, "Publish returned an error")
+	case <-time.After(2 * time.Second):
+		assert.Fail(t, "Publish from handler should not be blocked")
+	}
+}
+
+func TestSubscriptionCancellation(t *testing.T) {
+	topic := "TestTopic"
+
+	b := memory.NewMessageBroker()
+	defer b.Dispose()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	messages, err := b.Subscribe(ctx, topic)
+	assert.NoError(t, err, "Subscribe returned an error")
+
+	cancel()
+
+	for range messages {
+	}
+
+	err = b.PublishMessage(context.Background(), broker.Message{Topic: topic, Value: 1})
+	assert.NoError(t, err, "Publish returned an error")
+}
+
+func TestDispose(t *testing.T) {
+	topic := "TestTopic"
+
+	b := memory.NewMessageBroker()
+
+	messages, err := b.Subscribe(context.Background(), topic)
+	assert.NoError(t, err, "Subscribe returned an error")
+
+	b.Dispose()
+	b.Dispose()
+
+	_, ok := <-messages
+	assert.False(t, ok, "Channel should be closed")
+
+	err = b.PublishMessage(context.Background(), broker.Message{Topic: topic, Value: 1})
+	assert.Error(t, err, "Publish should return an error")
+
+	_, err = b.Subscribe(context.Background(), topic)
+	assert.Error(t, err, "Subscribe should return an error")
+}
+
+func TestManualAck(t *testing.T) {
+	topic := "TestTopic"
+
+	b := memory.NewMessageBroker()
+	defer b.Dispose()
+
+	messages, err := b.Subscribe(broker.ManualAck(context.Background()), topic)
+	assert.NoError(t, err, "Subscribe returned an error")
+
+	err = b.PublishMessage(context.Background(), broker.Message{Topic: topic, Value: 1})
+	assert.NoError(t, err, "Publish returned an error")
+
+	msg := <-messages
+	assert.NotNil(t, msg.Acknowledger, "Message should have acknowledgement handle")
+	assert.NoError(t, msg.Nack(true), "Nack returned an error")
+
+	redelivered := <-messages
+	assert.Equal(t, msg.Value, redelivered.Value)
+	assert.NotNil(t, redelivered.Acknowledger, "Redelivered message should have acknowledgement handle")
+	assert.NoError(t, redelivered.Ack(), "Ack returned an error")
+}
+
+func TestManualAckRedeliveryAfterDispose(t *testing.T) {
+	topic := "TestTopic"
+
+	b := memory.NewMessageBroker(memory.BufferSize(1))
+
+	messages, err := b.Subscribe(broker.ManualAck(context.Background()), topic)
+	assert.NoError(t, err, "Subscribe returned an error")
+
+	err = b.PublishMessage(context.Background(), broker.Message{Topic: topic, Value: 1})
+	assert.NoError(t, err, "Publish returned an error")
+
+	msg := <-messages
+
+	err = b.PublishMessage(context.Background(), broker.Message{Topic: topic, Value: 2})
+	assert.NoError(t, err, "Publish returned an error")
+
+	// redelivery is blocked by full subscriber channel until broker is disposed
+	assert.NoError(t, msg.Nack(true), "Nack returned an error")
+
+	b.Dispose()
+
+	<-messages
+	_, ok := <-messages
+	assert.False(t, ok, "Channel should be closed")
+
+	// message rejected after broker is disposed is not redelivered
+	assert.NoError(t, msg.Nack(true), "Nack returned an error")
+}
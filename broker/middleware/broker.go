@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"context"
+
+	"github.com/gkarlik/quark-go/broker"
+	"github.com/gkarlik/quark-go/metrics"
+)
+
+// MessageBroker represents next message broker decorated by middleware. It is embedded by middleware decorators, so optional
+// interfaces of next message broker (broker.BatchPublisher and broker.ConnectionReporter) are not hidden by decorator.
+type MessageBroker struct {
+	broker.MessageBroker // next message broker
+}
+
+// PublishMessages publishes batch of messages using next message broker (one by one if it is not broker.BatchPublisher).
+func (b MessageBroker) PublishMessages(ctx context.Context, messages []broker.Message) error {
+	return broker.PublishMessages(ctx, b.MessageBroker, messages)
+}
+
+// State returns connection state of next message broker.
+func (b MessageBroker) State() broker.ConnectionState {
+	return broker.State(b.MessageBroker)
+}
+
+// ExposeMetrics exposes connection metrics of next message broker.
+func (b MessageBroker) ExposeMetrics(m metrics.Exposer) {
+	broker.ExposeConnectionMetrics(b.MessageBroker, m)
+}
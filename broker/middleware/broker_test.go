@@ -0,0 +1,70 @@
+package middleware_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gkarlik/quark-go/broker"
+	"github.com/gkarlik/quark-go/broker/memory"
+	"github.com/gkarlik/quark-go/broker/middleware"
+	"github.com/gkarlik/quark-go/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestBroker reports disconnected connection and counts published batches.
+type TestBroker struct {
+	broker.MessageBroker
+
+	batches int
+	exposed bool
+}
+
+func (b *TestBroker) PublishMessages(ctx context.Context, ms []broker.Message) error {
+	b.batches++
+	return nil
+}
+
+func (b *TestBroker) State() broker.ConnectionState {
+	return broker.Disconnected
+}
+
+func (b *TestBroker) ExposeMetrics(m metrics.Exposer) {
+	b.exposed = true
+}
+
+func TestMessageBroker(t *testing.T) {
+	tb := &TestBroker{MessageBroker: memory.NewMessageBroker()}
+	defer tb.Dispose()
+
+	b := middleware.MessageBroker{MessageBroker: tb}
+
+	assert.Equal(t, broker.Disconnected, broker.State(b))
+
+	broker.ExposeConnectionMetrics(b, nil)
+	assert.True(t, tb.exposed)
+
+	err := broker.PublishMessages(context.Background(), b, []broker.Message{{Topic: "TestTopic"}, {Topic: "TestTopic"}})
+	assert.NoError(t, err, "PublishMessages returned an error")
+	assert.Equal(t, 1, tb.batches)
+}
+
+func TestMessageBrokerFallback(t *testing.T) {
+	topic := "TestTopic"
+
+	b := middleware.MessageBroker{MessageBroker: memory.NewMessageBroker()}
+	defer b.Dispose()
+
+	assert.Equal(t, broker.Connected, broker.State(b))
+
+	messages, err := b.Subscribe(context.Background(), topic)
+	assert.NoError(t, err, "Subscribe returned an error")
+
+	go func() {
+		err := b.PublishMessages(context.Background(), []broker.Message{{Topic: topic, Value: "1"}, {Topic: topic, Value: "2"}})
+		assert.NoError(t, err, "PublishMessages returned an error")
+	}()
+
+	for i := 0; i < 2; i++ {
+		<-messages
+	}
+}
@@ -0,0 +1,2 @@
+// Package middleware provides middlewares which decorate message broker.
+package middleware
@@ -0,0 +1,2 @@
+// Package logging provides middleware for message logging.
+package logging
@@ -0,0 +1,130 @@
+package logging
+
+import (
+	"context"
+	"time"
+
+	"github.com/gkarlik/quark-go/broker"
+	"github.com/gkarlik/quark-go/broker/middleware"
+	"github.com/gkarlik/quark-go/logger"
+)
+
+const componentName = "MessageLoggingMiddleware"
+
+// Middleware is responsible for logging information about messages published and consumed by message broker.
+type Middleware struct{}
+
+// NewMessageLoggingMiddleware creates instance of Message Logging Middleware.
+func NewMessageLoggingMiddleware() *Middleware {
+	return &Middleware{}
+}
+
+// Handle returns message broker which logs messages published and consumed by next message broker.
+// Batch publishing and connection state of next message broker are passed through (see middleware.MessageBroker).
+func (m Middleware) Handle(next broker.MessageBroker) broker.MessageBroker {
+	return &messageBroker{
+		MessageBroker: middleware.MessageBroker{MessageBroker: next},
+	}
+}
+
+// messageBroker represents message broker decorated with logging.
+type messageBroker struct {
+	middleware.MessageBroker
+}
+
+// PublishMessage logs published message together with publish time and error. Message identifier is assigned before
+// message is published, so it can be correlated with consumed message.
+func (b *messageBroker) PublishMessage(ctx context.Context, m broker.Message) error {
+	m = broker.WithMessageID(m)
+
+	start := time.Now()
+	err := b.MessageBroker.PublishMessage(ctx, m)
+
+	logPublished(m, time.Since(start), err)
+
+	return err
+}
+
+// PublishMessages logs each message of published batch together with publish time of the batch and error.
+func (b *messageBroker) PublishMessages(ctx context.Context, ms []broker.Message) error {
+	batch := make([]broker.Message, len(ms))
+	for i, m := range ms {
+		batch[i] = broker.WithMessageID(m)
+	}
+
+	start := time.Now()
+	err := b.MessageBroker.PublishMessages(ctx, batch)
+
+	d := time.Since(start)
+	for _, m := range batch {
+		logPublished(m, d, err)
+	}
+
+	return err
+}
+
+func logPublished(m broker.Message, d time.Duration, err error) {
+	fields := logger.Fields{
+		"topic":     m.Topic,
+		"id":        broker.MessageID(m),
+		"context":   m.Context,
+		"duration":  d,
+		"component": componentName,
+	}
+
+	if err != nil {
+		fields["error"] = err
+		logger.Log().ErrorWithFields(fields, "Cannot publish message")
+
+		return
+	}
+
+	logger.Log().DebugWithFields(fields, "Message published")
+}
+
+// Subscribe logs subscription and each consumed message.
+func (b *messageBroker) Subscribe(ctx context.Context, topic string) (<-chan broker.Message, error) {
+	messages, err := b.MessageBroker.Subscribe(ctx, topic)
+	if err != nil {
+		logger.Log().ErrorWithFields(logger.Fields{
+			"error":     err,
+			"topic":     topic,
+			"component": componentName,
+		}, "Cannot subscribe to messages")
+
+		return nil, err
+	}
+
+	logger.Log().DebugWithFields(logger.Fields{
+		"topic":     topic,
+		"component": componentName,
+	}, "Subscribed to messages")
+
+	mgs := make(chan broker.Message)
+
+	go func() {
+		defer close(mgs)
+
+		for m := range messages {
+			logger.Log().DebugWithFields(logger.Fields{
+				"topic":     m.Topic,
+				"id":        broker.MessageID(m),
+				"context":   m.Context,
+				"component": componentName,
+			}, "Message consumed")
+
+			select {
+			case mgs <- m:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		logger.Log().DebugWithFields(logger.Fields{
+			"topic":     topic,
+			"component": componentName,
+		}, "Subscription closed")
+	}()
+
+	return mgs, nil
+}
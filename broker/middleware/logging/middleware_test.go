@@ -0,0 +1,44 @@
+package logging_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gkarlik/quark-go/broker"
+	"github.com/gkarlik/quark-go/broker/memory"
+	"github.com/gkarlik/quark-go/broker/middleware/logging"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoggingMiddleware(t *testing.T) {
+	topic := "TestTopic"
+
+	b := logging.NewMessageLoggingMiddleware().Handle(memory.NewMessageBroker())
+	defer b.Dispose()
+
+	messages, err := b.Subscribe(context.Background(), topic)
+	assert.NoError(t, err, "Subscribe returned an error")
+
+	err = b.PublishMessage(context.Background(), broker.Message{Topic: topic, Value: "TestValue"})
+	assert.NoError(t, err, "Publish returned an error")
+
+	m := <-messages
+	assert.NotEmpty(t, broker.MessageID(m))
+
+	// batch publishing and connection state of decorated broker are not hidden
+	assert.Equal(t, broker.Connected, broker.State(b))
+
+	go func() {
+		err := broker.PublishMessages(context.Background(), b, []broker.Message{{Topic: topic, Value: "TestValue"}})
+		assert.NoError(t, err, "PublishMessages returned an error")
+	}()
+
+	m = <-messages
+	assert.NotEmpty(t, broker.MessageID(m))
+
+	err = b.PublishMessage(context.Background(), broker.Message{Value: "TestValue"})
+	assert.Error(t, err, "Publish should return an error")
+
+	_, err = b.Subscribe(context.Background(), "")
+	assert.Error(t, err, "Subscribe should return an error")
+}
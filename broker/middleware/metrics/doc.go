@@ -0,0 +1,2 @@
+// Package metrics provides middleware for message metrics reporting.
+package metrics
@@ -0,0 +1,216 @@
+package metrics
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	quark "github.com/gkarlik/quark-go"
+	"github.com/gkarlik/quark-go/broker"
+	"github.com/gkarlik/quark-go/broker/middleware"
+	"github.com/gkarlik/quark-go/metrics"
+)
+
+const (
+	// PublishedAtKey defines message context key of time (RFC 3339 with nanoseconds) when message was published.
+	// It is used to report delivery time of consumed message.
+	PublishedAtKey = "published-at"
+
+	componentName = "MessageMetricsMiddleware"
+
+	publishedMetricName    = "messages_published"
+	publishedMetricDesc    = "Number of published messages"
+	publishErrorsName      = "message_publish_errors"
+	publishErrorsDesc      = "Number of messages which could not be published"
+	consumedMetricName     = "messages_consumed"
+	consumedMetricDesc     = "Number of consumed messages"
+	publishTimeMetricName  = "message_publish_time"
+	publishTimeMetricDesc  = "Message publish time in seconds"
+	deliveryTimeMetricName = "message_delivery_time"
+	deliveryTimeMetricDesc = "Time between message publishing and consumption in seconds"
+)
+
+var defaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Option represents function which is used to apply message metrics middleware options.
+type Option func(*Options)
+
+// Options represents message metrics middleware options.
+type Options struct {
+	Buckets []float64 // buckets of publish and delivery time histograms (in seconds)
+}
+
+// Buckets allows to set buckets of publish and delivery time histograms (in seconds).
+func Buckets(buckets []float64) Option {
+	return func(o *Options) {
+		o.Buckets = buckets
+	}
+}
+
+// topicMetrics represents metrics reported for the topic.
+type topicMetrics struct {
+	published    metrics.Counter   // number of published messages
+	errors       metrics.Counter   // number of publish errors
+	consumed     metrics.Counter   // number of consumed messages
+	publishTime  metrics.Histogram // message publish time
+	deliveryTime metrics.Histogram // time between publishing and consumption
+}
+
+// Middleware is responsible for reporting metrics of messages published and consumed by message broker.
+// Metrics are created per topic when the first message with the topic is published or consumed.
+type Middleware struct {
+	s    quark.Service // service
+	opts Options       // middleware options
+
+	mu     sync.Mutex
+	topics map[string]*topicMetrics
+}
+
+// NewMessageMetricsMiddleware creates instance of Message Metrics Middleware which uses service metrics exposer.
+func NewMessageMetricsMiddleware(s quark.Service, opts ...Option) *Middleware {
+	m := &Middleware{
+		s: s,
+		opts: Options{
+			Buckets: defaultBuckets,
+		},
+		topics: make(map[string]*topicMetrics),
+	}
+
+	for _, opt := range opts {
+		opt(&m.opts)
+	}
+
+	return m
+}
+
+// Handle returns message broker which reports metrics of messages published and consumed by next message broker.
+// Publish time is stored in context of published message (PublishedAtKey), so delivery time can be reported when message is consumed.
+// Batch publishing and connection state of next message broker are passed through (see middleware.MessageBroker).
+func (m *Middleware) Handle(next broker.MessageBroker) broker.MessageBroker {
+	return &messageBroker{
+		MessageBroker: middleware.MessageBroker{MessageBroker: next},
+		m:             m,
+	}
+}
+
+// metrics returns metrics of the topic, metrics are created if they do not exist.
+func (m *Middleware) metrics(topic string) *topicMetrics {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tm, ok := m.topics[topic]
+	if !ok {
+		mex := m.s.Metrics()
+
+		tm = &topicMetrics{
+			published:    mex.CreateCounter(broker.MetricName(publishedMetricName, topic), publishedMetricDesc),
+			errors:       mex.CreateCounter(broker.MetricName(publishErrorsName, topic), publishErrorsDesc),
+			consumed:     mex.CreateCounter(broker.MetricName(consumedMetricName, topic), consumedMetricDesc),
+			publishTime:  mex.CreateHistogram(broker.MetricName(publishTimeMetricName, topic), publishTimeMetricDesc, m.opts.Buckets),
+			deliveryTime: mex.CreateHistogram(broker.MetricName(deliveryTimeMetricName, topic), deliveryTimeMetricDesc, m.opts.Buckets),
+		}
+		m.topics[topic] = tm
+	}
+
+	return tm
+}
+
+// messageBroker represents message broker decorated with metrics reporting.
+type messageBroker struct {
+	middleware.MessageBroker
+
+	m *Middleware // middleware
+}
+
+// PublishMessage reports number of published messages, publish errors and publish time.
+func (b *messageBroker) PublishMessage(ctx context.Context, msg broker.Message) error {
+	if b.m.s.Metrics() == nil {
+		return b.MessageBroker.PublishMessage(ctx, msg)
+	}
+
+	start := time.Now()
+
+	err := b.MessageBroker.PublishMessage(ctx, published(msg, start))
+
+	b.m.metrics(msg.Topic).observe(time.Since(start), err)
+
+	return err
+}
+
+// PublishMessages reports number of published messages, publish errors and publish time (of the batch) for each message of the batch.
+func (b *messageBroker) PublishMessages(ctx context.Context, ms []broker.Message) error {
+	if b.m.s.Metrics() == nil {
+		return b.MessageBroker.PublishMessages(ctx, ms)
+	}
+
+	start := time.Now()
+
+	batch := make([]broker.Message, len(ms))
+	for i, msg := range ms {
+		batch[i] = published(msg, start)
+	}
+
+	err := b.MessageBroker.PublishMessages(ctx, batch)
+
+	d := time.Since(start)
+	for _, msg := range ms {
+		b.m.metrics(msg.Topic).observe(d, err)
+	}
+
+	return err
+}
+
+// published returns message with publish time stored in copy of message context.
+func published(msg broker.Message, t time.Time) broker.Message {
+	mc := make(broker.MessageContext, len(msg.Context)+1)
+	for k, v := range msg.Context {
+		mc[k] = v
+	}
+	mc[PublishedAtKey] = t.UTC().Format(time.RFC3339Nano)
+
+	msg.Context = mc
+	return msg
+}
+
+// observe reports publish time and result of published message.
+func (tm *topicMetrics) observe(d time.Duration, err error) {
+	tm.publishTime.Observe(d.Seconds())
+	if err != nil {
+		tm.errors.Inc()
+		return
+	}
+	tm.published.Inc()
+}
+
+// Subscribe reports number of consumed messages and their delivery time.
+func (b *messageBroker) Subscribe(ctx context.Context, topic string) (<-chan broker.Message, error) {
+	messages, err := b.MessageBroker.Subscribe(ctx, topic)
+	if err != nil || b.m.s.Metrics() == nil {
+		return messages, err
+	}
+
+	mgs := make(chan broker.Message)
+
+	go func() {
+		defer close(mgs)
+
+		for msg := range messages {
+			tm := b.m.metrics(msg.Topic)
+			tm.consumed.Inc()
+
+			if s, ok := msg.Context[PublishedAtKey].(string); ok {
+				if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+					tm.deliveryTime.Observe(time.Since(t).Seconds())
+				}
+			}
+
+			select {
+			case mgs <- msg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return mgs, nil
+}
@@ -0,0 +1,47 @@
+package metrics_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gkarlik/quark-go"
+	"github.com/gkarlik/quark-go/broker"
+	"github.com/gkarlik/quark-go/broker/memory"
+	"github.com/gkarlik/quark-go/broker/middleware/metrics"
+	"github.com/gkarlik/quark-go/metrics/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+type TestService struct {
+	*quark.ServiceBase
+}
+
+func TestMetricsMiddleware(t *testing.T) {
+	topic := "TestTopic.Metrics"
+
+	a, _ := quark.GetHostAddress(1234)
+
+	ts := &TestService{
+		ServiceBase: quark.NewService(
+			quark.Name("TestService"),
+			quark.Version("1.0"),
+			quark.Address(a),
+			quark.Metrics(prometheus.NewMetricsExposer())),
+	}
+	defer ts.Dispose()
+
+	b := metrics.NewMessageMetricsMiddleware(ts, metrics.Buckets([]float64{.1, 1})).Handle(memory.NewMessageBroker())
+	defer b.Dispose()
+
+	messages, err := b.Subscribe(context.Background(), topic)
+	assert.NoError(t, err, "Subscribe returned an error")
+
+	err = b.PublishMessage(context.Background(), broker.Message{Topic: topic, Value: "TestValue"})
+	assert.NoError(t, err, "Publish returned an error")
+
+	m := <-messages
+	assert.NotEmpty(t, m.Context[metrics.PublishedAtKey])
+
+	err = b.PublishMessage(context.Background(), broker.Message{Value: "TestValue"})
+	assert.Error(t, err, "Publish should return an error")
+}
@@ -0,0 +1,2 @@
+// Package tracing provides middleware for message tracing.
+package tracing
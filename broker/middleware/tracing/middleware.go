@@ -0,0 +1,157 @@
+package tracing
+
+import (
+	"context"
+
+	quark "github.com/gkarlik/quark-go"
+	"github.com/gkarlik/quark-go/broker"
+	"github.com/gkarlik/quark-go/broker/middleware"
+	"github.com/gkarlik/quark-go/logger"
+	"github.com/gkarlik/quark-go/service/trace"
+	opentracing "github.com/opentracing/opentracing-go"
+)
+
+const (
+	componentName     = "MessageTracingMiddleware"
+	publishSpanPrefix = "publish "
+	consumeSpanPrefix = "consume "
+)
+
+// Middleware is responsible for tracing messages published and consumed by message broker.
+type Middleware struct {
+	s quark.Service // service
+}
+
+// NewMessageTracingMiddleware creates instance of Message Tracing Middleware which uses service tracer.
+func NewMessageTracingMiddleware(s quark.Service) *Middleware {
+	return &Middleware{
+		s: s,
+	}
+}
+
+// Handle returns message broker which traces messages published and consumed by next message broker.
+// Published message gets span (child of span stored in context) injected into message context. Consumed message gets span
+// which continues span of the publisher, so handler can continue the trace with quark.StartMessageSpan.
+// Batch publishing and connection state of next message broker are passed through (see middleware.MessageBroker).
+func (m Middleware) Handle(next broker.MessageBroker) broker.MessageBroker {
+	return &messageBroker{
+		MessageBroker: middleware.MessageBroker{MessageBroker: next},
+		s:             m.s,
+	}
+}
+
+// messageBroker represents message broker decorated with tracing.
+type messageBroker struct {
+	middleware.MessageBroker
+
+	s quark.Service // service
+}
+
+// PublishMessage starts publish span and injects it into context of published message.
+func (b *messageBroker) PublishMessage(ctx context.Context, m broker.Message) error {
+	t := b.s.Tracer()
+	if t == nil {
+		return b.MessageBroker.PublishMessage(ctx, m)
+	}
+
+	span, ctx := t.StartSpanFromContext(ctx, publishSpanPrefix+m.Topic)
+	if span == nil {
+		return b.MessageBroker.PublishMessage(ctx, m)
+	}
+	defer span.Finish()
+
+	span.SetTag("topic", m.Topic)
+
+	m.Context = inject(b.s, span, m.Context)
+
+	if err := b.MessageBroker.PublishMessage(ctx, m); err != nil {
+		span.SetTag("error", err.Error())
+
+		return err
+	}
+
+	return nil
+}
+
+// PublishMessages starts publish span for each message of the batch and injects it into context of the message.
+func (b *messageBroker) PublishMessages(ctx context.Context, ms []broker.Message) error {
+	t := b.s.Tracer()
+	if t == nil {
+		return b.MessageBroker.PublishMessages(ctx, ms)
+	}
+
+	batch := make([]broker.Message, len(ms))
+	spans := make([]trace.Span, 0, len(ms))
+
+	for i, m := range ms {
+		batch[i] = m
+
+		span, _ := t.StartSpanFromContext(ctx, publishSpanPrefix+m.Topic)
+		if span == nil {
+			continue
+		}
+		spans = append(spans, span)
+
+		span.SetTag("topic", m.Topic)
+		batch[i].Context = inject(b.s, span, m.Context)
+	}
+
+	err := b.MessageBroker.PublishMessages(ctx, batch)
+
+	for _, span := range spans {
+		if err != nil {
+			span.SetTag("error", err.Error())
+		}
+		span.Finish()
+	}
+
+	return err
+}
+
+// Subscribe starts consume span for each received message and injects it into message context.
+func (b *messageBroker) Subscribe(ctx context.Context, topic string) (<-chan broker.Message, error) {
+	messages, err := b.MessageBroker.Subscribe(ctx, topic)
+	if err != nil || b.s.Tracer() == nil {
+		return messages, err
+	}
+
+	mgs := make(chan broker.Message)
+
+	go func() {
+		defer close(mgs)
+
+		for m := range messages {
+			// consume span marks reception of the message, message processing is traced by handler
+			span := quark.StartMessageSpan(b.s, consumeSpanPrefix+m.Topic, m)
+			span.SetTag("topic", m.Topic)
+
+			m.Context = inject(b.s, span, m.Context)
+			span.Finish()
+
+			select {
+			case mgs <- m:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return mgs, nil
+}
+
+// inject returns copy of message context with span injected.
+func inject(s quark.Service, span trace.Span, mc broker.MessageContext) broker.MessageContext {
+	c := make(broker.MessageContext, len(mc))
+	for k, v := range mc {
+		c[k] = v
+	}
+
+	if err := s.Tracer().InjectSpan(span, opentracing.TextMap, quark.MessageContextCarrier{Context: &c}); err != nil {
+		logger.Log().ErrorWithFields(logger.Fields{
+			"error":     err,
+			"component": componentName,
+		}, "Cannot inject span into message context")
+	}
+
+	return c
+}
@@ -0,0 +1,105 @@
+package tracing_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gkarlik/quark-go"
+	"github.com/gkarlik/quark-go/broker"
+	"github.com/gkarlik/quark-go/broker/memory"
+	"github.com/gkarlik/quark-go/broker/middleware/tracing"
+	"github.com/gkarlik/quark-go/service/trace"
+	tr "github.com/gkarlik/quark-go/service/trace/noop"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/stretchr/testify/assert"
+)
+
+type TestService struct {
+	*quark.ServiceBase
+}
+
+// TestTracer injects name of the span into carrier.
+type TestTracer struct {
+	*tr.Tracer
+}
+
+type TestSpan struct {
+	*tr.Span
+
+	name string
+}
+
+func (t *TestTracer) StartSpan(name string) trace.Span {
+	return &TestSpan{Span: &tr.Span{}, name: name}
+}
+
+func (t *TestTracer) StartSpanFromContext(ctx context.Context, name string) (trace.Span, context.Context) {
+	return t.StartSpan(name), ctx
+}
+
+func (t *TestTracer) ExtractSpan(name string, format interface{}, carrier interface{}) (trace.Span, error) {
+	return t.StartSpan(name), nil
+}
+
+func (t *TestTracer) InjectSpan(s trace.Span, format interface{}, carrier interface{}) error {
+	carrier.(opentracing.TextMapWriter).Set("span", s.(*TestSpan).name)
+	return nil
+}
+
+func TestTracingMiddleware(t *testing.T) {
+	topic := "TestTopic"
+
+	a, _ := quark.GetHostAddress(1234)
+
+	ts := &TestService{
+		ServiceBase: quark.NewService(
+			quark.Name("TestService"),
+			quark.Version("1.0"),
+			quark.Address(a),
+			quark.Tracer(&TestTracer{Tracer: tr.NewTracer()})),
+	}
+	defer ts.Dispose()
+
+	b := tracing.NewMessageTracingMiddleware(ts).Handle(memory.NewMessageBroker())
+	defer b.Dispose()
+
+	messages, err := b.Subscribe(context.Background(), topic)
+	assert.NoError(t, err, "Subscribe returned an error")
+
+	mc := broker.MessageContext{"key": "value"}
+	err = b.PublishMessage(context.Background(), broker.Message{Topic: topic, Value: "TestValue", Context: mc})
+	assert.NoError(t, err, "Publish returned an error")
+
+	m := <-messages
+	assert.Equal(t, "consume TestTopic", m.Context["span"])
+	assert.Equal(t, "value", m.Context["key"])
+
+	// context of published message is not modified
+	assert.Equal(t, broker.MessageContext{"key": "value"}, mc)
+}
+
+func TestTracingMiddlewareWithoutTracer(t *testing.T) {
+	topic := "TestTopic"
+
+	a, _ := quark.GetHostAddress(1234)
+
+	ts := &TestService{
+		ServiceBase: quark.NewService(
+			quark.Name("TestService"),
+			quark.Version("1.0"),
+			quark.Address(a)),
+	}
+	defer ts.Dispose()
+
+	b := tracing.NewMessageTracingMiddleware(ts).Handle(memory.NewMessageBroker())
+	defer b.Dispose()
+
+	messages, err := b.Subscribe(context.Background(), topic)
+	assert.NoError(t, err, "Subscribe returned an error")
+
+	err = b.PublishMessage(context.Background(), broker.Message{Topic: topic, Value: "TestValue"})
+	assert.NoError(t, err, "Publish returned an error")
+
+	m := <-messages
+	assert.Nil(t, m.Context["span"])
+}
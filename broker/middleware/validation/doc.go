@@ -0,0 +1,2 @@
+// Package validation provides middleware for message validation using schema registry.
+package validation
@@ -0,0 +1,220 @@
+package validation
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gkarlik/quark-go/broker"
+	"github.com/gkarlik/quark-go/broker/middleware"
+	"github.com/gkarlik/quark-go/broker/schema"
+	"github.com/gkarlik/quark-go/logger"
+)
+
+const componentName = "MessageValidationMiddleware"
+
+// Middleware is responsible for validating messages published and consumed by message broker against topic schemas.
+type Middleware struct {
+	r schema.Registry // schema registry
+}
+
+// NewMessageValidationMiddleware creates instance of Message Validation Middleware which uses schema registry.
+func NewMessageValidationMiddleware(r schema.Registry) *Middleware {
+	return &Middleware{
+		r: r,
+	}
+}
+
+// Handle returns message broker which validates messages published and consumed by next message broker.
+// Published message is validated against the latest schema of its topic and schema version is stored in message context
+// (schema.VersionKey). Consumed message is validated against schema version stored in its context (or the latest schema).
+// Messages of topics without schema are not validated. Values of messages with schema must be JSON encoded.
+// Batch publishing and connection state of next message broker are passed through (see middleware.MessageBroker).
+func (m Middleware) Handle(next broker.MessageBroker) broker.MessageBroker {
+	return &messageBroker{
+		MessageBroker: middleware.MessageBroker{MessageBroker: next},
+		r:             m.r,
+	}
+}
+
+// messageBroker represents message broker decorated with message validation.
+type messageBroker struct {
+	middleware.MessageBroker
+
+	r schema.Registry // schema registry
+}
+
+// PublishMessage validates message against the latest schema of its topic. Message which is not valid is not published.
+func (b *messageBroker) PublishMessage(ctx context.Context, m broker.Message) error {
+	m, err := b.prepare(m)
+	if err != nil {
+		return err
+	}
+
+	return b.MessageBroker.PublishMessage(ctx, m)
+}
+
+// PublishMessages validates each message of the batch against the latest schema of its topic. Batch is not published
+// if any of its messages is not valid.
+func (b *messageBroker) PublishMessages(ctx context.Context, ms []broker.Message) error {
+	batch := make([]broker.Message, len(ms))
+	for i, m := range ms {
+		v, err := b.prepare(m)
+		if err != nil {
+			return err
+		}
+		batch[i] = v
+	}
+
+	return b.MessageBroker.PublishMessages(ctx, batch)
+}
+
+// prepare validates message against the latest schema of its topic and returns encoded message with schema version
+// stored in its context. Message of topic without schema is returned unchanged.
+func (b *messageBroker) prepare(m broker.Message) (broker.Message, error) {
+	s, version, err := b.r.Latest(m.Topic)
+	if err == schema.ErrNotFound {
+		return m, nil
+	}
+	if err != nil {
+		logger.Log().ErrorWithFields(logger.Fields{
+			"error":     err,
+			"topic":     m.Topic,
+			"component": componentName,
+		}, "Cannot get message schema")
+
+		return m, err
+	}
+
+	data, contentType, err := broker.Encode(m)
+	if err != nil {
+		return m, err
+	}
+
+	if err := validate(s, data, contentType); err != nil {
+		logger.Log().ErrorWithFields(logger.Fields{
+			"error":     err,
+			"topic":     m.Topic,
+			"version":   version,
+			"component": componentName,
+		}, "Message does not match schema")
+
+		return m, err
+	}
+
+	mc := make(broker.MessageContext, len(m.Context)+2)
+	for k, v := range m.Context {
+		mc[k] = v
+	}
+	mc[broker.ContentTypeKey] = contentType
+	mc[schema.VersionKey] = version
+
+	m.Context = mc
+	m.Value = broker.Encoded(data)
+
+	return m, nil
+}
+
+// Subscribe validates consumed messages. Message which is not valid is rejected (if subscription uses manual acknowledgement)
+// and not passed to subscriber - validation error is passed to broker.WithErrorHandler.
+func (b *messageBroker) Subscribe(ctx context.Context, topic string) (<-chan broker.Message, error) {
+	messages, err := b.MessageBroker.Subscribe(ctx, topic)
+	if err != nil {
+		return nil, err
+	}
+
+	mgs := make(chan broker.Message)
+
+	go func() {
+		defer close(mgs)
+
+		for m := range messages {
+			if err := b.validate(m); err != nil {
+				logger.Log().ErrorWithFields(logger.Fields{
+					"error":     err,
+					"topic":     m.Topic,
+					"id":        broker.MessageID(m),
+					"component": componentName,
+				}, "Message does not match schema")
+
+				broker.HandleError(ctx, err)
+
+				if err := m.Nack(false); err != nil {
+					logger.Log().ErrorWithFields(logger.Fields{
+						"error":     err,
+						"topic":     m.Topic,
+						"component": componentName,
+					}, "Cannot reject message")
+				}
+				continue
+			}
+
+			select {
+			case mgs <- m:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return mgs, nil
+}
+
+// validate validates consumed message against schema version stored in its context or the latest schema of its topic.
+func (b *messageBroker) validate(m broker.Message) error {
+	var s *schema.Schema
+	var err error
+
+	if version, ok := version(m.Context[schema.VersionKey]); ok {
+		s, err = b.r.Schema(m.Topic, version)
+	} else {
+		s, _, err = b.r.Latest(m.Topic)
+		if err == schema.ErrNotFound {
+			return nil
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	var data []byte
+	switch v := m.Value.(type) {
+	case []byte:
+		data = v
+	case broker.Encoded:
+		data = v
+	default:
+		if data, _, err = broker.Encode(m); err != nil {
+			return err
+		}
+	}
+
+	return validate(s, data, broker.ContentType(m))
+}
+
+func validate(s *schema.Schema, data []byte, contentType string) error {
+	if !strings.HasPrefix(strings.ToLower(contentType), broker.ContentTypeJSON) {
+		return fmt.Errorf("[%s]: Cannot validate message - content type %q is not JSON", componentName, contentType)
+	}
+
+	return s.ValidateJSON(data)
+}
+
+// version returns schema version stored in message context. Message brokers may pass it as number or string.
+func version(v interface{}) (int, bool) {
+	switch val := v.(type) {
+	case int:
+		return val, true
+	case int32:
+		return int(val), true
+	case int64:
+		return int(val), true
+	case float64:
+		return int(val), true
+	case string:
+		n, err := strconv.Atoi(val)
+		return n, err == nil
+	}
+	return 0, false
+}
@@ -0,0 +1,122 @@
+package validation_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gkarlik/quark-go/broker"
+	"github.com/gkarlik/quark-go/broker/memory"
+	"github.com/gkarlik/quark-go/broker/middleware/validation"
+	"github.com/gkarlik/quark-go/broker/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+type TestPayload struct {
+	ID   int    `json:"id"`
+	Name string `json:"name,omitempty"`
+}
+
+const (
+	v1 = `{"type": "object", "properties": {"id": {"type": "integer", "minimum": 1}}, "required": ["id"], "additionalProperties": false}`
+	v2 = `{"type": "object", "properties": {"id": {"type": "integer", "minimum": 1}, "name": {"type": "string"}}, "required": ["id"]}`
+)
+
+func TestValidationMiddleware(t *testing.T) {
+	topic := "TestTopic"
+
+	r, _ := schema.NewLocalRegistry()
+	r.Register(topic, []byte(v1))
+
+	mb := memory.NewMessageBroker()
+	b := validation.NewMessageValidationMiddleware(r).Handle(mb)
+	defer b.Dispose()
+
+	var errs []error
+	ctx := broker.WithErrorHandler(context.Background(), func(err error) {
+		errs = append(errs, err)
+	})
+
+	messages, err := b.Subscribe(ctx, topic)
+	assert.NoError(t, err, "Subscribe returned an error")
+
+	err = b.PublishMessage(context.Background(), broker.Message{Topic: topic, Value: &TestPayload{ID: 0}})
+	assert.Error(t, err, "Publish should return an error")
+
+	err = b.PublishMessage(context.Background(), broker.Message{Topic: topic, Value: &TestPayload{ID: 1}})
+	assert.NoError(t, err, "Publish returned an error")
+
+	m := <-messages
+	assert.Equal(t, 1, m.Context[schema.VersionKey])
+
+	var payload TestPayload
+	assert.NoError(t, broker.Decode(m, &payload))
+	assert.Equal(t, 1, payload.ID)
+
+	// message published without validation is dropped by subscriber
+	err = mb.PublishMessage(context.Background(), broker.Message{Topic: topic, Value: &TestPayload{ID: 0}})
+	assert.NoError(t, err, "Publish returned an error")
+
+	// message validated with previous schema version is accepted
+	r.Register(topic, []byte(v2))
+	err = mb.PublishMessage(context.Background(), broker.Message{
+		Topic:   topic,
+		Value:   &TestPayload{ID: 2},
+		Context: broker.MessageContext{schema.VersionKey: "1"},
+	})
+	assert.NoError(t, err, "Publish returned an error")
+
+	m = <-messages
+	assert.NoError(t, broker.Decode(m, &payload))
+	assert.Equal(t, 2, payload.ID)
+	assert.Len(t, errs, 1)
+}
+
+func TestValidationMiddlewareWithoutSchema(t *testing.T) {
+	topic := "TestTopic"
+
+	r, _ := schema.NewLocalRegistry()
+
+	b := validation.NewMessageValidationMiddleware(r).Handle(memory.NewMessageBroker())
+	defer b.Dispose()
+
+	messages, err := b.Subscribe(context.Background(), topic)
+	assert.NoError(t, err, "Subscribe returned an error")
+
+	err = b.PublishMessage(context.Background(), broker.Message{Topic: topic, Value: "TestValue"})
+	assert.NoError(t, err, "Publish returned an error")
+
+	m := <-messages
+	assert.Nil(t, m.Context[schema.VersionKey])
+}
+
+func TestValidationMiddlewarePublishMessages(t *testing.T) {
+	topic := "TestTopic"
+
+	r, _ := schema.NewLocalRegistry()
+	r.Register(topic, []byte(v1))
+
+	b := validation.NewMessageValidationMiddleware(r).Handle(memory.NewMessageBroker())
+	defer b.Dispose()
+
+	messages, err := b.Subscribe(context.Background(), topic)
+	assert.NoError(t, err, "Subscribe returned an error")
+
+	// batch with invalid message is not published
+	err = broker.PublishMessages(context.Background(), b, []broker.Message{
+		{Topic: topic, Value: &TestPayload{ID: 1}},
+		{Topic: topic, Value: &TestPayload{ID: 0}},
+	})
+	assert.Error(t, err, "PublishMessages should return an error")
+
+	go func() {
+		err := broker.PublishMessages(context.Background(), b, []broker.Message{{Topic: topic, Value: &TestPayload{ID: 3}}})
+		assert.NoError(t, err, "PublishMessages returned an error")
+	}()
+
+	m := <-messages
+	assert.Equal(t, 1, m.Context[schema.VersionKey])
+
+	var payload TestPayload
+	assert.NoError(t, broker.Decode(m, &payload))
+	assert.Equal(t, 3, payload.ID)
+}
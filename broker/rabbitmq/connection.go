@@ -0,0 +1,132 @@
+package rabbitmq
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/gkarlik/quark-go/broker"
+	cb "github.com/gkarlik/quark-go/circuitbreaker"
+	"github.com/gkarlik/quark-go/logger"
+	"github.com/gkarlik/quark-go/metrics"
+	"github.com/streadway/amqp"
+)
+
+const (
+	metricsPrefix = "rabbitmq"
+
+	// period of checking if lost connection was noticed by supervisor
+	reconnectPollInterval = 100 * time.Millisecond
+)
+
+// State returns state of connection to RabbitMQ server.
+func (b *MessageBroker) State() broker.ConnectionState {
+	return b.monitor.State()
+}
+
+// ExposeMetrics exposes connection state and number of reconnections using metrics exposer.
+func (b *MessageBroker) ExposeMetrics(m metrics.Exposer) {
+	b.monitor.ExposeMetrics(m, metricsPrefix)
+}
+
+// supervise watches connection and reconnects to RabbitMQ server when connection is lost until broker is disposed.
+// Reconnection attempts use retry policy options passed to constructor, but they are not limited in number.
+func (b *MessageBroker) supervise(conn *amqp.Connection) {
+	defer b.supervisor.Done()
+
+	opts := append(append([]cb.Option{}, b.opts...), cb.Retry(math.MaxInt32))
+
+	for {
+		closed := conn.NotifyClose(make(chan *amqp.Error, 1))
+
+		var cause error = amqp.ErrClosed
+		select {
+		case <-b.ctx.Done():
+			return
+		case err := <-closed:
+			if b.ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				cause = err
+			}
+		}
+
+		b.cmu.Lock()
+		b.connected = make(chan struct{})
+		b.cmu.Unlock()
+
+		b.monitor.Disconnected(cause)
+
+		for {
+			c, err := new(cb.RetryPolicy).ExecuteContext(b.ctx, func() (interface{}, error) {
+				logger.Log().InfoWithFields(logger.Fields{
+					"address":   b.address,
+					"component": componentName,
+				}, "Reconnecting to RabbitMQ server")
+
+				return amqp.Dial(b.address)
+			}, opts...)
+
+			if b.ctx.Err() != nil {
+				// connection dialled when broker is disposed is not used
+				if err == nil {
+					c.(*amqp.Connection).Close()
+				}
+				return
+			}
+			if err == nil {
+				conn = c.(*amqp.Connection)
+				break
+			}
+		}
+
+		b.cmu.Lock()
+		if b.ctx.Err() != nil {
+			// broker was disposed after connection was dialled
+			b.cmu.Unlock()
+			conn.Close()
+			return
+		}
+		b.Connection = conn
+		close(b.connected)
+		b.cmu.Unlock()
+
+		b.monitor.Connected()
+	}
+}
+
+// connection returns connection to RabbitMQ server. If connection is lost it waits until connection is re-established,
+// context is done or broker is disposed.
+func (b *MessageBroker) connection(ctx context.Context) (*amqp.Connection, error) {
+	for {
+		b.cmu.RLock()
+		conn, connected := b.Connection, b.connected
+		b.cmu.RUnlock()
+
+		if conn == nil {
+			logger.Log().ErrorWithFields(logger.Fields{"component": componentName}, "Not connected to RabbitMQ server")
+
+			return nil, fmt.Errorf("[%s]: Not connected to RabbitMQ server. Please check logs and network connection", componentName)
+		}
+
+		select {
+		case <-connected:
+			if !conn.IsClosed() {
+				return conn, nil
+			}
+
+			// connection is lost, but supervisor has not noticed it yet
+			select {
+			case <-time.After(reconnectPollInterval):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-b.ctx.Done():
+			return nil, fmt.Errorf("[%s]: Message broker is disposed", componentName)
+		}
+	}
+}
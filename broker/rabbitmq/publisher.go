@@ -0,0 +1,186 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+
+	"github.com/gkarlik/quark-go/logger"
+	"github.com/streadway/amqp"
+)
+
+const defaultPublishChannels = 10
+
+var (
+	// ErrNotConfirmed is returned when RabbitMQ server does not confirm (nacks) published message.
+	ErrNotConfirmed = errors.New("Message was not confirmed by RabbitMQ server")
+	// ErrUnroutable is returned when mandatory message cannot be routed to any queue and it is returned by RabbitMQ server.
+	ErrUnroutable = errors.New("Message was returned by RabbitMQ server - no queue is bound with routing key")
+	// ErrDelayTooLong is returned when message is delayed longer than the longest delay tier (24 hours). Such message
+	// must be stored by scheduler until it is due (see gorm.Schedule).
+	ErrDelayTooLong = errors.New("Message delay is longer than the longest delay tier - use scheduler")
+)
+
+// publishChannel represents amqp channel in confirm mode which is used for publishing.
+// Channel publishes one message at a time, so confirmation and returned message always match the last published message.
+type publishChannel struct {
+	ch       *amqp.Channel          // amqp channel
+	confirms chan amqp.Confirmation // publisher confirmations
+	returns  chan amqp.Return       // messages returned as unroutable
+	closed   chan *amqp.Error       // channel close notification
+}
+
+// broken returns true if channel was closed by server (e.g. after failed declaration) and cannot be reused.
+func (pc *publishChannel) broken() bool {
+	select {
+	case <-pc.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// publishPool represents pool of long-lived publishing channels.
+type publishPool struct {
+	slots chan struct{}        // limits number of channels
+	idle  chan *publishChannel // channels which are not used by publisher
+}
+
+func newPublishPool(size int) *publishPool {
+	if size <= 0 {
+		size = defaultPublishChannels
+	}
+
+	return &publishPool{
+		slots: make(chan struct{}, size),
+		idle:  make(chan *publishChannel, size),
+	}
+}
+
+// acquire returns idle publishing channel or opens new one if pool is not full. It blocks until channel is available or context is done.
+func (b *MessageBroker) acquire(ctx context.Context) (*publishChannel, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	select {
+	case b.pool.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	select {
+	case pc := <-b.pool.idle:
+		if !pc.broken() {
+			return pc, nil
+		}
+	default:
+	}
+
+	conn, err := b.connection(ctx)
+	if err != nil {
+		<-b.pool.slots
+		return nil, err
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		<-b.pool.slots
+
+		logger.Log().ErrorWithFields(logger.Fields{
+			"error":     err,
+			"component": componentName,
+		}, "Cannot create channel")
+
+		return nil, err
+	}
+
+	if err := ch.Confirm(false); err != nil {
+		<-b.pool.slots
+		ch.Close()
+
+		logger.Log().ErrorWithFields(logger.Fields{
+			"error":     err,
+			"component": componentName,
+		}, "Cannot put channel into confirm mode")
+
+		return nil, err
+	}
+
+	return &publishChannel{
+		ch:       ch,
+		confirms: ch.NotifyPublish(make(chan amqp.Confirmation, 1)),
+		returns:  ch.NotifyReturn(make(chan amqp.Return, 1)),
+		closed:   ch.NotifyClose(make(chan *amqp.Error, 1)),
+	}, nil
+}
+
+// release returns publishing channel to the pool. Broken channel or channel waiting for confirmation is closed.
+func (b *MessageBroker) release(pc *publishChannel, reuse bool) {
+	if reuse && !pc.broken() {
+		b.pool.idle <- pc
+	} else {
+		pc.ch.Close()
+	}
+
+	<-b.pool.slots
+}
+
+// confirm waits until published message is confirmed by RabbitMQ server or context is done. Message returned as
+// unroutable is confirmed by server too, so ErrUnroutable is reported after confirmation is received.
+// It returns false if channel is still waiting for confirmation and cannot be reused.
+func (pc *publishChannel) confirm(ctx context.Context) (bool, error) {
+	var returned *amqp.Return
+
+	for {
+		select {
+		case r := <-pc.returns:
+			returned = &r
+		case c, ok := <-pc.confirms:
+			if !ok {
+				err := errors.New("Channel was closed before message was confirmed")
+				if amqpErr, ok := <-pc.closed; ok && amqpErr != nil {
+					err = amqpErr
+				}
+				return false, err
+			}
+
+			if !c.Ack {
+				return true, ErrNotConfirmed
+			}
+
+			// message is returned before it is confirmed, but both notifications may be ready at the same time
+			select {
+			case r := <-pc.returns:
+				returned = &r
+			default:
+			}
+
+			if returned != nil {
+				logger.Log().ErrorWithFields(logger.Fields{
+					"exchange":  returned.Exchange,
+					"topic":     returned.RoutingKey,
+					"code":      returned.ReplyCode,
+					"reason":    returned.ReplyText,
+					"component": componentName,
+				}, "Message was returned by RabbitMQ server")
+
+				return true, ErrUnroutable
+			}
+			return true, nil
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+	}
+}
+
+// closeIdle closes all idle publishing channels.
+func (p *publishPool) closeIdle() {
+	for {
+		select {
+		case pc := <-p.idle:
+			pc.ch.Close()
+		default:
+			return
+		}
+	}
+}
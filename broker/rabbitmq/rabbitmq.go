@@ -2,8 +2,10 @@ package rabbitmq
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/gkarlik/quark-go/broker"
 	cb "github.com/gkarlik/quark-go/circuitbreaker"
@@ -13,16 +15,63 @@ import (
 
 const componentName = "RabbitMQBroker"
 
-// MessageBroker represents message broker based on RabbitMQ.
+// acknowledger acknowledges RabbitMQ message using its delivery tag.
+type acknowledger struct {
+	delivery amqp.Delivery // message delivery
+}
+
+// Ack confirms that message was processed.
+func (a acknowledger) Ack() error {
+	return a.delivery.Ack(false)
+}
+
+// Nack rejects message. If requeue is true message is redelivered by RabbitMQ.
+func (a acknowledger) Nack(requeue bool) error {
+	return a.delivery.Nack(false, requeue)
+}
+
+// MessageBroker represents message broker based on RabbitMQ. Lost connection is re-established automatically
+// together with active subscriptions.
 type MessageBroker struct {
 	Connection *amqp.Connection // amqp connection
+	Config     *Config          // exchange and queue configuration
+
+	pool *publishPool // pool of publishing channels in confirm mode
+
+	address    string                    // address of RabbitMQ server
+	opts       []cb.Option               // retry policy options used to connect to RabbitMQ server
+	monitor    *broker.ConnectionMonitor // connection state
+	cmu        sync.RWMutex              // mutex for synchronizing connection
+	connected  chan struct{}             // closed when connection is established, replaced when connection is lost
+	ctx        context.Context           // context which is cancelled on Dispose
+	cancel     context.CancelFunc        // cancels reconnecting
+	supervisor sync.WaitGroup            // waits for connection supervisor
+
+	mu            sync.Mutex                 // mutex for synchronizing subscriptions
+	subscriptions map[int]context.CancelFunc // active subscriptions which are cancelled on Dispose
+	nextID        int                        // identifier of next subscription
+	wg            sync.WaitGroup             // waits for subscriptions to close their channels
 }
 
 // NewMessageBroker creates instance of RabbitMQ message broker which is connected on provided address.
-// Additional options passed as arguments are used to configure circuit breaker pattern to connect to RabbitMQ instance.
+// Messages are published to default exchange and consumed from non-durable queues named after topics.
+// Additional options passed as arguments are used to configure retry policy (backoff, jitter, cancellation context etc.) to connect to RabbitMQ instance.
 // Panics if cannot create an instance.
 func NewMessageBroker(address string, opts ...cb.Option) *MessageBroker {
-	conn, err := new(cb.DefaultCircuitBreaker).Execute(func() (interface{}, error) {
+	return NewMessageBrokerWithConfig(address, nil, opts...)
+}
+
+// NewMessageBrokerWithConfig creates instance of RabbitMQ message broker which is connected on provided address and
+// uses exchange and queues specified in configuration. If configuration is nil default configuration is used.
+// Additional options passed as arguments are used to configure retry policy (backoff, jitter, cancellation context etc.) to connect to RabbitMQ instance.
+// The same options are used to reconnect when connection is lost, but number of reconnection attempts is not limited.
+// Panics if cannot create an instance.
+func NewMessageBrokerWithConfig(address string, cfg *Config, opts ...cb.Option) *MessageBroker {
+	if cfg == nil {
+		cfg = NewConfig()
+	}
+
+	conn, err := new(cb.RetryPolicy).Execute(func() (interface{}, error) {
 		logger.Log().InfoWithFields(logger.Fields{
 			"address":   address,
 			"component": componentName,
@@ -42,117 +91,235 @@ func NewMessageBroker(address string, opts ...cb.Option) *MessageBroker {
 		"component": componentName,
 	}, "Connected to RabbitMQ server")
 
-	return &MessageBroker{Connection: conn.(*amqp.Connection)}
+	connected := make(chan struct{})
+	close(connected)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	b := &MessageBroker{
+		Connection: conn.(*amqp.Connection),
+		Config:     cfg,
+		pool:       newPublishPool(cfg.PublishChannels),
+		address:    address,
+		opts:       opts,
+		monitor:    broker.NewConnectionMonitor(componentName),
+		connected:  connected,
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+
+	b.supervisor.Add(1)
+	go b.supervise(b.Connection)
+
+	return b
 }
 
-// PublishMessage publishes message to RabbitMQ instance.
-func (b MessageBroker) PublishMessage(ctx context.Context, m broker.Message) error {
+// PublishMessage publishes message to configured exchange in RabbitMQ instance. Message topic is used as routing key.
+// Messages are published using pool of channels in confirm mode - PublishMessage blocks until message is confirmed
+// by RabbitMQ server or context is done. If Config.Mandatory is set, ErrUnroutable is returned for messages which
+// cannot be routed to any queue. If connection is lost, PublishMessage waits until it is re-established or context is done.
+// Delayed messages (see broker.PublishAt) are published to delay queue of the topic which holds them until they are due
+// and then dead-letters them to the exchange with topic as routing key. Delay queues are declared for fixed delay tiers
+// (from 1 second to 24 hours), message can be delivered later than it is due by less than its tier. ErrDelayTooLong
+// is returned for messages delayed longer than 24 hours.
+func (b *MessageBroker) PublishMessage(ctx context.Context, m broker.Message) error {
 	logger.Log().InfoWithFields(logger.Fields{
 		"message":   m,
 		"component": componentName,
 	}, "Publishing message")
 
-	if b.Connection == nil {
-		logger.Log().ErrorWithFields(logger.Fields{"component": componentName}, "Not connected to RabbitMQ instance")
-
-		return fmt.Errorf("[%s]: Not connected to RabbitMQ server. Please check logs and network connection", componentName)
-	}
-
 	if m.Topic == "" {
 		logger.Log().ErrorWithFields(logger.Fields{"component": componentName}, "Cannot publish message - Topic cannot be empty")
 
 		return fmt.Errorf("[%s]: Cannot publish message - Topic cannot be empty", componentName)
 	}
 
-	ch, err := b.Connection.Channel()
-	if err != nil {
-		logger.Log().ErrorWithFields(logger.Fields{
-			"error":     err,
-			"component": componentName,
-		}, "Cannot create channel")
+	if d := broker.Due(m); d > 0 {
+		if _, ok := delayTier(d); !ok {
+			logger.Log().ErrorWithFields(logger.Fields{
+				"message":   m,
+				"delay":     d,
+				"component": componentName,
+			}, "Cannot publish message - delay is longer than the longest delay tier")
 
-		return err
+			return ErrDelayTooLong
+		}
 	}
-	defer ch.Close()
 
-	q, err := ch.QueueDeclare(
-		m.Topic, // name
-		false,   // durable
-		false,   // delete when unused
-		false,   // exclusive
-		false,   // no-wait
-		nil,     // arguments
-	)
+	m = broker.WithMessageID(m)
 
+	body, contentType, err := broker.Encode(m)
 	if err != nil {
 		logger.Log().ErrorWithFields(logger.Fields{
 			"error":     err,
-			"queue":     m.Topic,
+			"message":   m,
 			"component": componentName,
-		}, "Cannot create queue")
+		}, "Cannot parse message body")
+
+		return err
+	}
 
+	pc, err := b.acquire(ctx)
+	if err != nil {
 		return err
 	}
 
-	body, err := json.Marshal(m.Value)
+	reuse, err := b.publish(ctx, pc, m, body, contentType)
+	b.release(pc, reuse)
+
 	if err != nil {
 		logger.Log().ErrorWithFields(logger.Fields{
 			"error":     err,
-			"message":   m,
+			"exchange":  b.Config.Exchange,
+			"topic":     m.Topic,
 			"component": componentName,
-		}, "Cannot parse message body")
+		}, "Cannot publish message")
 
 		return err
 	}
 
+	return nil
+}
+
+// publish publishes message using publishing channel and waits for confirmation. It returns false if channel cannot be reused.
+func (b *MessageBroker) publish(ctx context.Context, pc *publishChannel, m broker.Message, body []byte, contentType string) (bool, error) {
+	if b.Config.Exchange == "" {
+		// default exchange requires queue to exist before message is published,
+		// queue of temporary subscription is declared by subscriber only
+		if !broker.IsTemporary(ctx) {
+			if _, err := b.declareQueue(context.Background(), pc.ch, m.Topic); err != nil {
+				return false, err
+			}
+		}
+	} else if err := b.declareExchange(pc.ch); err != nil {
+		return false, err
+	}
+
+	exchange, key, expiration := b.Config.Exchange, m.Topic, ""
+
+	// delayed message waits in delay queue which dead-letters it to the exchange when it expires
+	if d := broker.Due(m); d > 0 {
+		q, err := b.declareDelayQueue(pc.ch, m.Topic, d)
+		if err != nil {
+			return false, err
+		}
+		exchange, key = "", q
+		expiration = strconv.FormatInt(int64((d+time.Millisecond-1)/time.Millisecond), 10)
+	}
+
 	// fill message headers with context
 	headers := amqp.Table{}
 	for k, v := range m.Context {
 		headers[k] = v
 	}
 
-	err = ch.Publish(
-		"",     // exchange
-		q.Name, // routing key
-		false,  // mandatory
-		false,  // immediate
+	err := pc.ch.Publish(
+		exchange,           // exchange
+		key,                // routing key
+		b.Config.Mandatory, // mandatory
+		false,              // immediate
 		amqp.Publishing{
-			ContentType: "application/json",
-			Body:        body,
-			Headers:     headers,
+			ContentType:  contentType,
+			MessageId:    broker.MessageID(m),
+			Expiration:   expiration,
+			DeliveryMode: b.Config.deliveryMode(),
+			Body:         body,
+			Headers:      headers,
 		})
 
 	if err != nil {
-		logger.Log().ErrorWithFields(logger.Fields{
-			"error":     err,
-			"queue":     q.Name,
-			"component": componentName,
-		}, "Cannot publish message")
+		return false, err
 	}
 
-	return nil
+	return pc.confirm(ctx)
 }
 
-// Subscribe subscribes to specified routing key/topic in RabbitMQ instance.
-func (b MessageBroker) Subscribe(ctx context.Context, topic string) (<-chan broker.Message, error) {
+// Subscribe subscribes to specified routing key/topic in RabbitMQ instance. If named exchange is configured, subscriber queue
+// is bound with the topic (which may contain wildcards for topic exchange) and routing keys passed in context with RoutingKeys.
+// Queue name can be passed in context with Queue.
+// If context is created with broker.ManualAck, messages are not acknowledged automatically
+// and must be confirmed with Ack or rejected with Nack (using delivery tags).
+// Subscription ends when context is done or broker is disposed - amqp channel is closed and returned channel is closed.
+// If amqp channel or connection is closed, queue is declared and consumed again (after connection is re-established).
+// Subscription errors are passed to broker.WithErrorHandler.
+func (b *MessageBroker) Subscribe(ctx context.Context, topic string) (<-chan broker.Message, error) {
 	logger.Log().InfoWithFields(logger.Fields{
 		"topic":     topic,
 		"component": componentName,
 	}, "Subscribing to messages with topic")
 
-	if b.Connection == nil {
-		logger.Log().ErrorWithFields(logger.Fields{"component": componentName}, "Not connected to RabbitMQ server")
-
-		return nil, fmt.Errorf("[%s]: Not connected to RabbitMQ server. Please check logs and network connection", componentName)
-	}
-
 	if topic == "" {
 		logger.Log().ErrorWithFields(logger.Fields{"component": componentName}, "Cannot subscribe to messages - Topic cannot be empty")
 
 		return nil, fmt.Errorf("[%s]: Cannot subscribe to messages - Topic cannot be empty", componentName)
 	}
 
-	ch, err := b.Connection.Channel()
+	c, err := b.consume(ctx, topic)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, done := b.subscription(ctx)
+	mgs := make(chan broker.Message)
+
+	go func() {
+		defer done()
+		defer close(mgs)
+
+		for {
+			err := c.deliver(ctx, mgs)
+			c.ch.Close()
+
+			if err == nil {
+				logger.Log().InfoWithFields(logger.Fields{
+					"queue":     c.queue,
+					"component": componentName,
+				}, "Subscription cancelled")
+				return
+			}
+
+			logger.Log().ErrorWithFields(logger.Fields{
+				"error":     err,
+				"queue":     c.queue,
+				"component": componentName,
+			}, "Subscription failed")
+
+			broker.HandleError(ctx, err)
+
+			if c, err = b.consume(ctx, topic); err != nil {
+				if ctx.Err() == nil {
+					broker.HandleError(ctx, err)
+				}
+				return
+			}
+
+			logger.Log().InfoWithFields(logger.Fields{
+				"queue":     c.queue,
+				"component": componentName,
+			}, "Subscription re-established")
+		}
+	}()
+
+	return mgs, nil
+}
+
+// consumer represents amqp channel which consumes messages from subscriber queue.
+type consumer struct {
+	ch         *amqp.Channel        // amqp channel
+	deliveries <-chan amqp.Delivery // consumed messages
+	closed     chan *amqp.Error     // channel close notification
+	queue      string               // queue name
+	manualAck  bool                 // indicates if messages are acknowledged manually
+}
+
+// consume declares exchange and subscriber queue and starts consuming messages. It waits for connection if connection is lost.
+func (b *MessageBroker) consume(ctx context.Context, topic string) (*consumer, error) {
+	conn, err := b.connection(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ch, err := conn.Channel()
 	if err != nil {
 		logger.Log().ErrorWithFields(logger.Fields{
 			"error":     err,
@@ -162,33 +329,27 @@ func (b MessageBroker) Subscribe(ctx context.Context, topic string) (<-chan brok
 		return nil, err
 	}
 
-	q, err := ch.QueueDeclare(
-		topic, // name
-		false, // durable
-		false, // delete when unused
-		false, // exclusive
-		false, // no-wait
-		nil,   // arguments
-	)
+	if err := b.declareExchange(ch); err != nil {
+		ch.Close()
+		return nil, err
+	}
 
+	q, err := b.declareQueue(ctx, ch, topic)
 	if err != nil {
-		logger.Log().ErrorWithFields(logger.Fields{
-			"error":     err,
-			"queue":     topic,
-			"component": componentName,
-		}, "Cannot create queue")
-
+		ch.Close()
 		return nil, err
 	}
 
-	messages, err := ch.Consume(
-		q.Name, // queue
-		"",     // consumer
-		true,   // auto-ack
-		false,  // exclusive
-		false,  // no-local
-		false,  // no-wait
-		nil,    // args
+	manualAck := broker.IsManualAck(ctx)
+
+	deliveries, err := ch.Consume(
+		q.Name,     // queue
+		"",         // consumer
+		!manualAck, // auto-ack
+		false,      // exclusive
+		false,      // no-local
+		false,      // no-wait
+		nil,        // args
 	)
 
 	if err != nil {
@@ -197,34 +358,115 @@ func (b MessageBroker) Subscribe(ctx context.Context, topic string) (<-chan brok
 			"queue":     q.Name,
 			"component": componentName,
 		}, "Cannot consume message")
+
+		ch.Close()
+		return nil, err
 	}
 
-	mgs := make(chan broker.Message)
-	go func() {
-		for msg := range messages {
+	return &consumer{
+		ch:         ch,
+		deliveries: deliveries,
+		closed:     ch.NotifyClose(make(chan *amqp.Error, 1)),
+		queue:      q.Name,
+		manualAck:  manualAck,
+	}, nil
+}
+
+// deliver passes consumed messages to subscriber until context is done (nil is returned) or message stream is closed.
+func (c *consumer) deliver(ctx context.Context, mgs chan<- broker.Message) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok := <-c.deliveries:
+			if !ok {
+				err := fmt.Errorf("[%s]: Message stream of queue %q was closed", componentName, c.queue)
+				if amqpErr, ok := <-c.closed; ok && amqpErr != nil {
+					err = amqpErr
+				}
+				return err
+			}
+
 			// create message context from headers
 			context := broker.MessageContext{}
 			for k, v := range msg.Headers {
-				context[k] = v.(string)
+				context[k] = v
+			}
+			if msg.ContentType != "" {
+				context[broker.ContentTypeKey] = msg.ContentType
 			}
 
-			mgs <- broker.Message{
-				Topic:   q.Name,
+			m := broker.Message{
+				Topic:   msg.RoutingKey,
 				Value:   msg.Body,
 				Context: context,
 			}
+
+			if c.manualAck {
+				m.Acknowledger = acknowledger{delivery: msg}
+			}
+
+			select {
+			case mgs <- m:
+			case <-ctx.Done():
+				return nil
+			}
 		}
-	}()
+	}
+}
 
-	return mgs, nil
+// subscription registers subscription which is cancelled when broker is disposed.
+// Returned context is cancelled on Dispose and returned function must be called when subscription ends.
+func (b *MessageBroker) subscription(ctx context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	b.mu.Lock()
+	if b.subscriptions == nil {
+		b.subscriptions = make(map[int]context.CancelFunc)
+	}
+	id := b.nextID
+	b.nextID++
+	b.subscriptions[id] = cancel
+	b.wg.Add(1)
+	b.mu.Unlock()
+
+	return ctx, func() {
+		cancel()
+
+		b.mu.Lock()
+		delete(b.subscriptions, id)
+		b.mu.Unlock()
+
+		b.wg.Done()
+	}
 }
 
-// Dispose closes RabbitMQ connection.
+// Dispose cancels all subscriptions, stops reconnecting and closes RabbitMQ connection.
 func (b *MessageBroker) Dispose() {
 	logger.Log().InfoWithFields(logger.Fields{"component": componentName}, "Disposing message broker component")
 
+	if b.cancel != nil {
+		b.cancel()
+	}
+
+	b.mu.Lock()
+	for _, cancel := range b.subscriptions {
+		cancel()
+	}
+	b.mu.Unlock()
+
+	b.wg.Wait()
+
+	if b.pool != nil {
+		b.pool.closeIdle()
+	}
+
+	b.cmu.Lock()
 	if b.Connection != nil {
 		b.Connection.Close()
 		b.Connection = nil
 	}
+	b.cmu.Unlock()
+
+	b.supervisor.Wait()
 }
@@ -154,3 +154,255 @@ func TestBrokenNetworkConnection(t *testing.T) {
 		defer ts.Dispose()
 	})
 }
+
+func TestPublishSubscribeManualAck(t *testing.T) {
+	topic := "TestManualAckTopic"
+
+	b := rabbitmq.NewMessageBroker("amqp:///")
+	defer b.Dispose()
+
+	messages, err := b.Subscribe(broker.ManualAck(context.Background()), topic)
+	assert.NoError(t, err, "Subscribe returned an error")
+
+	err = b.PublishMessage(context.Background(), broker.Message{Topic: topic, Value: &TestPayload{Text: "Test"}})
+	assert.NoError(t, err, "Publish returned an error")
+
+	msg := <-messages
+	assert.NotNil(t, msg.Acknowledger, "Message should have acknowledgement handle")
+	assert.NoError(t, msg.Nack(true), "Nack returned an error")
+
+	redelivered := <-messages
+	assert.Equal(t, msg.Value, redelivered.Value)
+	assert.NoError(t, redelivered.Ack(), "Ack returned an error")
+}
+
+func TestSubscriptionCancellation(t *testing.T) {
+	topic := "TestCancellationTopic"
+
+	b := rabbitmq.NewMessageBroker("amqp:///")
+	defer b.Dispose()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	messages, err := b.Subscribe(ctx, topic)
+	assert.NoError(t, err, "Subscribe returned an error")
+
+	cancel()
+
+	for range messages {
+	}
+
+	messages, err = b.Subscribe(context.Background(), topic)
+	assert.NoError(t, err, "Subscribe returned an error")
+
+	b.Dispose()
+
+	_, ok := <-messages
+	assert.False(t, ok, "Channel should be closed")
+}
+
+func TestFanoutExchange(t *testing.T) {
+	topic := "TestFanoutTopic"
+	text := "This is a test message"
+
+	cfg := rabbitmq.NewConfig()
+	cfg.Exchange = "TestFanoutExchange"
+	cfg.ExchangeType = rabbitmq.ExchangeFanout
+
+	b := rabbitmq.NewMessageBrokerWithConfig("amqp:///", cfg)
+	defer b.Dispose()
+
+	// each subscriber with its own queue receives copy of the message
+	var subscriptions []<-chan broker.Message
+	for _, queue := range []string{"TestFanoutQueue1", "TestFanoutQueue2"} {
+		ctx := context.WithValue(context.Background(), rabbitmq.Queue, queue)
+
+		messages, err := b.Subscribe(ctx, topic)
+		assert.NoError(t, err, "Subscribe returned an error")
+
+		subscriptions = append(subscriptions, messages)
+	}
+
+	err := b.PublishMessage(context.Background(), broker.Message{Topic: topic, Value: &TestPayload{Text: text}})
+	assert.NoError(t, err, "Publish returned an error")
+
+	for _, messages := range subscriptions {
+		msg := <-messages
+		assert.Equal(t, topic, msg.Topic)
+
+		var payload TestPayload
+		err := json.Unmarshal(msg.Value.([]byte), &payload)
+		assert.NoError(t, err, "Unmarshal returned an error")
+		assert.Equal(t, text, payload.Text)
+	}
+}
+
+func TestTopicExchange(t *testing.T) {
+	cfg := rabbitmq.NewConfig()
+	cfg.Exchange = "TestTopicExchange"
+	cfg.ExchangeType = rabbitmq.ExchangeTopic
+	cfg.Durable = true
+	cfg.AutoDelete = true
+	cfg.Persistent = true
+
+	b := rabbitmq.NewMessageBrokerWithConfig("amqp:///", cfg)
+	defer b.Dispose()
+
+	ctx := context.WithValue(context.Background(), rabbitmq.RoutingKeys, []string{"audit.#"})
+
+	messages, err := b.Subscribe(ctx, "orders.*")
+	assert.NoError(t, err, "Subscribe returned an error")
+
+	for _, topic := range []string{"orders.created", "payments.created", "audit.orders.created"} {
+		err = b.PublishMessage(context.Background(), broker.Message{Topic: topic, Value: &TestPayload{Text: topic}})
+		assert.NoError(t, err, "Publish returned an error")
+	}
+
+	assert.Equal(t, "orders.created", (<-messages).Topic)
+	assert.Equal(t, "audit.orders.created", (<-messages).Topic)
+}
+
+func TestTemporarySubscription(t *testing.T) {
+	topic := "TestTemporaryTopic"
+
+	cfg := rabbitmq.NewConfig()
+	cfg.Durable = true
+
+	b := rabbitmq.NewMessageBrokerWithConfig("amqp:///", cfg)
+	defer b.Dispose()
+
+	// queue is exclusive and deleted when subscription ends, although queues are durable
+	ctx, cancel := context.WithCancel(broker.Temporary(context.Background()))
+
+	messages, err := b.Subscribe(ctx, topic)
+	assert.NoError(t, err, "Subscribe returned an error")
+
+	err = b.PublishMessage(broker.Temporary(context.Background()), broker.Message{Topic: topic, Value: "TestValue"})
+	assert.NoError(t, err, "Publish returned an error")
+
+	assert.Equal(t, topic, (<-messages).Topic)
+
+	cancel()
+	for range messages {
+	}
+
+	// message published after subscription ended is dropped
+	err = b.PublishMessage(broker.Temporary(context.Background()), broker.Message{Topic: topic, Value: "TestValue"})
+	assert.NoError(t, err, "Publish returned an error")
+}
+
+func TestPublishUnroutableMessage(t *testing.T) {
+	cfg := rabbitmq.NewConfig()
+	cfg.Exchange = "TestUnroutableExchange"
+	cfg.Mandatory = true
+
+	b := rabbitmq.NewMessageBrokerWithConfig("amqp:///", cfg)
+	defer b.Dispose()
+
+	// no queue is bound with the topic
+	err := b.PublishMessage(context.Background(), broker.Message{Topic: "TestUnroutableTopic", Value: "TestValue"})
+	assert.Equal(t, rabbitmq.ErrUnroutable, err)
+
+	// publishing channel can be reused after message is returned
+	messages, err := b.Subscribe(context.Background(), "TestRoutableTopic")
+	assert.NoError(t, err, "Subscribe returned an error")
+
+	err = b.PublishMessage(context.Background(), broker.Message{Topic: "TestRoutableTopic", Value: "TestValue"})
+	assert.NoError(t, err, "Publish returned an error")
+
+	msg := <-messages
+	assert.Equal(t, "TestRoutableTopic", msg.Topic)
+}
+
+func TestPublishCancellation(t *testing.T) {
+	b := rabbitmq.NewMessageBroker("amqp:///")
+	defer b.Dispose()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := b.PublishMessage(ctx, broker.Message{Topic: "TestCancelledTopic", Value: "TestValue"})
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestReconnect(t *testing.T) {
+	topic := "TestReconnectTopic"
+
+	b := rabbitmq.NewMessageBroker("amqp:///", cb.Timeout(100*time.Millisecond))
+	defer b.Dispose()
+
+	messages, err := b.Subscribe(context.Background(), topic)
+	assert.NoError(t, err, "Subscribe returned an error")
+
+	// simulate lost connection
+	b.Connection.Close()
+
+	assert.Eventually(t, func() bool {
+		return b.State() == broker.Connected && !b.Connection.IsClosed()
+	}, 5*time.Second, 100*time.Millisecond)
+
+	// subscription is re-established after reconnection
+	err = b.PublishMessage(context.Background(), broker.Message{Topic: topic, Value: "TestValue"})
+	assert.NoError(t, err, "Publish returned an error")
+
+	msg := <-messages
+	assert.Equal(t, topic, msg.Topic)
+}
+
+func TestDelayedMessage(t *testing.T) {
+	topic := "TestDelayedTopic"
+
+	b := rabbitmq.NewMessageBroker("amqp:///")
+	defer b.Dispose()
+
+	messages, err := b.Subscribe(context.Background(), topic)
+	assert.NoError(t, err, "Subscribe returned an error")
+
+	start := time.Now()
+
+	m := broker.Delay(broker.Message{Topic: topic, Value: &TestPayload{Text: "Delayed"}}, 500*time.Millisecond)
+	err = b.PublishMessage(context.Background(), m)
+	assert.NoError(t, err, "Publish returned an error")
+
+	msg := <-messages
+	assert.Equal(t, topic, msg.Topic)
+	assert.True(t, time.Since(start) >= 500*time.Millisecond, "Message is delivered before it is due")
+}
+
+func TestDelayedMessagesOfTheSameTier(t *testing.T) {
+	topic := "TestDelayedTierTopic"
+
+	b := rabbitmq.NewMessageBroker("amqp:///")
+	defer b.Dispose()
+
+	messages, err := b.Subscribe(context.Background(), topic)
+	assert.NoError(t, err, "Subscribe returned an error")
+
+	start := time.Now()
+
+	// both messages wait in the same delay queue with per-message expiration
+	for _, d := range []time.Duration{300 * time.Millisecond, 600 * time.Millisecond} {
+		m := broker.Delay(broker.Message{Topic: topic, Value: &TestPayload{Text: d.String()}}, d)
+		err = b.PublishMessage(context.Background(), m)
+		assert.NoError(t, err, "Publish returned an error")
+	}
+
+	msg := <-messages
+	assert.Equal(t, topic, msg.Topic)
+	assert.True(t, time.Since(start) >= 300*time.Millisecond, "Message is delivered before it is due")
+	assert.True(t, time.Since(start) < 600*time.Millisecond, "Message is delivered after message with longer delay is due")
+
+	msg = <-messages
+	assert.Equal(t, topic, msg.Topic)
+	assert.True(t, time.Since(start) >= 600*time.Millisecond, "Message is delivered before it is due")
+}
+
+func TestDelayedMessageTooLong(t *testing.T) {
+	b := rabbitmq.NewMessageBroker("amqp:///")
+	defer b.Dispose()
+
+	m := broker.Delay(broker.Message{Topic: "TestDelayedTopic", Value: "TestValue"}, 25*time.Hour)
+
+	err := b.PublishMessage(context.Background(), m)
+	assert.Equal(t, rabbitmq.ErrDelayTooLong, err)
+}
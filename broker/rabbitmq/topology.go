@@ -0,0 +1,211 @@
+package rabbitmq
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gkarlik/quark-go/broker"
+	"github.com/gkarlik/quark-go/logger"
+	"github.com/streadway/amqp"
+)
+
+const (
+	// Queue defines name of the queue used by subscriber. Subscribers sharing the same queue compete for messages (work queue),
+	// subscribers with different queues receive copy of each message (pub/sub). If not set, exclusive server-named queue is used.
+	// Queue name is ignored for default exchange which routes messages to queues named after topics.
+	Queue = "queue"
+	// RoutingKeys defines additional routing keys ([]string) which subscriber queue is bound with. Topic exchange supports
+	// wildcards - "*" matches exactly one word and "#" matches zero or more words.
+	RoutingKeys = "routing-keys"
+	// BindingArgs defines arguments (amqp.Table) of subscriber queue binding, e.g. headers matched by headers exchange.
+	BindingArgs = "binding-args"
+
+	// ExchangeDirect defines exchange which routes messages to queues bound with exactly the same routing key.
+	ExchangeDirect = amqp.ExchangeDirect
+	// ExchangeTopic defines exchange which routes messages to queues bound with matching routing key pattern.
+	ExchangeTopic = amqp.ExchangeTopic
+	// ExchangeFanout defines exchange which routes messages to all bound queues.
+	ExchangeFanout = amqp.ExchangeFanout
+	// ExchangeHeaders defines exchange which routes messages to queues bound with matching message headers.
+	ExchangeHeaders = amqp.ExchangeHeaders
+
+	delayQueuePrefix = "delay"
+)
+
+// delayTiers defines delays of delay queues declared per topic. Delayed message waits in queue of the shortest tier which is
+// not shorter than its delay, so number of delay queues is bounded. Messages delayed longer than the longest tier are rejected.
+var delayTiers = []time.Duration{
+	time.Second,
+	5 * time.Second,
+	15 * time.Second,
+	time.Minute,
+	5 * time.Minute,
+	15 * time.Minute,
+	time.Hour,
+	6 * time.Hour,
+	24 * time.Hour,
+}
+
+// Config represents RabbitMQ message broker configuration.
+type Config struct {
+	Exchange     string // exchange name, empty name means default exchange
+	ExchangeType string // exchange type - direct, topic, fanout or headers
+	Durable      bool   // indicates if exchange and queues survive server restart
+	AutoDelete   bool   // indicates if queues are deleted when last subscriber unsubscribes
+	Persistent   bool   // indicates if messages are published with persistent delivery mode
+	Mandatory    bool   // indicates if messages which cannot be routed to any queue are returned (ErrUnroutable)
+
+	PublishChannels int // number of channels used concurrently for publishing, default is 10
+}
+
+// NewConfig creates default RabbitMQ message broker configuration - messages are published to default exchange
+// and consumed from non-durable queues named after topics.
+func NewConfig() *Config {
+	return &Config{
+		ExchangeType:    ExchangeDirect,
+		PublishChannels: defaultPublishChannels,
+	}
+}
+
+// deliveryMode returns delivery mode of published messages.
+func (c *Config) deliveryMode() uint8 {
+	if c.Persistent {
+		return amqp.Persistent
+	}
+	return amqp.Transient
+}
+
+// declareExchange declares exchange if it is not default exchange.
+func (b *MessageBroker) declareExchange(ch *amqp.Channel) error {
+	if b.Config.Exchange == "" {
+		return nil
+	}
+
+	err := ch.ExchangeDeclare(
+		b.Config.Exchange,     // name
+		b.Config.ExchangeType, // type
+		b.Config.Durable,      // durable
+		false,                 // delete when unused
+		false,                 // internal
+		false,                 // no-wait
+		nil,                   // arguments
+	)
+
+	if err != nil {
+		logger.Log().ErrorWithFields(logger.Fields{
+			"error":     err,
+			"exchange":  b.Config.Exchange,
+			"type":      b.Config.ExchangeType,
+			"component": componentName,
+		}, "Cannot create exchange")
+	}
+
+	return err
+}
+
+// declareQueue declares subscriber queue and binds it with exchange using topic and additional routing keys.
+func (b *MessageBroker) declareQueue(ctx context.Context, ch *amqp.Channel, topic string) (amqp.Queue, error) {
+	name, _ := ctx.Value(Queue).(string)
+	exclusive := broker.IsTemporary(ctx)
+
+	if b.Config.Exchange == "" {
+		name = topic
+	} else if name == "" {
+		// each subscriber without queue name receives copy of each message
+		exclusive = true
+	}
+
+	q, err := ch.QueueDeclare(
+		name,                             // name
+		b.Config.Durable && !exclusive,   // durable
+		b.Config.AutoDelete || exclusive, // delete when unused
+		exclusive,                        // exclusive
+		false,                            // no-wait
+		nil,                              // arguments
+	)
+
+	if err != nil {
+		logger.Log().ErrorWithFields(logger.Fields{
+			"error":     err,
+			"queue":     name,
+			"component": componentName,
+		}, "Cannot create queue")
+
+		return q, err
+	}
+
+	// default exchange routes messages to the queue with the same name as routing key
+	if b.Config.Exchange == "" {
+		return q, nil
+	}
+
+	keys := []string{topic}
+	if rk, ok := ctx.Value(RoutingKeys).([]string); ok {
+		keys = append(keys, rk...)
+	}
+	args, _ := ctx.Value(BindingArgs).(amqp.Table)
+
+	for _, key := range keys {
+		if err := ch.QueueBind(q.Name, key, b.Config.Exchange, false, args); err != nil {
+			logger.Log().ErrorWithFields(logger.Fields{
+				"error":       err,
+				"queue":       q.Name,
+				"exchange":    b.Config.Exchange,
+				"routing-key": key,
+				"component":   componentName,
+			}, "Cannot bind queue")
+
+			return q, err
+		}
+	}
+
+	return q, nil
+}
+
+// delayTier returns tier of delay queue which holds message for delay. It returns false if delay is longer than the longest tier.
+func delayTier(delay time.Duration) (time.Duration, bool) {
+	for _, t := range delayTiers {
+		if delay <= t {
+			return t, true
+		}
+	}
+	return 0, false
+}
+
+// declareDelayQueue declares queue which holds messages of the topic until they expire (per-message expiration is set
+// by publisher) and then dead-letters them to the exchange with topic as routing key. Queue is declared for delay tier,
+// because messages expire only at the head of the queue - message can be delivered later than it is due (by less than
+// its tier) if message with longer delay was published to the same queue before it.
+func (b *MessageBroker) declareDelayQueue(ch *amqp.Channel, topic string, delay time.Duration) (string, error) {
+	// delay is not longer than the longest tier, because it is checked before message is published
+	t, _ := delayTier(delay)
+	tier := int64(t / time.Millisecond)
+
+	name := fmt.Sprintf("%s.%s.%d", delayQueuePrefix, topic, tier)
+	if b.Config.Exchange != "" {
+		name = fmt.Sprintf("%s.%s.%s.%d", delayQueuePrefix, b.Config.Exchange, topic, tier)
+	}
+
+	_, err := ch.QueueDeclare(
+		name,             // name
+		b.Config.Durable, // durable
+		false,            // delete when unused
+		false,            // exclusive
+		false,            // no-wait
+		amqp.Table{
+			"x-dead-letter-exchange":    b.Config.Exchange,
+			"x-dead-letter-routing-key": topic,
+		},
+	)
+
+	if err != nil {
+		logger.Log().ErrorWithFields(logger.Fields{
+			"error":     err,
+			"queue":     name,
+			"component": componentName,
+		}, "Cannot create delay queue")
+	}
+
+	return name, err
+}
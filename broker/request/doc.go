@@ -0,0 +1,2 @@
+// Package request provides request/reply messaging over message broker.
+package request
@@ -0,0 +1,303 @@
+package request
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	quark "github.com/gkarlik/quark-go"
+	"github.com/gkarlik/quark-go/broker"
+	"github.com/gkarlik/quark-go/logger"
+	"github.com/gkarlik/quark-go/service/trace"
+	opentracing "github.com/opentracing/opentracing-go"
+	uuid "github.com/satori/go.uuid"
+)
+
+const (
+	// CorrelationIDKey defines message context key of identifier which correlates reply with request.
+	CorrelationIDKey = "correlation-id"
+	// ReplyToKey defines message context key of topic which reply should be published to.
+	ReplyToKey = "reply-to"
+	// ReplyErrorKey defines message context key of error returned by responder.
+	ReplyErrorKey = "reply-error"
+
+	componentName      = "MessageRequester"
+	defaultTimeout     = 30 * time.Second
+	replyTopicPrefix   = "reply."
+	requestSpanPrefix  = "request "
+	responseSpanPrefix = "reply "
+)
+
+// ErrTimeout is returned when reply is not received before timeout.
+var ErrTimeout = errors.New("Reply was not received before timeout")
+
+// Option represents function which is used to apply requester options.
+type Option func(*Options)
+
+// Options represents requester options.
+type Options struct {
+	Timeout    time.Duration   // default timeout of request if context does not have deadline
+	ReplyTopic string          // topic which replies are received from
+	Context    context.Context // context of reply subscription, it can carry subscription parameters
+}
+
+// Timeout allows to set default timeout of request which is used if request context does not have deadline. Default is 30 seconds.
+func Timeout(d time.Duration) Option {
+	return func(o *Options) {
+		o.Timeout = d
+	}
+}
+
+// ReplyTopic allows to set topic which replies are received from. It should be unique per requester.
+// By default unique topic with "reply." prefix is generated.
+func ReplyTopic(topic string) Option {
+	return func(o *Options) {
+		o.ReplyTopic = topic
+	}
+}
+
+// WithContext allows to set context of reply subscription (e.g. to pass subscription parameters to message broker).
+func WithContext(ctx context.Context) Option {
+	return func(o *Options) {
+		o.Context = ctx
+	}
+}
+
+// Requester is responsible for sending requests over service message broker and waiting for replies published by Responder.
+// Replies are received from single reply topic and matched with requests by correlation identifier.
+type Requester struct {
+	s    quark.Service // service
+	opts Options       // requester options
+
+	mu      sync.Mutex
+	pending map[string]chan broker.Message // requests waiting for reply by correlation identifier
+	cancel  context.CancelFunc
+}
+
+// NewRequester creates requester which uses service message broker and tracer. It subscribes to reply topic immediately
+// using temporary subscription (see broker.Temporary).
+func NewRequester(s quark.Service, opts ...Option) (*Requester, error) {
+	r := &Requester{
+		s: s,
+		opts: Options{
+			Timeout:    defaultTimeout,
+			ReplyTopic: replyTopicPrefix + uuid.NewV4().String(),
+			Context:    context.Background(),
+		},
+		pending: make(map[string]chan broker.Message),
+	}
+
+	for _, opt := range opts {
+		opt(&r.opts)
+	}
+
+	if s.Broker() == nil {
+		logger.Log().ErrorWithFields(logger.Fields{"component": componentName}, "Service does not have message broker")
+
+		return nil, fmt.Errorf("[%s]: Cannot create requester - service does not have message broker", componentName)
+	}
+
+	// reply topic is unique per requester, so resources created for reply subscription are deleted when requester is disposed
+	ctx, cancel := context.WithCancel(broker.Temporary(r.opts.Context))
+
+	replies, err := s.Broker().Subscribe(ctx, r.opts.ReplyTopic)
+	if err != nil {
+		cancel()
+
+		logger.Log().ErrorWithFields(logger.Fields{
+			"error":     err,
+			"topic":     r.opts.ReplyTopic,
+			"component": componentName,
+		}, "Cannot subscribe to reply topic")
+
+		return nil, err
+	}
+	r.cancel = cancel
+
+	go func() {
+		for m := range replies {
+			r.dispatch(m)
+		}
+	}()
+
+	return r, nil
+}
+
+// dispatch passes reply to request waiting for it.
+func (r *Requester) dispatch(m broker.Message) {
+	m.Ack()
+
+	id, _ := m.Context[CorrelationIDKey].(string)
+
+	r.mu.Lock()
+	ch, ok := r.pending[id]
+	delete(r.pending, id)
+	r.mu.Unlock()
+
+	if !ok {
+		logger.Log().WarningWithFields(logger.Fields{
+			"id":        id,
+			"topic":     m.Topic,
+			"component": componentName,
+		}, "Reply does not match any pending request")
+
+		return
+	}
+
+	ch <- m
+}
+
+// Request publishes request message to topic and waits for reply until context is done or timeout expires.
+// Correlation identifier, reply topic and tracing span are passed in message context. If responder returned an error,
+// reply is returned together with the error.
+func (r *Requester) Request(ctx context.Context, topic string, m broker.Message) (broker.Message, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.opts.Timeout)
+		defer cancel()
+	}
+
+	id := uuid.NewV4().String()
+
+	req := broker.Message{
+		Topic:   topic,
+		Value:   m.Value,
+		Context: broker.MessageContext{},
+	}
+	for k, v := range m.Context {
+		req.Context[k] = v
+	}
+	req.Context[CorrelationIDKey] = id
+	req.Context[ReplyToKey] = r.opts.ReplyTopic
+
+	if t := r.s.Tracer(); t != nil {
+		var span trace.Span
+		span, ctx = t.StartSpanFromContext(ctx, requestSpanPrefix+topic)
+		if span != nil {
+			defer span.Finish()
+
+			t.InjectSpan(span, opentracing.TextMap, quark.MessageContextCarrier{Context: &req.Context})
+		}
+	}
+
+	reply := make(chan broker.Message, 1)
+
+	r.mu.Lock()
+	r.pending[id] = reply
+	r.mu.Unlock()
+
+	if err := r.s.Broker().PublishMessage(ctx, req); err != nil {
+		r.forget(id)
+
+		logger.Log().ErrorWithFields(logger.Fields{
+			"error":     err,
+			"topic":     topic,
+			"component": componentName,
+		}, "Cannot publish request")
+
+		return broker.Message{}, err
+	}
+
+	select {
+	case m := <-reply:
+		if e, ok := m.Context[ReplyErrorKey].(string); ok && e != "" {
+			return m, errors.New(e)
+		}
+		return m, nil
+	case <-ctx.Done():
+		r.forget(id)
+
+		logger.Log().ErrorWithFields(logger.Fields{
+			"error":     ctx.Err(),
+			"id":        id,
+			"topic":     topic,
+			"component": componentName,
+		}, "Reply was not received")
+
+		if ctx.Err() == context.DeadlineExceeded {
+			return broker.Message{}, ErrTimeout
+		}
+		return broker.Message{}, ctx.Err()
+	}
+}
+
+func (r *Requester) forget(id string) {
+	r.mu.Lock()
+	delete(r.pending, id)
+	r.mu.Unlock()
+}
+
+// Dispose cancels subscription to reply topic.
+func (r *Requester) Dispose() {
+	logger.Log().InfoWithFields(logger.Fields{"component": componentName}, "Disposing requester")
+
+	r.cancel()
+}
+
+// ReplyHandler represents function which processes request and returns reply. Topic of reply is set by Responder.
+type ReplyHandler func(ctx context.Context, m broker.Message) (broker.Message, error)
+
+// Responder returns message handler which calls h and publishes its reply (or error) to reply topic of the request
+// using service message broker. Tracing span of the request is continued and passed with reply.
+func Responder(s quark.Service, h ReplyHandler) broker.Handler {
+	return func(ctx context.Context, m broker.Message) error {
+		replyTo, _ := m.Context[ReplyToKey].(string)
+		if replyTo == "" {
+			logger.Log().ErrorWithFields(logger.Fields{
+				"topic":     m.Topic,
+				"component": componentName,
+			}, "Message is not a request - reply topic is not set")
+
+			return fmt.Errorf("[%s]: Cannot reply to message - reply topic is not set", componentName)
+		}
+
+		var span trace.Span
+		if t := s.Tracer(); t != nil {
+			if span = t.SpanFromContext(ctx); span == nil {
+				span = quark.StartMessageSpan(s, responseSpanPrefix+m.Topic, m)
+				defer span.Finish()
+
+				ctx = t.ContextWithSpan(ctx, span)
+			}
+		}
+
+		reply, err := h(ctx, m)
+
+		rm := broker.Message{
+			Topic:   replyTo,
+			Value:   reply.Value,
+			Context: broker.MessageContext{},
+		}
+		for k, v := range reply.Context {
+			rm.Context[k] = v
+		}
+		rm.Context[CorrelationIDKey] = m.Context[CorrelationIDKey]
+
+		if err != nil {
+			rm.Context[ReplyErrorKey] = err.Error()
+
+			if span != nil {
+				span.SetTag("error", err.Error())
+			}
+		}
+
+		if span != nil {
+			s.Tracer().InjectSpan(span, opentracing.TextMap, quark.MessageContextCarrier{Context: &rm.Context})
+		}
+
+		// reply topic belongs to temporary subscription of requester
+		if err := s.Broker().PublishMessage(broker.Temporary(ctx), rm); err != nil {
+			logger.Log().ErrorWithFields(logger.Fields{
+				"error":     err,
+				"topic":     replyTo,
+				"component": componentName,
+			}, "Cannot publish reply")
+
+			return err
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,112 @@
+package request_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gkarlik/quark-go"
+	"github.com/gkarlik/quark-go/broker"
+	"github.com/gkarlik/quark-go/broker/memory"
+	"github.com/gkarlik/quark-go/broker/request"
+	tr "github.com/gkarlik/quark-go/service/trace/noop"
+	"github.com/stretchr/testify/assert"
+)
+
+type TestService struct {
+	*quark.ServiceBase
+}
+
+type TestPayload struct {
+	Text string `json:"text"`
+}
+
+func newTestService() *TestService {
+	a, _ := quark.GetHostAddress(1234)
+
+	return &TestService{
+		ServiceBase: quark.NewService(
+			quark.Name("TestService"),
+			quark.Version("1.0"),
+			quark.Address(a),
+			quark.Broker(memory.NewMessageBroker()),
+			quark.Tracer(tr.NewTracer())),
+	}
+}
+
+func respond(t *testing.T, s quark.Service, topic string, h request.ReplyHandler) context.CancelFunc {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	requests, err := s.Broker().Subscribe(ctx, topic)
+	assert.NoError(t, err, "Subscribe returned an error")
+
+	responder := request.Responder(s, h)
+	go func() {
+		for m := range requests {
+			responder(ctx, m)
+		}
+	}()
+
+	return cancel
+}
+
+func TestRequestReply(t *testing.T) {
+	topic := "TestRequestTopic"
+
+	ts := newTestService()
+	defer ts.Dispose()
+
+	cancel := respond(t, ts, topic, func(ctx context.Context, m broker.Message) (broker.Message, error) {
+		var payload TestPayload
+		if err := broker.Decode(m, &payload); err != nil {
+			return broker.Message{}, err
+		}
+
+		if payload.Text == "Fail" {
+			return broker.Message{}, errors.New("test error")
+		}
+
+		return broker.Message{Value: &TestPayload{Text: "Re: " + payload.Text}}, nil
+	})
+	defer cancel()
+
+	r, err := request.NewRequester(ts)
+	assert.NoError(t, err, "NewRequester returned an error")
+	defer r.Dispose()
+
+	reply, err := r.Request(context.Background(), topic, broker.Message{Value: &TestPayload{Text: "Test"}})
+	assert.NoError(t, err, "Request returned an error")
+	assert.NotEmpty(t, reply.Context[request.CorrelationIDKey])
+
+	var payload TestPayload
+	assert.NoError(t, broker.Decode(reply, &payload), "Decode returned an error")
+	assert.Equal(t, "Re: Test", payload.Text)
+
+	_, err = r.Request(context.Background(), topic, broker.Message{Value: &TestPayload{Text: "Fail"}})
+	assert.EqualError(t, err, "test error")
+}
+
+func TestRequestTimeout(t *testing.T) {
+	ts := newTestService()
+	defer ts.Dispose()
+
+	r, err := request.NewRequester(ts, request.Timeout(10*time.Millisecond))
+	assert.NoError(t, err, "NewRequester returned an error")
+	defer r.Dispose()
+
+	_, err = r.Request(context.Background(), "TestRequestTopic", broker.Message{Value: 1})
+	assert.Equal(t, request.ErrTimeout, err)
+}
+
+func TestResponderWithoutReplyTopic(t *testing.T) {
+	ts := newTestService()
+	defer ts.Dispose()
+
+	h := request.Responder(ts, func(ctx context.Context, m broker.Message) (broker.Message, error) {
+		return broker.Message{}, nil
+	})
+
+	err := h(context.Background(), broker.Message{Topic: "TestRequestTopic", Value: 1})
+	assert.Error(t, err, "Responder should return an error")
+}
@@ -0,0 +1,2 @@
+// Package router provides message handler framework which routes messages received from message broker to handlers registered per topic.
+package router
@@ -0,0 +1,280 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	quark "github.com/gkarlik/quark-go"
+	"github.com/gkarlik/quark-go/broker"
+	"github.com/gkarlik/quark-go/logger"
+	"github.com/gkarlik/quark-go/metrics"
+	"github.com/gkarlik/quark-go/service/trace"
+)
+
+const (
+	componentName  = "MessageRouter"
+	defaultWorkers = 10
+
+	processingTimeMetricName = "message_processing_time"
+	processingTimeMetricDesc = "Message processing time in seconds"
+	errorsMetricName         = "message_processing_errors"
+	errorsMetricDesc         = "Number of messages which could not be processed"
+)
+
+var defaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Option represents function which is used to apply message router options.
+type Option func(*Options)
+
+// Options represents message router options.
+type Options struct {
+	Workers int       // number of workers which process messages concurrently
+	Requeue bool      // indicates if rejected messages are requeued for redelivery
+	Buckets []float64 // buckets of processing time histograms (in seconds)
+}
+
+// Workers allows to set number of workers which process messages concurrently. Default is 10 workers.
+// Messages are processed in order they were received only if there is single worker.
+func Workers(n int) Option {
+	return func(o *Options) {
+		o.Workers = n
+	}
+}
+
+// Requeue allows to set if messages which cannot be processed are requeued when they are rejected. Default is true.
+// It has effect only if subscription uses manual acknowledgement. If message broker does not support requeue (e.g. Kafka),
+// messages are rejected without requeue.
+func Requeue(requeue bool) Option {
+	return func(o *Options) {
+		o.Requeue = requeue
+	}
+}
+
+// Buckets allows to set buckets of processing time histograms (in seconds).
+func Buckets(buckets []float64) Option {
+	return func(o *Options) {
+		o.Buckets = buckets
+	}
+}
+
+// route represents handler registered for the topic.
+type route struct {
+	topic          string            // message topic
+	handler        broker.Handler    // message handler
+	processingTime metrics.Histogram // message processing time
+	errors         metrics.Counter   // number of processing errors
+}
+
+// job represents message which waits for processing.
+type job struct {
+	route   *route         // message route
+	message broker.Message // received message
+}
+
+// Router is responsible for routing messages received from service message broker to handlers registered per topic.
+// Messages are processed by pool of workers. Each message is traced (if service has tracer), processing time and
+// number of errors are reported per topic (if service has metrics exposer) and panics in handlers are recovered.
+type Router struct {
+	s    quark.Service // service
+	opts Options       // router options
+
+	mu     sync.Mutex
+	routes map[string]*route
+}
+
+// NewRouter creates instance of message router which uses service message broker, tracer and metrics exposer.
+func NewRouter(s quark.Service, opts ...Option) *Router {
+	r := &Router{
+		s: s,
+		opts: Options{
+			Workers: defaultWorkers,
+			Requeue: true,
+			Buckets: defaultBuckets,
+		},
+		routes: make(map[string]*route),
+	}
+
+	for _, opt := range opts {
+		opt(&r.opts)
+	}
+
+	return r
+}
+
+// Handle registers handler for messages with specified topic. Handler registered for the same topic again replaces previous one.
+// Handlers must be registered before router is run.
+func (r *Router) Handle(topic string, h broker.Handler) {
+	rt := &route{
+		topic:   topic,
+		handler: h,
+	}
+
+	if m := r.s.Metrics(); m != nil {
+		rt.processingTime = m.CreateHistogram(broker.MetricName(processingTimeMetricName, topic), processingTimeMetricDesc, r.opts.Buckets)
+		rt.errors = m.CreateCounter(broker.MetricName(errorsMetricName, topic), errorsMetricDesc)
+	}
+
+	r.mu.Lock()
+	r.routes[topic] = rt
+	r.mu.Unlock()
+}
+
+// Run subscribes to topics of all registered handlers and processes received messages until context is done or all
+// subscriptions are closed. Context is passed to MessageBroker.Subscribe, so it can carry subscription parameters
+// (e.g. broker.ManualAck). Processed messages are acknowledged and messages which cannot be processed are rejected.
+func (r *Router) Run(ctx context.Context) error {
+	if r.s.Broker() == nil {
+		logger.Log().ErrorWithFields(logger.Fields{"component": componentName}, "Service does not have message broker")
+
+		return fmt.Errorf("[%s]: Cannot run message router - service does not have message broker", componentName)
+	}
+
+	r.mu.Lock()
+	routes := make([]*route, 0, len(r.routes))
+	for _, rt := range r.routes {
+		routes = append(routes, rt)
+	}
+	r.mu.Unlock()
+
+	if len(routes) == 0 {
+		logger.Log().ErrorWithFields(logger.Fields{"component": componentName}, "No message handlers registered")
+
+		return fmt.Errorf("[%s]: Cannot run message router - no message handlers registered", componentName)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan job)
+
+	var subscriptions sync.WaitGroup
+	for _, rt := range routes {
+		messages, err := r.s.Broker().Subscribe(ctx, rt.topic)
+		if err != nil {
+			logger.Log().ErrorWithFields(logger.Fields{
+				"error":     err,
+				"topic":     rt.topic,
+				"component": componentName,
+			}, "Cannot subscribe to messages")
+
+			cancel()
+			subscriptions.Wait()
+			return err
+		}
+
+		subscriptions.Add(1)
+		go func(rt *route, messages <-chan broker.Message) {
+			defer subscriptions.Done()
+
+			for m := range messages {
+				select {
+				case jobs <- job{route: rt, message: m}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(rt, messages)
+	}
+
+	logger.Log().InfoWithFields(logger.Fields{
+		"topics":    len(routes),
+		"workers":   r.opts.Workers,
+		"component": componentName,
+	}, "Message router started")
+
+	var workers sync.WaitGroup
+	for i := 0; i < r.opts.Workers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+
+			for j := range jobs {
+				r.process(ctx, j.route, j.message)
+			}
+		}()
+	}
+
+	subscriptions.Wait()
+	close(jobs)
+	workers.Wait()
+
+	logger.Log().InfoWithFields(logger.Fields{"component": componentName}, "Message router stopped")
+
+	return nil
+}
+
+func (r *Router) process(ctx context.Context, rt *route, m broker.Message) {
+	var span trace.Span
+	if t := r.s.Tracer(); t != nil {
+		span = quark.StartMessageSpan(r.s, rt.topic, m)
+		defer span.Finish()
+
+		ctx = t.ContextWithSpan(ctx, span)
+	}
+
+	start := time.Now()
+	err := call(ctx, rt.handler, m)
+
+	if rt.processingTime != nil {
+		rt.processingTime.Observe(time.Since(start).Seconds())
+	}
+
+	if err != nil {
+		if rt.errors != nil {
+			rt.errors.Inc()
+		}
+		if span != nil {
+			span.SetTag("error", err.Error())
+		}
+
+		logger.Log().ErrorWithFields(logger.Fields{
+			"error":     err,
+			"topic":     rt.topic,
+			"component": componentName,
+		}, "Cannot process message")
+
+		err := m.Nack(r.opts.Requeue)
+		if err == broker.ErrRequeueNotSupported {
+			logger.Log().WarningWithFields(logger.Fields{
+				"topic":     rt.topic,
+				"component": componentName,
+			}, "Message broker does not support requeue - message is rejected without requeue")
+
+			err = m.Nack(false)
+		}
+		if err != nil {
+			logger.Log().ErrorWithFields(logger.Fields{
+				"error":     err,
+				"topic":     rt.topic,
+				"component": componentName,
+			}, "Cannot reject message")
+		}
+		return
+	}
+
+	if err := m.Ack(); err != nil {
+		logger.Log().ErrorWithFields(logger.Fields{
+			"error":     err,
+			"topic":     rt.topic,
+			"component": componentName,
+		}, "Cannot acknowledge message")
+	}
+}
+
+// call calls message handler and recovers from panic error in handler.
+func call(ctx context.Context, h broker.Handler, m broker.Message) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			logger.Log().ErrorWithFields(logger.Fields{
+				"component": componentName,
+				"err":       p,
+			}, "Recovered from panic error in handler")
+
+			err = fmt.Errorf("[%s]: Panic error in handler: %v", componentName, p)
+		}
+	}()
+
+	return h(ctx, m)
+}
@@ -0,0 +1,236 @@
+package router_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/gkarlik/quark-go"
+	"github.com/gkarlik/quark-go/broker"
+	"github.com/gkarlik/quark-go/broker/kafka"
+	"github.com/gkarlik/quark-go/broker/memory"
+	"github.com/gkarlik/quark-go/broker/router"
+	"github.com/gkarlik/quark-go/metrics/prometheus"
+	tr "github.com/gkarlik/quark-go/service/trace/noop"
+	"github.com/stretchr/testify/assert"
+)
+
+type TestService struct {
+	*quark.ServiceBase
+}
+
+type TestPayload struct {
+	Text string `json:"text"`
+}
+
+// TestBroker signals when router subscribes to the topic.
+type TestBroker struct {
+	*memory.MessageBroker
+
+	subscribed sync.WaitGroup
+}
+
+func (b *TestBroker) Subscribe(ctx context.Context, topic string) (<-chan broker.Message, error) {
+	defer b.subscribed.Done()
+
+	return b.MessageBroker.Subscribe(ctx, topic)
+}
+
+// KafkaAcknowledger rejects requeue like Kafka message broker and records rejected messages.
+type KafkaAcknowledger struct {
+	nacked chan bool
+}
+
+func (a KafkaAcknowledger) Ack() error {
+	return nil
+}
+
+func (a KafkaAcknowledger) Nack(requeue bool) error {
+	if requeue {
+		return kafka.ErrRequeueNotSupported
+	}
+	a.nacked <- true
+	return nil
+}
+
+// KafkaBroker delivers messages with KafkaAcknowledger.
+type KafkaBroker struct {
+	*TestBroker
+
+	nacked chan bool
+}
+
+func (b *KafkaBroker) Subscribe(ctx context.Context, topic string) (<-chan broker.Message, error) {
+	messages, err := b.TestBroker.Subscribe(ctx, topic)
+	if err != nil {
+		return nil, err
+	}
+
+	mgs := make(chan broker.Message)
+	go func() {
+		defer close(mgs)
+
+		for m := range messages {
+			m.Acknowledger = KafkaAcknowledger{nacked: b.nacked}
+
+			select {
+			case mgs <- m:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return mgs, nil
+}
+
+func newTestService(b broker.MessageBroker) *TestService {
+	a, _ := quark.GetHostAddress(1234)
+
+	return &TestService{
+		ServiceBase: quark.NewService(
+			quark.Name("TestService"),
+			quark.Version("1.0"),
+			quark.Address(a),
+			quark.Broker(b),
+			quark.Metrics(prometheus.NewMetricsExposer()),
+			quark.Tracer(tr.NewTracer())),
+	}
+}
+
+func run(r *router.Router) (context.CancelFunc, <-chan error) {
+	ctx, cancel := context.WithCancel(broker.ManualAck(context.Background()))
+
+	done := make(chan error)
+	go func() {
+		done <- r.Run(ctx)
+	}()
+
+	return cancel, done
+}
+
+func TestRouter(t *testing.T) {
+	topics := []string{"TestTopic.First", "TestTopic.Second"}
+
+	b := &TestBroker{MessageBroker: memory.NewMessageBroker()}
+	b.subscribed.Add(len(topics))
+
+	ts := newTestService(b)
+	defer ts.Dispose()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	received := map[string]string{}
+
+	r := router.NewRouter(ts, router.Workers(2))
+	for _, topic := range topics {
+		r.Handle(topic, func(ctx context.Context, m broker.Message) error {
+			defer wg.Done()
+
+			var payload TestPayload
+			if err := broker.Decode(m, &payload); err != nil {
+				return err
+			}
+
+			mu.Lock()
+			received[m.Topic] = payload.Text
+			mu.Unlock()
+
+			return nil
+		})
+	}
+
+	cancel, done := run(r)
+	b.subscribed.Wait()
+
+	wg.Add(len(topics))
+	for _, topic := range topics {
+		err := ts.Broker().PublishMessage(context.Background(), broker.Message{Topic: topic, Value: &TestPayload{Text: topic}})
+		assert.NoError(t, err, "Publish returned an error")
+	}
+	wg.Wait()
+
+	cancel()
+	assert.NoError(t, <-done, "Run returned an error")
+	assert.Equal(t, map[string]string{"TestTopic.First": "TestTopic.First", "TestTopic.Second": "TestTopic.Second"}, received)
+}
+
+func TestRouterFailures(t *testing.T) {
+	topic := "TestTopic"
+
+	b := &TestBroker{MessageBroker: memory.NewMessageBroker()}
+	b.subscribed.Add(1)
+
+	ts := newTestService(b)
+	defer ts.Dispose()
+
+	calls := make(chan int, 3)
+	count := 0
+
+	r := router.NewRouter(ts, router.Workers(1))
+	r.Handle(topic, func(ctx context.Context, m broker.Message) error {
+		count++
+		calls <- count
+
+		switch count {
+		case 1:
+			panic("test panic")
+		case 2:
+			return errors.New("test error")
+		}
+		return nil
+	})
+
+	cancel, done := run(r)
+	b.subscribed.Wait()
+
+	err := ts.Broker().PublishMessage(context.Background(), broker.Message{Topic: topic, Value: 1})
+	assert.NoError(t, err, "Publish returned an error")
+
+	// message is requeued after panic and error until it is processed
+	assert.Equal(t, 1, <-calls)
+	assert.Equal(t, 2, <-calls)
+	assert.Equal(t, 3, <-calls)
+
+	cancel()
+	assert.NoError(t, <-done, "Run returned an error")
+}
+
+func TestRouterErrors(t *testing.T) {
+	b := memory.NewMessageBroker()
+	ts := newTestService(b)
+	defer ts.Dispose()
+
+	r := router.NewRouter(ts)
+	assert.Error(t, r.Run(context.Background()), "Run should return an error")
+
+	r.Handle("", func(ctx context.Context, m broker.Message) error { return nil })
+	assert.Error(t, r.Run(context.Background()), "Run should return an error")
+}
+
+func TestRouterRequeueNotSupported(t *testing.T) {
+	topic := "TestTopic"
+
+	b := &KafkaBroker{TestBroker: &TestBroker{MessageBroker: memory.NewMessageBroker()}, nacked: make(chan bool, 1)}
+	b.subscribed.Add(1)
+
+	ts := newTestService(b)
+	defer ts.Dispose()
+
+	r := router.NewRouter(ts, router.Workers(1))
+	r.Handle(topic, func(ctx context.Context, m broker.Message) error {
+		return errors.New("test error")
+	})
+
+	cancel, done := run(r)
+	b.subscribed.Wait()
+
+	err := ts.Broker().PublishMessage(context.Background(), broker.Message{Topic: topic, Value: 1})
+	assert.NoError(t, err, "Publish returned an error")
+
+	// message is rejected without requeue, so its offset is marked
+	assert.True(t, <-b.nacked)
+
+	cancel()
+	assert.NoError(t, <-done, "Run returned an error")
+}
@@ -0,0 +1,154 @@
+package schema
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Compatibility represents compatibility which is required between consecutive versions of schema.
+type Compatibility int
+
+const (
+	// CompatibilityNone does not check compatibility of schema versions.
+	CompatibilityNone Compatibility = iota
+	// CompatibilityBackward requires that consumers using new schema can read messages validated with previous schema.
+	CompatibilityBackward
+	// CompatibilityForward requires that consumers using previous schema can read messages validated with new schema.
+	CompatibilityForward
+	// CompatibilityFull requires both backward and forward compatibility.
+	CompatibilityFull
+)
+
+// String returns name of the compatibility.
+func (c Compatibility) String() string {
+	switch c {
+	case CompatibilityNone:
+		return "none"
+	case CompatibilityBackward:
+		return "backward"
+	case CompatibilityForward:
+		return "forward"
+	case CompatibilityFull:
+		return "full"
+	}
+	return fmt.Sprintf("unknown compatibility: %d", c)
+}
+
+// CheckCompatibility checks if new version of schema is compatible with previous version. It returns an error which
+// lists all incompatible changes.
+func CheckCompatibility(previous, next *Schema, c Compatibility) error {
+	var problems []string
+
+	if c == CompatibilityBackward || c == CompatibilityFull {
+		problems = append(problems, readable("$", next, previous)...)
+	}
+	if c == CompatibilityForward || c == CompatibilityFull {
+		problems = append(problems, readable("$", previous, next)...)
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("[%s]: Schema is not %s compatible: %s", componentName, c, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// readable returns list of reasons why value valid for writer schema may be invalid for reader schema
+// (restrictions of reader schema are reported). Properties listed only by reader schema are checked too, unless writer
+// schema does not allow additional properties.
+func readable(path string, reader, writer *Schema) []string {
+	var problems []string
+
+	if len(reader.Type) > 0 {
+		if len(writer.Type) == 0 {
+			problems = append(problems, fmt.Sprintf("%s: type is restricted to %s", path, strings.Join(reader.Type, " or ")))
+		} else {
+			for _, t := range writer.Type {
+				if !allows(reader.Type, t) {
+					problems = append(problems, fmt.Sprintf("%s: type %s is not allowed", path, t))
+				}
+			}
+		}
+	}
+
+	if len(reader.Enum) > 0 {
+		if len(writer.Enum) == 0 {
+			problems = append(problems, fmt.Sprintf("%s: values are restricted to enumerated values", path))
+		}
+		for _, e := range writer.Enum {
+			if !contains(reader.Enum, e) {
+				problems = append(problems, fmt.Sprintf("%s: enumerated value %v is not allowed", path, e))
+			}
+		}
+	}
+
+	if reader.Minimum != nil && (writer.Minimum == nil || *writer.Minimum < *reader.Minimum) {
+		problems = append(problems, fmt.Sprintf("%s: minimum is more restrictive", path))
+	}
+	if reader.Maximum != nil && (writer.Maximum == nil || *writer.Maximum > *reader.Maximum) {
+		problems = append(problems, fmt.Sprintf("%s: maximum is more restrictive", path))
+	}
+	if reader.MinLength != nil && (writer.MinLength == nil || *writer.MinLength < *reader.MinLength) {
+		problems = append(problems, fmt.Sprintf("%s: minimum length is more restrictive", path))
+	}
+	if reader.MaxLength != nil && (writer.MaxLength == nil || *writer.MaxLength > *reader.MaxLength) {
+		problems = append(problems, fmt.Sprintf("%s: maximum length is more restrictive", path))
+	}
+
+	for _, name := range reader.Required {
+		if !contains(writer.Required, name) {
+			problems = append(problems, fmt.Sprintf("%s: property %q is required", path, name))
+		}
+	}
+
+	if reader.AdditionalProperties != nil && !*reader.AdditionalProperties {
+		for _, name := range names(writer.Properties) {
+			if _, ok := reader.Properties[name]; !ok {
+				problems = append(problems, fmt.Sprintf("%s: property %q is not allowed", path, name))
+			}
+		}
+		if writer.AdditionalProperties == nil || *writer.AdditionalProperties {
+			problems = append(problems, fmt.Sprintf("%s: additional properties are not allowed", path))
+		}
+	}
+
+	for _, name := range names(reader.Properties) {
+		if wp, ok := writer.Properties[name]; ok {
+			problems = append(problems, readable(path+"."+name, reader.Properties[name], wp)...)
+		} else if writer.AdditionalProperties == nil || *writer.AdditionalProperties {
+			// writer allows any value of property which is not listed, so its restrictions are checked against empty schema
+			problems = append(problems, readable(path+"."+name, reader.Properties[name], &Schema{})...)
+		}
+	}
+
+	if reader.Items != nil {
+		if writer.Items == nil {
+			problems = append(problems, fmt.Sprintf("%s: array items are restricted", path))
+		} else {
+			problems = append(problems, readable(path+"[]", reader.Items, writer.Items)...)
+		}
+	}
+
+	return problems
+}
+
+// names returns sorted names of properties.
+func names(properties map[string]*Schema) []string {
+	n := make([]string, 0, len(properties))
+	for name := range properties {
+		n = append(n, name)
+	}
+	sort.Strings(n)
+	return n
+}
+
+func contains(values interface{}, v interface{}) bool {
+	rv := reflect.ValueOf(values)
+	for i := 0; i < rv.Len(); i++ {
+		if reflect.DeepEqual(rv.Index(i).Interface(), v) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+package schema_test
+
+import (
+	"testing"
+
+	"github.com/gkarlik/quark-go/broker/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+func parse(t *testing.T, s string) *schema.Schema {
+	sc, err := schema.Parse([]byte(s))
+	assert.NoError(t, err, "Parse returned an error")
+	return sc
+}
+
+func TestCheckCompatibility(t *testing.T) {
+	v1 := parse(t, `{"type": "object", "properties": {"id": {"type": "integer"}}, "required": ["id"]}`)
+
+	// new optional property of any type
+	untyped := parse(t, `{"type": "object", "properties": {"id": {"type": "integer"}, "name": {}}, "required": ["id"]}`)
+	assert.NoError(t, schema.CheckCompatibility(v1, untyped, schema.CompatibilityFull))
+
+	// new optional property with restricted type - old messages may contain the property with any value
+	optional := parse(t, `{"type": "object", "properties": {"id": {"type": "integer"}, "x": {"type": "integer"}}, "required": ["id"]}`)
+	assert.Error(t, schema.CheckCompatibility(v1, optional, schema.CompatibilityBackward))
+	assert.NoError(t, schema.CheckCompatibility(v1, optional, schema.CompatibilityForward))
+
+	// new optional property is backward compatible if previous schema does not allow additional properties
+	closed := parse(t, `{"type": "object", "properties": {"id": {"type": "integer"}}, "required": ["id"], "additionalProperties": false}`)
+	assert.NoError(t, schema.CheckCompatibility(closed, optional, schema.CompatibilityBackward))
+	assert.Error(t, schema.CheckCompatibility(closed, optional, schema.CompatibilityForward))
+
+	// new required property - consumers cannot read old messages
+	required := parse(t, `{"type": "object", "properties": {"id": {"type": "integer"}, "name": {"type": "string"}}, "required": ["id", "name"]}`)
+	assert.Error(t, schema.CheckCompatibility(v1, required, schema.CompatibilityBackward))
+	assert.NoError(t, schema.CheckCompatibility(v1, required, schema.CompatibilityForward))
+
+	// removed required property - old consumers cannot read new messages
+	removed := parse(t, `{"type": "object", "properties": {"id": {"type": "integer"}}}`)
+	assert.NoError(t, schema.CheckCompatibility(v1, removed, schema.CompatibilityBackward))
+	assert.Error(t, schema.CheckCompatibility(v1, removed, schema.CompatibilityForward))
+
+	// widened type
+	widened := parse(t, `{"type": "object", "properties": {"id": {"type": "number"}}, "required": ["id"]}`)
+	assert.NoError(t, schema.CheckCompatibility(v1, widened, schema.CompatibilityBackward))
+	assert.Error(t, schema.CheckCompatibility(v1, widened, schema.CompatibilityForward))
+	assert.Error(t, schema.CheckCompatibility(v1, widened, schema.CompatibilityFull))
+
+	// changed type is accepted only without compatibility check
+	changed := parse(t, `{"type": "object", "properties": {"id": {"type": "string"}}, "required": ["id"]}`)
+	assert.Error(t, schema.CheckCompatibility(v1, changed, schema.CompatibilityBackward))
+	assert.NoError(t, schema.CheckCompatibility(v1, changed, schema.CompatibilityNone))
+}
+
+func TestCompatibilityString(t *testing.T) {
+	assert.Equal(t, "backward", schema.CompatibilityBackward.String())
+	assert.Equal(t, "full", schema.CompatibilityFull.String())
+}
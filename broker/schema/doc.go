@@ -0,0 +1,2 @@
+// Package schema provides registry of versioned JSON Schemas of message values per topic and schema compatibility checks.
+package schema
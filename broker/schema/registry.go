@@ -0,0 +1,246 @@
+package schema
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gkarlik/quark-go/logger"
+)
+
+const (
+	registryComponentName = "SchemaRegistry"
+	schemaFileExtension   = ".json"
+)
+
+// ErrNotFound is returned when schema of the topic (or its version) is not registered.
+var ErrNotFound = errors.New("Schema is not registered")
+
+// Registry represents registry of versioned message schemas per topic.
+type Registry interface {
+	Register(topic string, schema []byte) (int, error) // registers new version of topic schema, returns version number
+	Schema(topic string, version int) (*Schema, error) // returns version of topic schema
+	Latest(topic string) (*Schema, int, error)         // returns latest version of topic schema
+}
+
+// Option represents function which is used to apply schema registry options.
+type Option func(*Options)
+
+// Options represents schema registry options.
+type Options struct {
+	Directory     string        // directory which schemas are stored in, schemas are kept only in memory if empty
+	Compatibility Compatibility // compatibility required between consecutive versions of schema
+}
+
+// Directory allows to set directory which schemas are stored in. Schemas are loaded from directory when registry is created.
+func Directory(dir string) Option {
+	return func(o *Options) {
+		o.Directory = dir
+	}
+}
+
+// CompatibilityMode allows to set compatibility which is required between consecutive versions of schema. Default is backward compatibility.
+func CompatibilityMode(c Compatibility) Option {
+	return func(o *Options) {
+		o.Compatibility = c
+	}
+}
+
+// LocalRegistry represents schema registry kept in process memory and optionally stored in directory
+// (one file per schema version: <directory>/<topic>/<version>.json).
+type LocalRegistry struct {
+	opts Options // registry options
+
+	mu      sync.RWMutex
+	schemas map[string][]*Schema // versions of schemas per topic, version 1 is the first element
+}
+
+// NewLocalRegistry creates schema registry. If directory is set, schemas stored in directory are loaded.
+func NewLocalRegistry(opts ...Option) (*LocalRegistry, error) {
+	r := &LocalRegistry{
+		opts: Options{
+			Compatibility: CompatibilityBackward,
+		},
+		schemas: make(map[string][]*Schema),
+	}
+
+	for _, opt := range opts {
+		opt(&r.opts)
+	}
+
+	if r.opts.Directory != "" {
+		if err := r.load(); err != nil {
+			logger.Log().ErrorWithFields(logger.Fields{
+				"error":     err,
+				"directory": r.opts.Directory,
+				"component": registryComponentName,
+			}, "Cannot load schemas")
+
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+// Register registers new version of topic schema and returns its version number. Schema must be compatible with the latest
+// version according to registry compatibility. If schema is the same as the latest version, latest version number is returned.
+func (r *LocalRegistry) Register(topic string, schema []byte) (int, error) {
+	if topic == "" {
+		return 0, fmt.Errorf("[%s]: Cannot register schema - topic cannot be empty", registryComponentName)
+	}
+
+	s, err := Parse(schema)
+	if err != nil {
+		return 0, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	versions := r.schemas[topic]
+	if n := len(versions); n > 0 {
+		latest := versions[n-1]
+		if bytes.Equal(latest.raw, schema) {
+			return n, nil
+		}
+
+		if err := CheckCompatibility(latest, s, r.opts.Compatibility); err != nil {
+			logger.Log().ErrorWithFields(logger.Fields{
+				"error":     err,
+				"topic":     topic,
+				"version":   n + 1,
+				"component": registryComponentName,
+			}, "Cannot register incompatible schema")
+
+			return 0, err
+		}
+	}
+
+	version := len(versions) + 1
+
+	if r.opts.Directory != "" {
+		if err := r.store(topic, version, schema); err != nil {
+			logger.Log().ErrorWithFields(logger.Fields{
+				"error":     err,
+				"topic":     topic,
+				"version":   version,
+				"component": registryComponentName,
+			}, "Cannot store schema")
+
+			return 0, err
+		}
+	}
+
+	r.schemas[topic] = append(versions, s)
+
+	logger.Log().InfoWithFields(logger.Fields{
+		"topic":     topic,
+		"version":   version,
+		"component": registryComponentName,
+	}, "Schema registered")
+
+	return version, nil
+}
+
+// Schema returns version of topic schema. It returns ErrNotFound if version is not registered.
+func (r *LocalRegistry) Schema(topic string, version int) (*Schema, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	versions := r.schemas[topic]
+	if version < 1 || version > len(versions) {
+		return nil, ErrNotFound
+	}
+	return versions[version-1], nil
+}
+
+// Latest returns latest version of topic schema and its version number. It returns ErrNotFound if topic does not have schema.
+func (r *LocalRegistry) Latest(topic string) (*Schema, int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	versions := r.schemas[topic]
+	if len(versions) == 0 {
+		return nil, 0, ErrNotFound
+	}
+	return versions[len(versions)-1], len(versions), nil
+}
+
+// store writes schema version to file. File is written to temporary file first, so partially written schema is never loaded.
+func (r *LocalRegistry) store(topic string, version int, schema []byte) error {
+	dir := filepath.Join(r.opts.Directory, url.PathEscape(topic))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	name := filepath.Join(dir, strconv.Itoa(version)+schemaFileExtension)
+	tmp := name + ".tmp"
+
+	if err := ioutil.WriteFile(tmp, schema, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+// load reads all schemas stored in directory.
+func (r *LocalRegistry) load() error {
+	dirs, err := ioutil.ReadDir(r.opts.Directory)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+
+		topic, err := url.PathUnescape(d.Name())
+		if err != nil {
+			return err
+		}
+
+		files, err := ioutil.ReadDir(filepath.Join(r.opts.Directory, d.Name()))
+		if err != nil {
+			return err
+		}
+
+		var versions []int
+		for _, f := range files {
+			if v, err := strconv.Atoi(strings.TrimSuffix(f.Name(), schemaFileExtension)); err == nil && strings.HasSuffix(f.Name(), schemaFileExtension) {
+				versions = append(versions, v)
+			}
+		}
+		sort.Ints(versions)
+
+		for i, v := range versions {
+			if v != i+1 {
+				return fmt.Errorf("[%s]: Cannot load schemas of topic %q - version %d is missing", registryComponentName, topic, i+1)
+			}
+
+			data, err := ioutil.ReadFile(filepath.Join(r.opts.Directory, d.Name(), strconv.Itoa(v)+schemaFileExtension))
+			if err != nil {
+				return err
+			}
+
+			s, err := Parse(data)
+			if err != nil {
+				return err
+			}
+			r.schemas[topic] = append(r.schemas[topic], s)
+		}
+	}
+
+	return nil
+}
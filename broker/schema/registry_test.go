@@ -0,0 +1,84 @@
+package schema_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/gkarlik/quark-go/broker/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	v1 = `{"type": "object", "properties": {"id": {"type": "integer"}}, "required": ["id"], "additionalProperties": false}`
+	v2 = `{"type": "object", "properties": {"id": {"type": "integer"}, "name": {"type": "string"}}, "required": ["id"]}`
+)
+
+func TestRegistry(t *testing.T) {
+	topic := "TestTopic"
+
+	r, err := schema.NewLocalRegistry()
+	assert.NoError(t, err, "NewLocalRegistry returned an error")
+
+	_, _, err = r.Latest(topic)
+	assert.Equal(t, schema.ErrNotFound, err)
+
+	version, err := r.Register(topic, []byte(v1))
+	assert.NoError(t, err, "Register returned an error")
+	assert.Equal(t, 1, version)
+
+	// the same schema is not registered again
+	version, err = r.Register(topic, []byte(v1))
+	assert.NoError(t, err, "Register returned an error")
+	assert.Equal(t, 1, version)
+
+	version, err = r.Register(topic, []byte(v2))
+	assert.NoError(t, err, "Register returned an error")
+	assert.Equal(t, 2, version)
+
+	// incompatible schema
+	_, err = r.Register(topic, []byte(`{"type": "string"}`))
+	assert.Error(t, err, "Register should return an error")
+
+	s, version, err := r.Latest(topic)
+	assert.NoError(t, err, "Latest returned an error")
+	assert.Equal(t, 2, version)
+	assert.Equal(t, v2, string(s.Bytes()))
+
+	s, err = r.Schema(topic, 1)
+	assert.NoError(t, err, "Schema returned an error")
+	assert.Equal(t, v1, string(s.Bytes()))
+
+	_, err = r.Schema(topic, 3)
+	assert.Equal(t, schema.ErrNotFound, err)
+
+	_, err = r.Register("", []byte(v1))
+	assert.Error(t, err, "Register should return an error")
+}
+
+func TestFileRegistry(t *testing.T) {
+	topic := "TestTopic/Orders"
+
+	dir, err := ioutil.TempDir("", "schemas")
+	assert.NoError(t, err, "TempDir returned an error")
+	defer os.RemoveAll(dir)
+
+	r, err := schema.NewLocalRegistry(schema.Directory(dir), schema.CompatibilityMode(schema.CompatibilityNone))
+	assert.NoError(t, err, "NewLocalRegistry returned an error")
+
+	r.Register(topic, []byte(v1))
+	r.Register(topic, []byte(`{"type": "string"}`))
+
+	// schemas are loaded from directory
+	r, err = schema.NewLocalRegistry(schema.Directory(dir))
+	assert.NoError(t, err, "NewLocalRegistry returned an error")
+
+	s, version, err := r.Latest(topic)
+	assert.NoError(t, err, "Latest returned an error")
+	assert.Equal(t, 2, version)
+	assert.Equal(t, `{"type": "string"}`, string(s.Bytes()))
+
+	s, err = r.Schema(topic, 1)
+	assert.NoError(t, err, "Schema returned an error")
+	assert.Equal(t, v1, string(s.Bytes()))
+}
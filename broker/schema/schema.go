@@ -0,0 +1,246 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// VersionKey defines message context key of schema version which message value was validated with.
+	VersionKey = "schema-version"
+
+	componentName = "MessageSchema"
+)
+
+// Schema represents JSON Schema of message value. Supported keywords are: type, properties, required, additionalProperties
+// (boolean only), items, enum, minimum, maximum, minLength and maxLength. Other keywords are ignored.
+type Schema struct {
+	Type                 []string           // allowed value types, any type is allowed if empty
+	Properties           map[string]*Schema // schemas of object properties
+	Required             []string           // names of required object properties
+	AdditionalProperties *bool              // indicates if object properties which are not listed are allowed (nil means allowed)
+	Items                *Schema            // schema of array items
+	Enum                 []interface{}      // allowed values
+	Minimum              *float64           // minimum value of number
+	Maximum              *float64           // maximum value of number
+	MinLength            *int               // minimum length of string
+	MaxLength            *int               // maximum length of string
+
+	raw []byte // schema document
+}
+
+// document represents JSON Schema document.
+type document struct {
+	Type                 json.RawMessage            `json:"type"`
+	Properties           map[string]json.RawMessage `json:"properties"`
+	Required             []string                   `json:"required"`
+	AdditionalProperties json.RawMessage            `json:"additionalProperties"`
+	Items                json.RawMessage            `json:"items"`
+	Enum                 []interface{}              `json:"enum"`
+	Minimum              *float64                   `json:"minimum"`
+	Maximum              *float64                   `json:"maximum"`
+	MinLength            *int                       `json:"minLength"`
+	MaxLength            *int                       `json:"maxLength"`
+}
+
+// Parse parses JSON Schema document.
+func Parse(data []byte) (*Schema, error) {
+	var d document
+	if err := json.Unmarshal(data, &d); err != nil {
+		return nil, fmt.Errorf("[%s]: Cannot parse schema: %s", componentName, err)
+	}
+
+	s := &Schema{
+		Required:  d.Required,
+		Enum:      d.Enum,
+		Minimum:   d.Minimum,
+		Maximum:   d.Maximum,
+		MinLength: d.MinLength,
+		MaxLength: d.MaxLength,
+		raw:       data,
+	}
+
+	if len(d.Type) > 0 {
+		var t string
+		if err := json.Unmarshal(d.Type, &t); err == nil {
+			s.Type = []string{t}
+		} else if err := json.Unmarshal(d.Type, &s.Type); err != nil {
+			return nil, fmt.Errorf("[%s]: Cannot parse schema - type must be string or array of strings", componentName)
+		}
+	}
+
+	if len(d.Properties) > 0 {
+		s.Properties = make(map[string]*Schema, len(d.Properties))
+		for name, p := range d.Properties {
+			ps, err := Parse(p)
+			if err != nil {
+				return nil, err
+			}
+			s.Properties[name] = ps
+		}
+	}
+
+	if len(d.AdditionalProperties) > 0 {
+		var allowed bool
+		// schema of additional properties is not supported - such properties are allowed
+		if err := json.Unmarshal(d.AdditionalProperties, &allowed); err == nil {
+			s.AdditionalProperties = &allowed
+		}
+	}
+
+	if len(d.Items) > 0 {
+		items, err := Parse(d.Items)
+		if err != nil {
+			return nil, err
+		}
+		s.Items = items
+	}
+
+	return s, nil
+}
+
+// Bytes returns schema document.
+func (s *Schema) Bytes() []byte {
+	return s.raw
+}
+
+// ValidationError represents value which does not match the schema.
+type ValidationError struct {
+	Path   string // path of invalid value, e.g. "$.items[0].name"
+	Reason string // description of the problem
+}
+
+// Error returns description of validation error.
+func (e ValidationError) Error() string {
+	return fmt.Sprintf("[%s]: %s: %s", componentName, e.Path, e.Reason)
+}
+
+// ValidateJSON validates JSON encoded value.
+func (s *Schema) ValidateJSON(data []byte) error {
+	var v interface{}
+
+	d := json.NewDecoder(bytes.NewReader(data))
+	if err := d.Decode(&v); err != nil {
+		return ValidationError{Path: "$", Reason: "value is not valid JSON: " + err.Error()}
+	}
+
+	return s.Validate(v)
+}
+
+// Validate validates value decoded from JSON (nil, bool, float64, string, []interface{} or map[string]interface{}).
+func (s *Schema) Validate(v interface{}) error {
+	return s.validate("$", v)
+}
+
+func (s *Schema) validate(path string, v interface{}) error {
+	t := typeOf(v)
+
+	if len(s.Type) > 0 && !allows(s.Type, t) {
+		return ValidationError{Path: path, Reason: fmt.Sprintf("expected %s, got %s", strings.Join(s.Type, " or "), t)}
+	}
+
+	if len(s.Enum) > 0 {
+		found := false
+		for _, e := range s.Enum {
+			if reflect.DeepEqual(e, v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return ValidationError{Path: path, Reason: "value is not one of enumerated values"}
+		}
+	}
+
+	switch val := v.(type) {
+	case float64:
+		if s.Minimum != nil && val < *s.Minimum {
+			return ValidationError{Path: path, Reason: fmt.Sprintf("value must be greater than or equal to %v", *s.Minimum)}
+		}
+		if s.Maximum != nil && val > *s.Maximum {
+			return ValidationError{Path: path, Reason: fmt.Sprintf("value must be less than or equal to %v", *s.Maximum)}
+		}
+	case string:
+		n := utf8.RuneCountInString(val)
+		if s.MinLength != nil && n < *s.MinLength {
+			return ValidationError{Path: path, Reason: fmt.Sprintf("length must be greater than or equal to %d", *s.MinLength)}
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			return ValidationError{Path: path, Reason: fmt.Sprintf("length must be less than or equal to %d", *s.MaxLength)}
+		}
+	case []interface{}:
+		if s.Items != nil {
+			for i, item := range val {
+				if err := s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item); err != nil {
+					return err
+				}
+			}
+		}
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := val[name]; !ok {
+				return ValidationError{Path: path, Reason: fmt.Sprintf("property %q is required", name)}
+			}
+		}
+
+		// properties are validated in the same order, so the same error is reported for the same value
+		names := make([]string, 0, len(val))
+		for name := range val {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			p, ok := s.Properties[name]
+			if !ok {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					return ValidationError{Path: path, Reason: fmt.Sprintf("property %q is not allowed", name)}
+				}
+				continue
+			}
+			if err := p.validate(path+"."+name, val[name]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// typeOf returns JSON Schema type of value decoded from JSON.
+func typeOf(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if val == math.Trunc(val) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// allows returns true if type t is one of types (integer is allowed by number).
+func allows(types []string, t string) bool {
+	for _, a := range types {
+		if a == t || (a == "number" && t == "integer") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package schema_test
+
+import (
+	"testing"
+
+	"github.com/gkarlik/quark-go/broker/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+const orderSchema = `{
+	"type": "object",
+	"properties": {
+		"id": {"type": "integer", "minimum": 1},
+		"status": {"type": "string", "enum": ["new", "paid"]},
+		"items": {"type": "array", "items": {"type": "string", "minLength": 1}}
+	},
+	"required": ["id"],
+	"additionalProperties": false
+}`
+
+func TestValidate(t *testing.T) {
+	s, err := schema.Parse([]byte(orderSchema))
+	assert.NoError(t, err, "Parse returned an error")
+
+	cases := []struct {
+		value string
+		valid bool
+	}{
+		{`{"id": 1, "status": "new", "items": ["book"]}`, true},
+		{`{"id": 1}`, true},
+		{`{"status": "new"}`, false},
+		{`{"id": 0}`, false},
+		{`{"id": 1.5}`, false},
+		{`{"id": 1, "status": "sent"}`, false},
+		{`{"id": 1, "items": [""]}`, false},
+		{`{"id": 1, "price": 10}`, false},
+		{`[]`, false},
+		{`not json`, false},
+	}
+
+	for _, c := range cases {
+		err := s.ValidateJSON([]byte(c.value))
+		if c.valid {
+			assert.NoError(t, err, c.value)
+		} else {
+			assert.Error(t, err, c.value)
+		}
+	}
+}
+
+func TestValidationError(t *testing.T) {
+	s, _ := schema.Parse([]byte(orderSchema))
+
+	err := s.ValidateJSON([]byte(`{"id": 1, "items": ["book", 2]}`))
+	assert.Equal(t, schema.ValidationError{Path: "$.items[1]", Reason: "expected string, got integer"}, err)
+}
+
+func TestParseError(t *testing.T) {
+	_, err := schema.Parse([]byte(`{"type": 1}`))
+	assert.Error(t, err, "Parse should return an error")
+
+	_, err = schema.Parse([]byte(`not json`))
+	assert.Error(t, err, "Parse should return an error")
+}
@@ -0,0 +1,41 @@
+package broker
+
+import (
+	"context"
+)
+
+const (
+	errorHandlerKey contextKey = "error-handler"
+	temporaryKey    contextKey = "temporary"
+)
+
+// ErrorHandler represents function which is called when subscription fails (e.g. underlying message stream is broken).
+type ErrorHandler func(err error)
+
+// WithErrorHandler returns context which sets error handler when passed to MessageBroker.Subscribe.
+// Error handler is called when subscription fails, just before returned channel is closed.
+func WithErrorHandler(ctx context.Context, h ErrorHandler) context.Context {
+	return context.WithValue(ctx, errorHandlerKey, h)
+}
+
+// HandleError calls error handler set in context with WithErrorHandler. It does nothing if error handler is not set.
+// It is used by MessageBroker implementations to surface subscription errors.
+func HandleError(ctx context.Context, err error) {
+	if h, ok := ctx.Value(errorHandlerKey).(ErrorHandler); ok && h != nil {
+		h(err)
+	}
+}
+
+// Temporary returns context which turns on temporary subscription when passed to MessageBroker.Subscribe. Resources created
+// for temporary subscription (e.g. RabbitMQ queue) are deleted when subscription ends, regardless of message broker configuration.
+// When passed to MessageBroker.PublishMessage, resources of temporary subscription are not created by publisher, so message
+// published after subscription ended is dropped.
+func Temporary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, temporaryKey, true)
+}
+
+// IsTemporary indicates if temporary subscription is turned on in context.
+func IsTemporary(ctx context.Context) bool {
+	temporary, _ := ctx.Value(temporaryKey).(bool)
+	return temporary
+}
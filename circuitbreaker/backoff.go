@@ -0,0 +1,109 @@
+package circuitbreaker
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Backoff represents strategy of growing sleep period between retries.
+type Backoff int
+
+const (
+	// ConstantBackoff sleeps for the same period before each retry.
+	ConstantBackoff Backoff = iota
+	// LinearBackoff sleeps for period multiplied by retry number.
+	LinearBackoff
+	// ExponentialBackoff doubles sleep period before each retry.
+	ExponentialBackoff
+)
+
+// Jitter represents strategy of randomizing sleep period between retries.
+type Jitter int
+
+const (
+	// NoJitter does not randomize sleep period.
+	NoJitter Jitter = iota
+	// FullJitter picks random sleep period between 0 and period calculated by backoff strategy.
+	FullJitter
+	// DecorrelatedJitter picks random sleep period between base period and three times previous sleep period.
+	DecorrelatedJitter
+)
+
+// PermanentError represents error which should not be retried.
+type PermanentError struct {
+	Err error // original error
+}
+
+// Error returns original error message.
+func (e PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+// Permanent wraps error to mark it as permanent, so it is not retried.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return PermanentError{Err: err}
+}
+
+func isRetryable(err error) bool {
+	_, ok := err.(PermanentError)
+	return !ok
+}
+
+// delay calculates sleep period before retry number attempt (starting from 1), taking into account previous sleep period.
+func (o Options) delay(attempt int, prev time.Duration) time.Duration {
+	base := o.Timeout
+
+	var d time.Duration
+	switch o.Backoff {
+	case LinearBackoff:
+		d = base * time.Duration(attempt)
+	case ExponentialBackoff:
+		d = time.Duration(float64(base) * math.Pow(2, float64(attempt-1)))
+	default:
+		d = base
+	}
+
+	// guard against overflow of exponential backoff
+	if d < 0 {
+		d = time.Duration(math.MaxInt64)
+	}
+
+	switch o.Jitter {
+	case FullJitter:
+		d = randomDuration(0, o.cap(d))
+	case DecorrelatedJitter:
+		if prev < base {
+			prev = base
+		}
+		max := prev * 3
+		if max < prev {
+			max = time.Duration(math.MaxInt64)
+		}
+		d = randomDuration(base, max)
+	}
+
+	return o.cap(d)
+}
+
+func (o Options) cap(d time.Duration) time.Duration {
+	if o.MaxDelay > 0 && d > o.MaxDelay {
+		return o.MaxDelay
+	}
+	return d
+}
+
+func randomDuration(min, max time.Duration) time.Duration {
+	if max <= min {
+		return min
+	}
+
+	n := int64(max - min)
+	if n < math.MaxInt64 {
+		n++
+	}
+	return min + time.Duration(rand.Int63n(n))
+}
@@ -0,0 +1,312 @@
+package circuitbreaker
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gkarlik/quark-go/logger"
+)
+
+// State represents state of the circuit breaker.
+type State int
+
+const (
+	// StateClosed represents closed breaker state - all calls are allowed.
+	StateClosed State = iota
+	// StateOpen represents open breaker state - all calls fail fast.
+	StateOpen
+	// StateHalfOpen represents half-open breaker state - limited number of probe calls is allowed.
+	StateHalfOpen
+)
+
+// String returns name of the state.
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("unknown state: %d", s)
+}
+
+var (
+	// ErrOpenState is returned when breaker is open and call is rejected.
+	ErrOpenState = errors.New("Circuit breaker is open")
+	// ErrTooManyProbes is returned when breaker is half-open and all probe calls are in progress.
+	ErrTooManyProbes = errors.New("Circuit breaker is half-open and too many probe calls are in progress")
+)
+
+type bucket struct {
+	start    int64  // bucket start time (unix nano)
+	requests uint32 // number of requests
+	failures uint32 // number of failures
+}
+
+// window represents rolling window of requests divided into buckets.
+type window struct {
+	width   int64 // bucket width in nanoseconds
+	buckets []bucket
+}
+
+func newWindow(size time.Duration, buckets int) *window {
+	width := int64(size) / int64(buckets)
+	if width <= 0 {
+		width = 1
+	}
+
+	return &window{
+		width:   width,
+		buckets: make([]bucket, buckets),
+	}
+}
+
+func (w *window) record(now time.Time, failure bool) {
+	start := now.UnixNano() / w.width * w.width
+	b := &w.buckets[(start/w.width)%int64(len(w.buckets))]
+
+	if b.start != start {
+		*b = bucket{start: start}
+	}
+
+	b.requests++
+	if failure {
+		b.failures++
+	}
+}
+
+func (w *window) counts(now time.Time) (requests uint32, failures uint32) {
+	from := now.UnixNano() - w.width*int64(len(w.buckets))
+
+	for _, b := range w.buckets {
+		if b.start > from {
+			requests += b.requests
+			failures += b.failures
+		}
+	}
+	return requests, failures
+}
+
+func (w *window) reset() {
+	for i := range w.buckets {
+		w.buckets[i] = bucket{}
+	}
+}
+
+type stateChange struct {
+	from State
+	to   State
+}
+
+// Breaker is stateful implementation of Circuit Breaker pattern.
+// It opens after configured number of consecutive failures or failure ratio within rolling window and fails fast while open.
+// After open timeout it becomes half-open and lets limited number of probe calls through. Breaker closes if all probes succeed.
+type Breaker struct {
+	name    string         // breaker name
+	options BreakerOptions // breaker options
+
+	mu          sync.Mutex
+	state       State     // current state
+	generation  uint64    // incremented on each state change to ignore results of calls started in previous state
+	consecutive int       // number of consecutive failures
+	window      *window   // rolling window of requests
+	openedAt    time.Time // time when breaker was opened
+	probes      int       // number of probe calls started in half-open state
+	successes   int       // number of succeeded probe calls in half-open state
+}
+
+// NewBreaker creates stateful circuit breaker with name and options passed as arguments.
+// Default settings are: opens after 5 consecutive failures or 50% failures out of at least 20 requests within 60 second rolling window (10 buckets),
+// stays open for 30 seconds and allows 1 probe call when half-open.
+func NewBreaker(name string, opts ...BreakerOption) *Breaker {
+	options := BreakerOptions{
+		ConsecutiveFailures: 5,
+		FailureRatio:        0.5,
+		MinRequests:         20,
+		Window:              60 * time.Second,
+		Buckets:             10,
+		OpenTimeout:         30 * time.Second,
+		HalfOpenProbes:      1,
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+
+	if options.Buckets <= 0 {
+		options.Buckets = 1
+	}
+	if options.HalfOpenProbes <= 0 {
+		options.HalfOpenProbes = 1
+	}
+
+	return &Breaker{
+		name:    name,
+		options: options,
+		state:   StateClosed,
+		window:  newWindow(options.Window, options.Buckets),
+	}
+}
+
+// Name returns breaker name.
+func (b *Breaker) Name() string {
+	return b.name
+}
+
+// State returns current breaker state.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	state, changes := b.currentState(time.Now())
+	b.mu.Unlock()
+
+	b.notify(changes)
+
+	return state
+}
+
+// Execute executes function f if breaker allows it. Returns ErrOpenState or ErrTooManyProbes if call is rejected.
+// Result of function f is recorded as success or failure and may change breaker state.
+func (b *Breaker) Execute(f func() (interface{}, error)) (interface{}, error) {
+	generation, err := b.before()
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if e := recover(); e != nil {
+			b.after(generation, false)
+			panic(e)
+		}
+	}()
+
+	r, err := f()
+	b.after(generation, err == nil)
+
+	return r, err
+}
+
+func (b *Breaker) before() (uint64, error) {
+	b.mu.Lock()
+
+	state, changes := b.currentState(time.Now())
+
+	var err error
+	switch state {
+	case StateOpen:
+		err = ErrOpenState
+	case StateHalfOpen:
+		if b.probes >= b.options.HalfOpenProbes {
+			err = ErrTooManyProbes
+		} else {
+			b.probes++
+		}
+	}
+	generation := b.generation
+
+	b.mu.Unlock()
+
+	b.notify(changes)
+
+	return generation, err
+}
+
+func (b *Breaker) after(generation uint64, success bool) {
+	b.mu.Lock()
+
+	now := time.Now()
+	state, changes := b.currentState(now)
+
+	if generation == b.generation {
+		switch state {
+		case StateClosed:
+			b.window.record(now, !success)
+
+			if success {
+				b.consecutive = 0
+			} else {
+				b.consecutive++
+
+				if b.shouldTrip(now) {
+					changes = append(changes, b.setState(StateOpen, now))
+				}
+			}
+		case StateHalfOpen:
+			if success {
+				b.successes++
+
+				if b.successes >= b.options.HalfOpenProbes {
+					changes = append(changes, b.setState(StateClosed, now))
+				}
+			} else {
+				changes = append(changes, b.setState(StateOpen, now))
+			}
+		}
+	}
+
+	b.mu.Unlock()
+
+	b.notify(changes)
+}
+
+func (b *Breaker) shouldTrip(now time.Time) bool {
+	if b.options.ConsecutiveFailures > 0 && b.consecutive >= b.options.ConsecutiveFailures {
+		return true
+	}
+
+	if b.options.FailureRatio > 0 {
+		requests, failures := b.window.counts(now)
+
+		if requests > 0 && int(requests) >= b.options.MinRequests && float64(failures)/float64(requests) >= b.options.FailureRatio {
+			return true
+		}
+	}
+	return false
+}
+
+// currentState returns breaker state, moving open breaker to half-open state if open timeout elapsed. Must be called with lock held.
+func (b *Breaker) currentState(now time.Time) (State, []stateChange) {
+	var changes []stateChange
+
+	if b.state == StateOpen && !now.Before(b.openedAt.Add(b.options.OpenTimeout)) {
+		changes = append(changes, b.setState(StateHalfOpen, now))
+	}
+	return b.state, changes
+}
+
+// setState changes breaker state and resets counters. Must be called with lock held.
+func (b *Breaker) setState(state State, now time.Time) stateChange {
+	change := stateChange{from: b.state, to: state}
+
+	b.state = state
+	b.generation++
+	b.consecutive = 0
+	b.probes = 0
+	b.successes = 0
+
+	switch state {
+	case StateClosed:
+		b.window.reset()
+	case StateOpen:
+		b.openedAt = now
+	}
+
+	return change
+}
+
+func (b *Breaker) notify(changes []stateChange) {
+	for _, c := range changes {
+		logger.Log().InfoWithFields(logger.Fields{
+			"name":      b.name,
+			"from":      c.from.String(),
+			"to":        c.to.String(),
+			"component": componentName,
+		}, "Circuit breaker changed state")
+
+		if b.options.OnStateChange != nil {
+			b.options.OnStateChange(b.name, c.from, c.to)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package circuitbreaker_test
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gkarlik/quark-go/circuitbreaker"
+	"github.com/stretchr/testify/assert"
+)
+
+func failingFunc() (interface{}, error) {
+	return nil, errors.New("Failure")
+}
+
+func TestBreakerConsecutiveFailures(t *testing.T) {
+	b := circuitbreaker.NewBreaker("test",
+		circuitbreaker.ConsecutiveFailures(3),
+		circuitbreaker.FailureRatio(0, 0),
+		circuitbreaker.OpenTimeout(time.Hour))
+
+	for i := 0; i < 2; i++ {
+		_, err := b.Execute(failingFunc)
+		assert.EqualError(t, err, "Failure")
+	}
+	assert.Equal(t, circuitbreaker.StateClosed, b.State())
+
+	// success resets consecutive failures counter
+	r, err := b.Execute(workingFunc)
+	assert.NoError(t, err, "Error executing workingFunc()")
+	assert.Equal(t, 1, r)
+
+	for i := 0; i < 3; i++ {
+		b.Execute(failingFunc)
+	}
+	assert.Equal(t, circuitbreaker.StateOpen, b.State())
+
+	called := false
+	_, err = b.Execute(func() (interface{}, error) {
+		called = true
+		return nil, nil
+	})
+	assert.Equal(t, circuitbreaker.ErrOpenState, err)
+	assert.False(t, called, "Function should not be called when breaker is open")
+}
+
+func TestBreakerFailureRatio(t *testing.T) {
+	b := circuitbreaker.NewBreaker("test",
+		circuitbreaker.ConsecutiveFailures(0),
+		circuitbreaker.FailureRatio(0.5, 4),
+		circuitbreaker.Window(time.Minute, 6))
+
+	b.Execute(workingFunc)
+	b.Execute(failingFunc)
+	b.Execute(workingFunc)
+	assert.Equal(t, circuitbreaker.StateClosed, b.State())
+
+	b.Execute(failingFunc)
+	assert.Equal(t, circuitbreaker.StateOpen, b.State())
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	var mu sync.Mutex
+	var transitions []string
+
+	b := circuitbreaker.NewBreaker("test",
+		circuitbreaker.ConsecutiveFailures(1),
+		circuitbreaker.OpenTimeout(50*time.Millisecond),
+		circuitbreaker.HalfOpenProbes(2),
+		circuitbreaker.OnStateChange(func(name string, from circuitbreaker.State, to circuitbreaker.State) {
+			mu.Lock()
+			transitions = append(transitions, from.String()+"->"+to.String())
+			mu.Unlock()
+		}))
+
+	b.Execute(failingFunc)
+	assert.Equal(t, circuitbreaker.StateOpen, b.State())
+
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(t, circuitbreaker.StateHalfOpen, b.State())
+
+	// half-open breaker lets only limited number of probes through
+	var started sync.WaitGroup
+	probe := make(chan bool)
+	done := make(chan bool)
+
+	started.Add(2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			b.Execute(func() (interface{}, error) {
+				started.Done()
+				<-probe
+				return 1, nil
+			})
+			done <- true
+		}()
+	}
+	started.Wait()
+
+	_, err := b.Execute(workingFunc)
+	assert.Equal(t, circuitbreaker.ErrTooManyProbes, err)
+
+	close(probe)
+	<-done
+	<-done
+
+	assert.Equal(t, circuitbreaker.StateClosed, b.State())
+
+	// failed probe opens breaker again
+	b.Execute(failingFunc)
+	time.Sleep(60 * time.Millisecond)
+	b.Execute(failingFunc)
+	assert.Equal(t, circuitbreaker.StateOpen, b.State())
+
+	mu.Lock()
+	assert.Equal(t, []string{
+		"closed->open",
+		"open->half-open",
+		"half-open->closed",
+		"closed->open",
+		"open->half-open",
+		"half-open->open",
+	}, transitions)
+	mu.Unlock()
+}
+
+func TestBreakerPanic(t *testing.T) {
+	b := circuitbreaker.NewBreaker("test", circuitbreaker.ConsecutiveFailures(1))
+
+	assert.Panics(t, func() {
+		b.Execute(func() (interface{}, error) {
+			panic("Test panic")
+		})
+	})
+	assert.Equal(t, circuitbreaker.StateOpen, b.State())
+}
+
+func TestRegistry(t *testing.T) {
+	r := circuitbreaker.NewRegistry(circuitbreaker.ConsecutiveFailures(1))
+
+	a := r.Get("A")
+	assert.Equal(t, "A", a.Name())
+	assert.Equal(t, a, r.Get("A"))
+
+	_, err := r.Execute("A", failingFunc)
+	assert.Error(t, err, "Execute should return an error")
+	assert.Equal(t, circuitbreaker.StateOpen, r.Get("A").State())
+
+	r.Execute("B", workingFunc)
+	assert.Equal(t, circuitbreaker.StateClosed, r.Get("B").State())
+
+	names := r.Names()
+	sort.Strings(names)
+	assert.Equal(t, []string{"A", "B"}, names)
+}
@@ -1,16 +1,23 @@
 package circuitbreaker
 
 import (
+	"context"
 	"time"
 )
 
-// Option represents function which is used to apply circuit breaker options.
+// Option represents function which is used to apply circuit breaker (retry policy) options.
 type Option func(*Options)
 
-// Options represents circuit breaker options.
+// Options represents circuit breaker (retry policy) options.
 type Options struct {
-	Attempts int           // number of retries
-	Timeout  time.Duration // sleep period between each retry
+	Attempts       int              // number of retries
+	Timeout        time.Duration    // base sleep period between retries
+	Backoff        Backoff          // strategy of growing sleep period between retries
+	Jitter         Jitter           // strategy of randomizing sleep period between retries
+	MaxDelay       time.Duration    // maximum sleep period between retries (0 - unlimited)
+	MaxElapsedTime time.Duration    // maximum time spent on all attempts (0 - unlimited)
+	Retryable      func(error) bool // function which classifies error as retryable
+	Context        context.Context  // context used by Execute to cancel retries
 }
 
 // Retry allows to set number of retries.
@@ -20,9 +27,113 @@ func Retry(retries int) Option {
 	}
 }
 
-// Timeout allows to set sleep period between retries.
+// Timeout allows to set sleep period between retries. It is base period for linear and exponential backoff.
 func Timeout(timeout time.Duration) Option {
 	return func(o *Options) {
 		o.Timeout = timeout
 	}
 }
+
+// UsingBackoff allows to set strategy of growing sleep period between retries.
+func UsingBackoff(b Backoff) Option {
+	return func(o *Options) {
+		o.Backoff = b
+	}
+}
+
+// UsingJitter allows to set strategy of randomizing sleep period between retries.
+func UsingJitter(j Jitter) Option {
+	return func(o *Options) {
+		o.Jitter = j
+	}
+}
+
+// MaxDelay allows to set maximum sleep period between retries.
+func MaxDelay(delay time.Duration) Option {
+	return func(o *Options) {
+		o.MaxDelay = delay
+	}
+}
+
+// MaxElapsedTime allows to set maximum time spent on all attempts. Retrying stops if next attempt would exceed it.
+func MaxElapsedTime(elapsed time.Duration) Option {
+	return func(o *Options) {
+		o.MaxElapsedTime = elapsed
+	}
+}
+
+// RetryIf allows to set function which classifies error as retryable (true) or permanent (false).
+// By default all errors except those wrapped with Permanent are retryable.
+func RetryIf(f func(error) bool) Option {
+	return func(o *Options) {
+		o.Retryable = f
+	}
+}
+
+// WithContext allows to set context used by Execute method to cancel retries (e.g. when service is shutting down).
+func WithContext(ctx context.Context) Option {
+	return func(o *Options) {
+		o.Context = ctx
+	}
+}
+
+// BreakerOption represents function which is used to apply stateful circuit breaker options.
+type BreakerOption func(*BreakerOptions)
+
+// BreakerOptions represents stateful circuit breaker options.
+type BreakerOptions struct {
+	ConsecutiveFailures int                                     // number of consecutive failures which opens the breaker (0 - disabled)
+	FailureRatio        float64                                 // ratio of failures in rolling window which opens the breaker (0 - disabled)
+	MinRequests         int                                     // minimal number of requests in rolling window to evaluate failure ratio
+	Window              time.Duration                           // rolling window size
+	Buckets             int                                     // number of buckets rolling window is divided into
+	OpenTimeout         time.Duration                           // period after which open breaker becomes half-open
+	HalfOpenProbes      int                                     // number of probe calls allowed in half-open state
+	OnStateChange       func(name string, from State, to State) // function called when breaker changes its state
+}
+
+// ConsecutiveFailures allows to set number of consecutive failures which opens the breaker. Zero disables this condition.
+func ConsecutiveFailures(failures int) BreakerOption {
+	return func(o *BreakerOptions) {
+		o.ConsecutiveFailures = failures
+	}
+}
+
+// FailureRatio allows to set ratio of failures within rolling window which opens the breaker.
+// Ratio is evaluated only if there were at least minRequests requests in rolling window. Zero ratio disables this condition.
+func FailureRatio(ratio float64, minRequests int) BreakerOption {
+	return func(o *BreakerOptions) {
+		o.FailureRatio = ratio
+		o.MinRequests = minRequests
+	}
+}
+
+// Window allows to set rolling window size and number of buckets it is divided into.
+func Window(size time.Duration, buckets int) BreakerOption {
+	return func(o *BreakerOptions) {
+		o.Window = size
+		o.Buckets = buckets
+	}
+}
+
+// OpenTimeout allows to set period after which open breaker becomes half-open.
+func OpenTimeout(timeout time.Duration) BreakerOption {
+	return func(o *BreakerOptions) {
+		o.OpenTimeout = timeout
+	}
+}
+
+// HalfOpenProbes allows to set number of probe calls allowed in half-open state.
+// Breaker closes when all probes succeed.
+func HalfOpenProbes(probes int) BreakerOption {
+	return func(o *BreakerOptions) {
+		o.HalfOpenProbes = probes
+	}
+}
+
+// OnStateChange allows to set function which is called when breaker changes its state.
+func OnStateChange(f func(name string, from State, to State)) BreakerOption {
+	return func(o *BreakerOptions) {
+		o.OnStateChange = f
+	}
+}
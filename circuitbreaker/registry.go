@@ -0,0 +1,55 @@
+package circuitbreaker
+
+import (
+	"sync"
+)
+
+// Registry represents collection of stateful circuit breakers identified by name, so each downstream dependency can have its own breaker.
+type Registry struct {
+	mu       sync.Mutex
+	options  []BreakerOption     // options used to create breakers
+	breakers map[string]*Breaker // breakers by name
+}
+
+// NewRegistry creates registry of circuit breakers. Options passed as arguments are used to create each breaker.
+func NewRegistry(opts ...BreakerOption) *Registry {
+	return &Registry{
+		options:  opts,
+		breakers: make(map[string]*Breaker),
+	}
+}
+
+// Get returns breaker with specified name. Breaker is created if it does not exist.
+// Additional options passed as arguments are applied after registry options, but only when breaker is created.
+func (r *Registry) Get(name string, opts ...BreakerOption) *Breaker {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b, ok := r.breakers[name]
+	if !ok {
+		o := make([]BreakerOption, 0, len(r.options)+len(opts))
+		o = append(o, r.options...)
+		o = append(o, opts...)
+
+		b = NewBreaker(name, o...)
+		r.breakers[name] = b
+	}
+	return b
+}
+
+// Execute executes function f using breaker with specified name.
+func (r *Registry) Execute(name string, f func() (interface{}, error)) (interface{}, error) {
+	return r.Get(name).Execute(f)
+}
+
+// Names returns names of all registered breakers.
+func (r *Registry) Names() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := make([]string, 0, len(r.breakers))
+	for n := range r.breakers {
+		names = append(names, n)
+	}
+	return names
+}
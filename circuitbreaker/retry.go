@@ -0,0 +1,144 @@
+package circuitbreaker
+
+import (
+	"context"
+	"time"
+
+	"github.com/gkarlik/quark-go/logger"
+)
+
+// RetryPolicy is retry mechanism which executes function again if it fails.
+type RetryPolicy struct{}
+
+// Execute executes function f and retries it if it fails. Retries are cancelled when context set by WithContext option is done.
+// Default settings are: 3 attempts (1 failure + 3 retries), 5 second constant sleep time between retries.
+func (rp RetryPolicy) Execute(f func() (interface{}, error), opts ...Option) (interface{}, error) {
+	options := newOptions(opts...)
+
+	ctx := options.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	return rp.execute(ctx, f, options)
+}
+
+// ExecuteContext executes function f and retries it if it fails until context ctx is done.
+// Sleep period between retries is calculated by configured backoff and jitter strategies and limited by MaxDelay.
+// Retrying stops when error is classified as permanent or when MaxElapsedTime would be exceeded.
+// Returns last error of function f or context error if context is done.
+// Default settings are: 3 attempts (1 failure + 3 retries), 5 second constant sleep time between retries.
+func (rp RetryPolicy) ExecuteContext(ctx context.Context, f func() (interface{}, error), opts ...Option) (interface{}, error) {
+	return rp.execute(ctx, f, newOptions(opts...))
+}
+
+func newOptions(opts ...Option) *Options {
+	options := &Options{
+		Attempts: 3,
+		Timeout:  5 * time.Second,
+		Backoff:  ConstantBackoff,
+		Jitter:   NoJitter,
+	}
+	for _, o := range opts {
+		o(options)
+	}
+
+	if options.Retryable == nil {
+		options.Retryable = isRetryable
+	}
+
+	return options
+}
+
+func (rp RetryPolicy) execute(ctx context.Context, f func() (interface{}, error), options *Options) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+
+	r, err := f()
+	if err == nil {
+		return r, nil
+	}
+
+	logger.Log().WarningWithFields(logger.Fields{
+		"error":     err,
+		"attempts":  options.Attempts,
+		"component": componentName,
+	}, "Detected failure. Retrying...")
+
+	var delay time.Duration
+	for i := 1; i <= options.Attempts; i++ {
+		if !options.Retryable(err) {
+			logger.Log().ErrorWithFields(logger.Fields{
+				"error":     err,
+				"component": componentName,
+			}, "Permanent failure. Stopping retries.")
+
+			return nil, unwrapPermanent(err)
+		}
+
+		delay = options.delay(i, delay)
+
+		if options.MaxElapsedTime > 0 && time.Since(start)+delay > options.MaxElapsedTime {
+			logger.Log().ErrorWithFields(logger.Fields{
+				"elapsed":   time.Since(start),
+				"component": componentName,
+			}, "Maximum elapsed time exceeded. Stopping retries.")
+
+			return nil, err
+		}
+
+		logger.Log().InfoWithFields(logger.Fields{
+			"timeout":   delay,
+			"component": componentName,
+		}, "Sleeping for configured timeout...")
+
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+
+			logger.Log().WarningWithFields(logger.Fields{
+				"error":     ctx.Err(),
+				"component": componentName,
+			}, "Context is done. Stopping retries.")
+
+			return nil, ctx.Err()
+		case <-t.C:
+		}
+
+		logger.Log().InfoWithFields(logger.Fields{
+			"attempt":   i,
+			"from":      options.Attempts,
+			"component": componentName,
+		}, "Retrying execution...")
+
+		r, err = f()
+		if err != nil {
+			logger.Log().WarningWithFields(logger.Fields{
+				"error":     err,
+				"attempt":   i,
+				"component": componentName,
+			}, "Last execution failed")
+			continue
+		}
+
+		logger.Log().InfoWithFields(logger.Fields{
+			"attempt":   i,
+			"component": componentName,
+		}, "Last retry succeed")
+		return r, nil
+	}
+	logger.Log().ErrorWithFields(logger.Fields{"component": componentName}, "All retries failed.")
+
+	return nil, unwrapPermanent(err)
+}
+
+func unwrapPermanent(err error) error {
+	if p, ok := err.(PermanentError); ok {
+		return p.Err
+	}
+	return err
+}
@@ -0,0 +1,114 @@
+package circuitbreaker_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gkarlik/quark-go/circuitbreaker"
+	"github.com/stretchr/testify/assert"
+)
+
+type countingFunc struct {
+	calls    int
+	failures int
+	err      error
+}
+
+func (c *countingFunc) Execute() (interface{}, error) {
+	c.calls++
+	if c.calls <= c.failures {
+		return nil, c.err
+	}
+	return c.calls, nil
+}
+
+func TestRetryPolicyExponentialBackoff(t *testing.T) {
+	f := &countingFunc{failures: 3, err: errors.New("Failure")}
+
+	start := time.Now()
+	r, err := circuitbreaker.RetryPolicy{}.ExecuteContext(context.Background(), f.Execute,
+		circuitbreaker.Retry(3),
+		circuitbreaker.Timeout(10*time.Millisecond),
+		circuitbreaker.UsingBackoff(circuitbreaker.ExponentialBackoff))
+
+	assert.NoError(t, err, "ExecuteContext returned an error")
+	assert.Equal(t, 4, r)
+	// 10ms + 20ms + 40ms
+	assert.True(t, time.Since(start) >= 70*time.Millisecond)
+}
+
+func TestRetryPolicyMaxDelay(t *testing.T) {
+	f := &countingFunc{failures: 3, err: errors.New("Failure")}
+
+	start := time.Now()
+	_, err := circuitbreaker.RetryPolicy{}.ExecuteContext(context.Background(), f.Execute,
+		circuitbreaker.Retry(3),
+		circuitbreaker.Timeout(10*time.Millisecond),
+		circuitbreaker.UsingBackoff(circuitbreaker.LinearBackoff),
+		circuitbreaker.UsingJitter(circuitbreaker.DecorrelatedJitter),
+		circuitbreaker.MaxDelay(5*time.Millisecond))
+
+	assert.NoError(t, err, "ExecuteContext returned an error")
+	assert.True(t, time.Since(start) < 500*time.Millisecond)
+
+	f = &countingFunc{failures: 3, err: errors.New("Failure")}
+
+	_, err = circuitbreaker.RetryPolicy{}.ExecuteContext(context.Background(), f.Execute,
+		circuitbreaker.Retry(3),
+		circuitbreaker.Timeout(time.Hour),
+		circuitbreaker.UsingBackoff(circuitbreaker.ExponentialBackoff),
+		circuitbreaker.UsingJitter(circuitbreaker.FullJitter),
+		circuitbreaker.MaxDelay(time.Millisecond))
+
+	assert.NoError(t, err, "ExecuteContext returned an error")
+}
+
+func TestRetryPolicyPermanentError(t *testing.T) {
+	failure := errors.New("Failure")
+	f := &countingFunc{failures: 3, err: circuitbreaker.Permanent(failure)}
+
+	_, err := circuitbreaker.RetryPolicy{}.ExecuteContext(context.Background(), f.Execute, circuitbreaker.Timeout(time.Millisecond))
+	assert.Equal(t, failure, err)
+	assert.Equal(t, 1, f.calls)
+
+	f = &countingFunc{failures: 3, err: failure}
+
+	_, err = circuitbreaker.RetryPolicy{}.ExecuteContext(context.Background(), f.Execute,
+		circuitbreaker.Timeout(time.Millisecond),
+		circuitbreaker.RetryIf(func(err error) bool {
+			return err != failure
+		}))
+	assert.Equal(t, failure, err)
+	assert.Equal(t, 1, f.calls)
+}
+
+func TestRetryPolicyContextCancellation(t *testing.T) {
+	f := &countingFunc{failures: 3, err: errors.New("Failure")}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := circuitbreaker.RetryPolicy{}.Execute(f.Execute, circuitbreaker.Timeout(time.Hour), circuitbreaker.WithContext(ctx))
+
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, 1, f.calls)
+	assert.True(t, time.Since(start) < time.Second)
+
+	_, err = circuitbreaker.RetryPolicy{}.ExecuteContext(ctx, f.Execute)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, 1, f.calls)
+}
+
+func TestRetryPolicyMaxElapsedTime(t *testing.T) {
+	f := &countingFunc{failures: 3, err: errors.New("Failure")}
+
+	_, err := circuitbreaker.RetryPolicy{}.ExecuteContext(context.Background(), f.Execute,
+		circuitbreaker.Timeout(50*time.Millisecond),
+		circuitbreaker.MaxElapsedTime(20*time.Millisecond))
+
+	assert.Error(t, err, "ExecuteContext should return an error")
+	assert.Equal(t, 1, f.calls)
+}
@@ -0,0 +1,80 @@
+package gorm
+
+import (
+	"time"
+
+	"github.com/gkarlik/quark-go/logger"
+)
+
+const (
+	inboxComponentName = "GORMInbox"
+	inboxTableName     = "inbox_messages"
+)
+
+// InboxMessage represents identifier of processed message stored in inbox table.
+type InboxMessage struct {
+	ID        string    `gorm:"primary_key;size:255"` // message identifier
+	ExpiresAt time.Time `gorm:"index"`                // time when identifier expires
+}
+
+// TableName returns name of inbox table.
+func (InboxMessage) TableName() string {
+	return inboxTableName
+}
+
+// Inbox represents store of identifiers of processed messages in relational database (broker.Inbox implementation).
+// Expired identifiers are replaced when the same identifier is added again and can be removed with Purge.
+type Inbox struct {
+	Context *DbContext // database context
+}
+
+// NewInbox creates inbox which stores message identifiers using database context. Inbox table is created if it does not exist.
+func NewInbox(c *DbContext) (*Inbox, error) {
+	if err := c.DB.AutoMigrate(&InboxMessage{}).Error; err != nil {
+		logger.Log().ErrorWithFields(logger.Fields{
+			"error":     err,
+			"component": inboxComponentName,
+		}, "Cannot create inbox table")
+
+		return nil, err
+	}
+
+	return &Inbox{Context: c}, nil
+}
+
+// Add records message identifier for ttl. It returns false if identifier is already recorded and not expired.
+func (i *Inbox) Add(id string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+
+	if err := i.Context.DB.Where("id = ? AND expires_at <= ?", id, now).Delete(&InboxMessage{}).Error; err != nil {
+		return false, err
+	}
+
+	if err := i.Context.DB.Create(&InboxMessage{ID: id, ExpiresAt: now.Add(ttl)}).Error; err != nil {
+		// insert fails on primary key violation if identifier is already recorded
+		var count int
+		if cerr := i.Context.DB.Model(&InboxMessage{}).Where("id = ?", id).Count(&count).Error; cerr == nil && count > 0 {
+			return false, nil
+		}
+
+		logger.Log().ErrorWithFields(logger.Fields{
+			"error":     err,
+			"id":        id,
+			"component": inboxComponentName,
+		}, "Cannot add message identifier to inbox")
+
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Remove removes message identifier.
+func (i *Inbox) Remove(id string) error {
+	return i.Context.DB.Where("id = ?", id).Delete(&InboxMessage{}).Error
+}
+
+// Purge removes expired message identifiers.
+func (i *Inbox) Purge() error {
+	return i.Context.DB.Where("expires_at <= ?", time.Now()).Delete(&InboxMessage{}).Error
+}
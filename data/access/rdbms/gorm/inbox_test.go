@@ -0,0 +1,57 @@
+package gorm_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gkarlik/quark-go/data/access/rdbms/gorm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInbox(t *testing.T) {
+	db := NewDbContext().(*gorm.DbContext)
+	defer db.Dispose()
+
+	i, err := gorm.NewInbox(db)
+	assert.NoError(t, err, "NewInbox returned an error")
+
+	db.DB.Delete(&gorm.InboxMessage{})
+
+	added, err := i.Add("TestID", time.Minute)
+	assert.NoError(t, err, "Add returned an error")
+	assert.True(t, added)
+
+	added, err = i.Add("TestID", time.Minute)
+	assert.NoError(t, err, "Add returned an error")
+	assert.False(t, added)
+
+	assert.NoError(t, i.Remove("TestID"), "Remove returned an error")
+
+	added, err = i.Add("TestID", time.Minute)
+	assert.NoError(t, err, "Add returned an error")
+	assert.True(t, added)
+}
+
+func TestInboxExpiration(t *testing.T) {
+	db := NewDbContext().(*gorm.DbContext)
+	defer db.Dispose()
+
+	i, err := gorm.NewInbox(db)
+	assert.NoError(t, err, "NewInbox returned an error")
+
+	db.DB.Delete(&gorm.InboxMessage{})
+
+	added, _ := i.Add("TestExpiredID", -time.Second)
+	assert.True(t, added)
+
+	// expired identifier is replaced
+	added, _ = i.Add("TestExpiredID", time.Minute)
+	assert.True(t, added)
+
+	i.Add("TestPurgedID", -time.Second)
+	assert.NoError(t, i.Purge(), "Purge returned an error")
+
+	var count int
+	db.DB.Model(&gorm.InboxMessage{}).Count(&count)
+	assert.Equal(t, 1, count)
+}
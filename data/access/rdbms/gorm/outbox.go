@@ -0,0 +1,348 @@
+package gorm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gkarlik/quark-go/broker"
+	"github.com/gkarlik/quark-go/data/access/rdbms"
+	"github.com/gkarlik/quark-go/logger"
+)
+
+const (
+	outboxComponentName = "GORMOutbox"
+	outboxTableName     = "outbox_messages"
+
+	defaultPollInterval  = 1 * time.Second
+	defaultBatchSize     = 100
+	defaultRetryDelay    = 1 * time.Second
+	defaultMaxRetryDelay = 5 * time.Minute
+	defaultRetention     = 24 * time.Hour
+)
+
+// pendingQuery selects messages which can be published now. Messages waiting for retry are skipped, so they do not fill
+// the batch and block other messages, and so are next messages of their aggregates to preserve ordering.
+var pendingQuery = fmt.Sprintf("dispatched_at IS NULL AND (next_attempt_at IS NULL OR next_attempt_at <= ?) AND NOT EXISTS ("+
+	"SELECT 1 FROM %[1]s AS earlier WHERE earlier.aggregate_key = %[1]s.aggregate_key AND earlier.aggregate_key <> '' "+
+	"AND earlier.id < %[1]s.id AND earlier.dispatched_at IS NULL AND earlier.next_attempt_at > ?)", outboxTableName)
+
+// OutboxMessage represents message stored in outbox table until it is dispatched by OutboxRelay.
+type OutboxMessage struct {
+	ID            uint       `gorm:"primary_key"`
+	AggregateKey  string     `gorm:"size:255;index"` // messages with the same aggregate key are dispatched in order they were added
+	Topic         string     `gorm:"size:255"`       // message topic
+	Value         []byte     // encoded message value
+	Context       string     `gorm:"type:text"` // JSON encoded message context
+	CreatedAt     time.Time  // time when message was added to outbox
+	DispatchedAt  *time.Time `gorm:"index"` // time when message was published, nil if message is pending
+	Attempts      int        // number of failed publish attempts
+	LastError     string     `gorm:"type:text"` // last publish error
+	NextAttemptAt *time.Time // time of next publish attempt after failure
+}
+
+// TableName returns name of outbox table.
+func (OutboxMessage) TableName() string {
+	return outboxTableName
+}
+
+// AddToOutbox stores message in outbox table using database context which must be in transaction, so message
+// is stored atomically with aggregate changes and published by OutboxRelay only if transaction is committed.
+// Messages with the same aggregate key are published in order they were added.
+func AddToOutbox(c rdbms.DbContext, aggregateKey string, m broker.Message) error {
+	if !c.IsInTransaction() {
+		logger.Log().ErrorWithFields(logger.Fields{"component": outboxComponentName}, "Database context is not in transaction")
+
+		return fmt.Errorf("[%s]: Cannot add message to outbox - database context is not in transaction", outboxComponentName)
+	}
+
+	if m.Topic == "" {
+		logger.Log().ErrorWithFields(logger.Fields{"component": outboxComponentName}, "Cannot add message to outbox - message topic cannot be empty")
+
+		return fmt.Errorf("[%s]: Cannot add message to outbox - message topic cannot be empty", outboxComponentName)
+	}
+
+	// identifier is assigned once, so consumers can detect message published more than once by relay
+	m = broker.WithMessageID(m)
+
+	value, ctx, err := encodeMessage(m)
+	if err != nil {
+		logger.Log().ErrorWithFields(logger.Fields{
+			"error":     err,
+			"message":   m,
+			"component": outboxComponentName,
+		}, "Cannot encode message")
+
+		return err
+	}
+
+	om := &OutboxMessage{
+		AggregateKey: aggregateKey,
+		Topic:        m.Topic,
+		Value:        value,
+		Context:      ctx,
+	}
+
+	if err := c.(*DbContext).DB.Create(om).Error; err != nil {
+		logger.Log().ErrorWithFields(logger.Fields{
+			"error":     err,
+			"topic":     m.Topic,
+			"component": outboxComponentName,
+		}, "Cannot add message to outbox")
+
+		return err
+	}
+
+	return nil
+}
+
+// OutboxOption represents function which is used to apply outbox relay options.
+type OutboxOption func(*OutboxOptions)
+
+// OutboxOptions represents outbox relay options.
+type OutboxOptions struct {
+	PollInterval  time.Duration // interval of polling outbox table
+	BatchSize     int           // maximum number of messages dispatched in single poll
+	RetryDelay    time.Duration // delay of first retry after failure, doubled after each next failure
+	MaxRetryDelay time.Duration // maximum delay between retries
+	Retention     time.Duration // time for which dispatched messages are kept in outbox table
+}
+
+// PollInterval allows to set interval of polling outbox table. Default interval is 1 second.
+func PollInterval(d time.Duration) OutboxOption {
+	return func(o *OutboxOptions) {
+		o.PollInterval = d
+	}
+}
+
+// BatchSize allows to set maximum number of messages dispatched in single poll. Default is 100 messages.
+func BatchSize(n int) OutboxOption {
+	return func(o *OutboxOptions) {
+		o.BatchSize = n
+	}
+}
+
+// RetryDelay allows to set delay of first retry after failure (doubled after each next failure) and maximum delay between retries.
+// Default delay is 1 second and maximum delay is 5 minutes.
+func RetryDelay(delay, max time.Duration) OutboxOption {
+	return func(o *OutboxOptions) {
+		o.RetryDelay = delay
+		o.MaxRetryDelay = max
+	}
+}
+
+// Retention allows to set time for which dispatched messages are kept in outbox table before they are removed by Run (or Purge).
+// Default retention is 24 hours.
+func Retention(d time.Duration) OutboxOption {
+	return func(o *OutboxOptions) {
+		o.Retention = d
+	}
+}
+
+// OutboxRelay represents background process which publishes messages stored in outbox table and marks them as dispatched.
+// Failed messages are retried with exponential backoff and block next messages with the same aggregate key to preserve ordering.
+// Messages are published at least once, so only one relay should poll the same outbox table and consumers should be idempotent.
+// Dispatched messages are removed after retention time.
+type OutboxRelay struct {
+	Context *DbContext           // database context
+	Broker  broker.MessageBroker // message broker
+	Options OutboxOptions        // relay options
+}
+
+// NewOutboxRelay creates outbox relay which publishes messages from outbox table using message broker.
+// Outbox table is created if it does not exist.
+func NewOutboxRelay(c *DbContext, b broker.MessageBroker, opts ...OutboxOption) (*OutboxRelay, error) {
+	r := &OutboxRelay{
+		Context: c,
+		Broker:  b,
+		Options: OutboxOptions{
+			PollInterval:  defaultPollInterval,
+			BatchSize:     defaultBatchSize,
+			RetryDelay:    defaultRetryDelay,
+			MaxRetryDelay: defaultMaxRetryDelay,
+			Retention:     defaultRetention,
+		},
+	}
+
+	for _, opt := range opts {
+		opt(&r.Options)
+	}
+
+	if err := c.DB.AutoMigrate(&OutboxMessage{}).Error; err != nil {
+		logger.Log().ErrorWithFields(logger.Fields{
+			"error":     err,
+			"component": outboxComponentName,
+		}, "Cannot create outbox table")
+
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Run dispatches outbox messages and purges dispatched messages periodically until context is done.
+func (r *OutboxRelay) Run(ctx context.Context) error {
+	logger.Log().InfoWithFields(logger.Fields{
+		"interval":  r.Options.PollInterval,
+		"component": outboxComponentName,
+	}, "Outbox relay started")
+
+	ticker := time.NewTicker(r.Options.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.Dispatch(ctx); err != nil {
+			logger.Log().ErrorWithFields(logger.Fields{
+				"error":     err,
+				"component": outboxComponentName,
+			}, "Cannot dispatch outbox messages")
+		}
+
+		if err := r.Purge(); err != nil {
+			logger.Log().ErrorWithFields(logger.Fields{
+				"error":     err,
+				"component": outboxComponentName,
+			}, "Cannot purge dispatched outbox messages")
+		}
+
+		select {
+		case <-ctx.Done():
+			logger.Log().InfoWithFields(logger.Fields{"component": outboxComponentName}, "Outbox relay stopped")
+
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Dispatch publishes pending outbox messages (at most BatchSize) and returns number of dispatched messages.
+// Messages waiting for retry and next messages with the same aggregate key are not selected.
+func (r *OutboxRelay) Dispatch(ctx context.Context) (int, error) {
+	now := time.Now()
+
+	var pending []OutboxMessage
+	if err := r.Context.DB.Where(pendingQuery, now, now).Order("id").Limit(r.Options.BatchSize).Find(&pending).Error; err != nil {
+		return 0, err
+	}
+
+	dispatched := 0
+	blocked := map[string]bool{} // aggregate keys which cannot be dispatched in this poll
+
+	for i := range pending {
+		om := &pending[i]
+
+		if ctx.Err() != nil {
+			return dispatched, ctx.Err()
+		}
+
+		if om.AggregateKey != "" && blocked[om.AggregateKey] {
+			continue
+		}
+
+		if err := r.publish(ctx, om); err != nil {
+			blocked[om.AggregateKey] = true
+
+			if err := r.fail(om, err); err != nil {
+				return dispatched, err
+			}
+			continue
+		}
+
+		if err := r.Context.DB.Model(om).Update("dispatched_at", time.Now()).Error; err != nil {
+			logger.Log().ErrorWithFields(logger.Fields{
+				"error":     err,
+				"id":        om.ID,
+				"component": outboxComponentName,
+			}, "Cannot mark outbox message as dispatched")
+
+			return dispatched, err
+		}
+		dispatched++
+	}
+
+	return dispatched, nil
+}
+
+// Purge removes messages which were dispatched before retention time.
+func (r *OutboxRelay) Purge() error {
+	return r.Context.DB.Where("dispatched_at <= ?", time.Now().Add(-r.Options.Retention)).Delete(&OutboxMessage{}).Error
+}
+
+func (r *OutboxRelay) publish(ctx context.Context, om *OutboxMessage) error {
+	m, err := decodeMessage(om.Topic, om.Value, om.Context)
+	if err != nil {
+		return err
+	}
+
+	return r.Broker.PublishMessage(ctx, m)
+}
+
+func (r *OutboxRelay) fail(om *OutboxMessage, cause error) error {
+	next := time.Now().Add(retryDelay(r.Options, om.Attempts))
+
+	logger.Log().WarningWithFields(logger.Fields{
+		"error":     cause,
+		"id":        om.ID,
+		"topic":     om.Topic,
+		"attempts":  om.Attempts + 1,
+		"retry":     next,
+		"component": outboxComponentName,
+	}, "Cannot publish outbox message")
+
+	return r.Context.DB.Model(om).Updates(map[string]interface{}{
+		"attempts":        om.Attempts + 1,
+		"last_error":      cause.Error(),
+		"next_attempt_at": next,
+	}).Error
+}
+
+// retryDelay returns delay of next publish attempt after number of failed attempts.
+func retryDelay(o OutboxOptions, attempts int) time.Duration {
+	delay := o.RetryDelay
+	for i := 0; i < attempts && delay < o.MaxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > o.MaxRetryDelay {
+		delay = o.MaxRetryDelay
+	}
+	return delay
+}
+
+// encodeMessage returns encoded message value and JSON encoded message context which includes content type of the value.
+func encodeMessage(m broker.Message) ([]byte, string, error) {
+	value, contentType, err := broker.Encode(m)
+	if err != nil {
+		return nil, "", err
+	}
+
+	mc := broker.MessageContext{}
+	for k, v := range m.Context {
+		mc[k] = v
+	}
+	mc[broker.ContentTypeKey] = contentType
+
+	ctx, err := json.Marshal(mc)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return value, string(ctx), nil
+}
+
+// decodeMessage returns message with encoded value and context decoded from JSON.
+func decodeMessage(topic string, value []byte, ctx string) (broker.Message, error) {
+	m := broker.Message{
+		Topic:   topic,
+		Value:   broker.Encoded(value),
+		Context: broker.MessageContext{},
+	}
+
+	if ctx != "" {
+		if err := json.Unmarshal([]byte(ctx), &m.Context); err != nil {
+			return m, err
+		}
+	}
+
+	return m, nil
+}
@@ -0,0 +1,191 @@
+package gorm_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gkarlik/quark-go/broker"
+	"github.com/gkarlik/quark-go/broker/memory"
+	"github.com/gkarlik/quark-go/data/access/rdbms/gorm"
+	"github.com/stretchr/testify/assert"
+)
+
+type OutboxPayload struct {
+	Text string `json:"text"`
+}
+
+// FailingBroker fails to publish messages with specified topic.
+type FailingBroker struct {
+	*memory.MessageBroker
+
+	topic string
+}
+
+func (b *FailingBroker) PublishMessage(ctx context.Context, m broker.Message) error {
+	if m.Topic == b.topic {
+		return errors.New("test error")
+	}
+	return b.MessageBroker.PublishMessage(ctx, m)
+}
+
+func newOutboxRelay(t *testing.T, b broker.MessageBroker, opts ...gorm.OutboxOption) (*gorm.DbContext, *gorm.OutboxRelay) {
+	db := NewDbContext().(*gorm.DbContext)
+
+	relay, err := gorm.NewOutboxRelay(db, b, append([]gorm.OutboxOption{gorm.RetryDelay(time.Hour, time.Hour)}, opts...)...)
+	assert.NoError(t, err, "NewOutboxRelay returned an error")
+
+	db.DB.Delete(&gorm.OutboxMessage{})
+
+	return db, relay
+}
+
+func TestOutbox(t *testing.T) {
+	topic := "TestOutboxTopic"
+
+	b := memory.NewMessageBroker()
+	defer b.Dispose()
+
+	db, relay := newOutboxRelay(t, b)
+	defer db.Dispose()
+
+	messages, err := b.Subscribe(context.Background(), topic)
+	assert.NoError(t, err, "Subscribe returned an error")
+
+	// message cannot be added outside of transaction
+	err = gorm.AddToOutbox(db, "user-1", broker.Message{Topic: topic, Value: &OutboxPayload{Text: "Test"}})
+	assert.Error(t, err, "AddToOutbox should return an error")
+
+	// message of rolled back transaction is not dispatched
+	tx := db.BeginTransaction()
+	err = gorm.AddToOutbox(tx.Context(), "user-1", broker.Message{Topic: topic, Value: &OutboxPayload{Text: "Rollback"}})
+	assert.NoError(t, err, "AddToOutbox returned an error")
+	tx.Rollback()
+
+	tx = db.BeginTransaction()
+	repo := NewUserRepository(tx.Context())
+	repo.Save(&User{Age: 35, Name: "Outbox"})
+
+	for _, text := range []string{"First", "Second"} {
+		m := broker.Message{
+			Topic:   topic,
+			Value:   &OutboxPayload{Text: text},
+			Context: broker.MessageContext{"TestKey": "TestValue"},
+		}
+
+		err = gorm.AddToOutbox(tx.Context(), "user-1", m)
+		assert.NoError(t, err, "AddToOutbox returned an error")
+	}
+	tx.Commit()
+
+	n, err := relay.Dispatch(context.Background())
+	assert.NoError(t, err, "Dispatch returned an error")
+	assert.Equal(t, 2, n)
+
+	for _, text := range []string{"First", "Second"} {
+		m := <-messages
+		assert.Equal(t, "TestValue", m.Context["TestKey"])
+
+		var payload OutboxPayload
+		assert.NoError(t, broker.Decode(m, &payload), "Decode returned an error")
+		assert.Equal(t, text, payload.Text)
+	}
+
+	// dispatched messages are not published again
+	n, err = relay.Dispatch(context.Background())
+	assert.NoError(t, err, "Dispatch returned an error")
+	assert.Equal(t, 0, n)
+}
+
+func TestOutboxOrdering(t *testing.T) {
+	b := &FailingBroker{MessageBroker: memory.NewMessageBroker(), topic: "TestFailingTopic"}
+	defer b.Dispose()
+
+	db, relay := newOutboxRelay(t, b)
+	defer db.Dispose()
+
+	tx := db.BeginTransaction()
+	gorm.AddToOutbox(tx.Context(), "user-1", broker.Message{Topic: "TestFailingTopic", Value: 1})
+	gorm.AddToOutbox(tx.Context(), "user-1", broker.Message{Topic: "TestOutboxTopic", Value: 2})
+	gorm.AddToOutbox(tx.Context(), "user-2", broker.Message{Topic: "TestOutboxTopic", Value: 3})
+	tx.Commit()
+
+	// failed message blocks next messages of the same aggregate only
+	n, err := relay.Dispatch(context.Background())
+	assert.NoError(t, err, "Dispatch returned an error")
+	assert.Equal(t, 1, n)
+
+	var failed gorm.OutboxMessage
+	db.DB.First(&failed, "topic = ?", "TestFailingTopic")
+	assert.Equal(t, 1, failed.Attempts)
+	assert.Equal(t, "test error", failed.LastError)
+	assert.Nil(t, failed.DispatchedAt)
+	assert.NotNil(t, failed.NextAttemptAt)
+
+	// message is not retried before retry delay
+	n, err = relay.Dispatch(context.Background())
+	assert.NoError(t, err, "Dispatch returned an error")
+	assert.Equal(t, 0, n)
+}
+
+func TestOutboxRetryDoesNotBlockBatch(t *testing.T) {
+	b := &FailingBroker{MessageBroker: memory.NewMessageBroker(), topic: "TestFailingTopic"}
+	defer b.Dispose()
+
+	db, relay := newOutboxRelay(t, b, gorm.BatchSize(1))
+	defer db.Dispose()
+
+	tx := db.BeginTransaction()
+	gorm.AddToOutbox(tx.Context(), "user-1", broker.Message{Topic: "TestFailingTopic", Value: 1})
+	gorm.AddToOutbox(tx.Context(), "user-1", broker.Message{Topic: "TestOutboxTopic", Value: 2})
+	gorm.AddToOutbox(tx.Context(), "user-2", broker.Message{Topic: "TestOutboxTopic", Value: 3})
+	tx.Commit()
+
+	n, err := relay.Dispatch(context.Background())
+	assert.NoError(t, err, "Dispatch returned an error")
+	assert.Equal(t, 0, n)
+
+	// message waiting for retry and next message of its aggregate are not selected
+	n, err = relay.Dispatch(context.Background())
+	assert.NoError(t, err, "Dispatch returned an error")
+	assert.Equal(t, 1, n)
+
+	var dispatched gorm.OutboxMessage
+	db.DB.First(&dispatched, "aggregate_key = ?", "user-2")
+	assert.NotNil(t, dispatched.DispatchedAt)
+
+	n, err = relay.Dispatch(context.Background())
+	assert.NoError(t, err, "Dispatch returned an error")
+	assert.Equal(t, 0, n)
+}
+
+func TestOutboxPurge(t *testing.T) {
+	b := &FailingBroker{MessageBroker: memory.NewMessageBroker(), topic: "TestFailingTopic"}
+	defer b.Dispose()
+
+	db, relay := newOutboxRelay(t, b)
+	defer db.Dispose()
+
+	tx := db.BeginTransaction()
+	gorm.AddToOutbox(tx.Context(), "user-1", broker.Message{Topic: "TestFailingTopic", Value: 1})
+	gorm.AddToOutbox(tx.Context(), "user-2", broker.Message{Topic: "TestOutboxTopic", Value: 2})
+	tx.Commit()
+
+	n, err := relay.Dispatch(context.Background())
+	assert.NoError(t, err, "Dispatch returned an error")
+	assert.Equal(t, 1, n)
+
+	var count int
+
+	// dispatched message is kept for retention time
+	assert.NoError(t, relay.Purge(), "Purge returned an error")
+	db.DB.Model(&gorm.OutboxMessage{}).Count(&count)
+	assert.Equal(t, 2, count)
+
+	// pending message is not removed
+	relay.Options.Retention = 0
+	assert.NoError(t, relay.Purge(), "Purge returned an error")
+	db.DB.Model(&gorm.OutboxMessage{}).Count(&count)
+	assert.Equal(t, 1, count)
+}
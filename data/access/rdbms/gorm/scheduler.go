@@ -0,0 +1,238 @@
+package gorm
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gkarlik/quark-go/broker"
+	"github.com/gkarlik/quark-go/data/access/rdbms"
+	"github.com/gkarlik/quark-go/logger"
+)
+
+const (
+	schedulerComponentName = "GORMScheduler"
+	scheduledTableName     = "scheduled_messages"
+)
+
+// ScheduledMessage represents delayed message stored in scheduled messages table until it is due and published by Scheduler.
+type ScheduledMessage struct {
+	ID        uint      `gorm:"primary_key"`
+	Topic     string    `gorm:"size:255"` // message topic
+	Value     []byte    // encoded message value
+	Context   string    `gorm:"type:text"` // JSON encoded message context
+	DeliverAt time.Time `gorm:"index"`     // time when message is due, postponed after failed publish attempt
+	CreatedAt time.Time // time when message was scheduled
+	Attempts  int       // number of failed publish attempts
+	LastError string    `gorm:"type:text"` // last publish error
+}
+
+// TableName returns name of scheduled messages table.
+func (ScheduledMessage) TableName() string {
+	return scheduledTableName
+}
+
+// Schedule stores delayed message (see broker.PublishAt) in scheduled messages table, so it is published by Scheduler
+// when it is due. If database context is in transaction, message is scheduled only if transaction is committed.
+// Message which is not delayed is scheduled for immediate delivery.
+func Schedule(c rdbms.DbContext, m broker.Message) error {
+	if m.Topic == "" {
+		logger.Log().ErrorWithFields(logger.Fields{"component": schedulerComponentName}, "Cannot schedule message - message topic cannot be empty")
+
+		return fmt.Errorf("[%s]: Cannot schedule message - message topic cannot be empty", schedulerComponentName)
+	}
+
+	deliverAt, ok := broker.DeliverAt(m)
+	if !ok {
+		deliverAt = time.Now()
+	}
+
+	// identifier is assigned once, so consumers can detect message published more than once by scheduler
+	m = broker.WithMessageID(m)
+
+	value, ctx, err := encodeMessage(m)
+	if err != nil {
+		logger.Log().ErrorWithFields(logger.Fields{
+			"error":     err,
+			"message":   m,
+			"component": schedulerComponentName,
+		}, "Cannot encode message")
+
+		return err
+	}
+
+	sm := &ScheduledMessage{
+		Topic:     m.Topic,
+		Value:     value,
+		Context:   ctx,
+		DeliverAt: deliverAt.UTC(),
+	}
+
+	if err := c.(*DbContext).DB.Create(sm).Error; err != nil {
+		logger.Log().ErrorWithFields(logger.Fields{
+			"error":     err,
+			"topic":     m.Topic,
+			"component": schedulerComponentName,
+		}, "Cannot schedule message")
+
+		return err
+	}
+
+	logger.Log().DebugWithFields(logger.Fields{
+		"topic":      m.Topic,
+		"id":         broker.MessageID(m),
+		"deliver-at": sm.DeliverAt,
+		"component":  schedulerComponentName,
+	}, "Message scheduled")
+
+	return nil
+}
+
+// Scheduler represents message broker which stores delayed messages (see broker.PublishAt) in scheduled messages table
+// and publishes them using next message broker when they are due. Messages which are not delayed are published immediately.
+// Scheduled messages survive process restarts - they are published by Run (or Dispatch) of any scheduler using the same table.
+// Messages are published at least once, so only one scheduler should poll the same table and consumers should be idempotent.
+// Scheduler accepts outbox relay options - PollInterval, BatchSize and RetryDelay.
+type Scheduler struct {
+	broker.MessageBroker // message broker which publishes due messages
+
+	Context *DbContext    // database context
+	Options OutboxOptions // scheduler options
+}
+
+// NewScheduler creates scheduler which publishes due messages using message broker. Scheduled messages table
+// is created if it does not exist.
+func NewScheduler(c *DbContext, b broker.MessageBroker, opts ...OutboxOption) (*Scheduler, error) {
+	s := &Scheduler{
+		MessageBroker: b,
+		Context:       c,
+		Options: OutboxOptions{
+			PollInterval:  defaultPollInterval,
+			BatchSize:     defaultBatchSize,
+			RetryDelay:    defaultRetryDelay,
+			MaxRetryDelay: defaultMaxRetryDelay,
+		},
+	}
+
+	for _, opt := range opts {
+		opt(&s.Options)
+	}
+
+	if err := c.DB.AutoMigrate(&ScheduledMessage{}).Error; err != nil {
+		logger.Log().ErrorWithFields(logger.Fields{
+			"error":     err,
+			"component": schedulerComponentName,
+		}, "Cannot create scheduled messages table")
+
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// PublishMessage schedules delayed message or publishes message which is due using next message broker.
+func (s *Scheduler) PublishMessage(ctx context.Context, m broker.Message) error {
+	if broker.Due(m) > 0 {
+		return Schedule(s.Context, m)
+	}
+	return s.MessageBroker.PublishMessage(ctx, m)
+}
+
+// Run publishes due messages periodically until context is done.
+func (s *Scheduler) Run(ctx context.Context) error {
+	logger.Log().InfoWithFields(logger.Fields{
+		"interval":  s.Options.PollInterval,
+		"component": schedulerComponentName,
+	}, "Scheduler started")
+
+	ticker := time.NewTicker(s.Options.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.Dispatch(ctx); err != nil {
+			logger.Log().ErrorWithFields(logger.Fields{
+				"error":     err,
+				"component": schedulerComponentName,
+			}, "Cannot dispatch scheduled messages")
+		}
+
+		select {
+		case <-ctx.Done():
+			logger.Log().InfoWithFields(logger.Fields{"component": schedulerComponentName}, "Scheduler stopped")
+
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Dispatch publishes due messages (at most BatchSize) in order of their delivery time, removes them from scheduled
+// messages table and returns number of dispatched messages. Delivery of message which cannot be published is postponed
+// with exponential backoff.
+func (s *Scheduler) Dispatch(ctx context.Context) (int, error) {
+	var due []ScheduledMessage
+	if err := s.Context.DB.Where("deliver_at <= ?", time.Now().UTC()).Order("deliver_at, id").Limit(s.Options.BatchSize).Find(&due).Error; err != nil {
+		return 0, err
+	}
+
+	dispatched := 0
+
+	for i := range due {
+		sm := &due[i]
+
+		if ctx.Err() != nil {
+			return dispatched, ctx.Err()
+		}
+
+		if err := s.publish(ctx, sm); err != nil {
+			if err := s.fail(sm, err); err != nil {
+				return dispatched, err
+			}
+			continue
+		}
+
+		if err := s.Context.DB.Delete(sm).Error; err != nil {
+			logger.Log().ErrorWithFields(logger.Fields{
+				"error":     err,
+				"id":        sm.ID,
+				"component": schedulerComponentName,
+			}, "Cannot remove dispatched message")
+
+			return dispatched, err
+		}
+		dispatched++
+	}
+
+	return dispatched, nil
+}
+
+func (s *Scheduler) publish(ctx context.Context, sm *ScheduledMessage) error {
+	m, err := decodeMessage(sm.Topic, sm.Value, sm.Context)
+	if err != nil {
+		return err
+	}
+
+	// message is due, so next message broker must not delay it again
+	delete(m.Context, broker.DeliverAtKey)
+
+	return s.MessageBroker.PublishMessage(ctx, m)
+}
+
+func (s *Scheduler) fail(sm *ScheduledMessage, cause error) error {
+	next := time.Now().Add(retryDelay(s.Options, sm.Attempts)).UTC()
+
+	logger.Log().WarningWithFields(logger.Fields{
+		"error":     cause,
+		"id":        sm.ID,
+		"topic":     sm.Topic,
+		"attempts":  sm.Attempts + 1,
+		"retry":     next,
+		"component": schedulerComponentName,
+	}, "Cannot publish scheduled message")
+
+	return s.Context.DB.Model(sm).Updates(map[string]interface{}{
+		"attempts":   sm.Attempts + 1,
+		"last_error": cause.Error(),
+		"deliver_at": next,
+	}).Error
+}
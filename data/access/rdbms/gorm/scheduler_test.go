@@ -0,0 +1,114 @@
+package gorm_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gkarlik/quark-go/broker"
+	"github.com/gkarlik/quark-go/broker/memory"
+	"github.com/gkarlik/quark-go/data/access/rdbms/gorm"
+	"github.com/stretchr/testify/assert"
+)
+
+func newScheduler(t *testing.T, b broker.MessageBroker) (*gorm.DbContext, *gorm.Scheduler) {
+	db := NewDbContext().(*gorm.DbContext)
+
+	s, err := gorm.NewScheduler(db, b, gorm.RetryDelay(time.Hour, time.Hour))
+	assert.NoError(t, err, "NewScheduler returned an error")
+
+	db.DB.Delete(&gorm.ScheduledMessage{})
+
+	return db, s
+}
+
+func TestScheduler(t *testing.T) {
+	topic := "TestSchedulerTopic"
+
+	b := memory.NewMessageBroker()
+	defer b.Dispose()
+
+	db, s := newScheduler(t, b)
+	defer db.Dispose()
+
+	messages, err := s.Subscribe(context.Background(), topic)
+	assert.NoError(t, err, "Subscribe returned an error")
+
+	// messages are dispatched in order of delivery time
+	for _, text := range []string{"Second", "First"} {
+		d := time.Duration(len(text)) * 10 * time.Millisecond
+		m := broker.Delay(broker.Message{Topic: topic, Value: &OutboxPayload{Text: text}}, d)
+
+		err = s.PublishMessage(context.Background(), m)
+		assert.NoError(t, err, "PublishMessage returned an error")
+	}
+
+	err = s.PublishMessage(context.Background(), broker.Delay(broker.Message{Topic: topic, Value: &OutboxPayload{Text: "Later"}}, time.Hour))
+	assert.NoError(t, err, "PublishMessage returned an error")
+
+	// message which is not delayed is published immediately
+	err = s.PublishMessage(context.Background(), broker.Message{Topic: topic, Value: &OutboxPayload{Text: "Now"}})
+	assert.NoError(t, err, "PublishMessage returned an error")
+
+	var payload OutboxPayload
+	assert.NoError(t, broker.Decode(<-messages, &payload), "Decode returned an error")
+	assert.Equal(t, "Now", payload.Text)
+
+	// messages are not dispatched before they are due
+	n, err := s.Dispatch(context.Background())
+	assert.NoError(t, err, "Dispatch returned an error")
+	assert.Equal(t, 0, n)
+
+	time.Sleep(100 * time.Millisecond)
+
+	n, err = s.Dispatch(context.Background())
+	assert.NoError(t, err, "Dispatch returned an error")
+	assert.Equal(t, 2, n)
+
+	for _, text := range []string{"First", "Second"} {
+		m := <-messages
+		assert.NotEmpty(t, broker.MessageID(m))
+
+		_, delayed := broker.DeliverAt(m)
+		assert.False(t, delayed, "Dispatched message should not be delayed")
+
+		assert.NoError(t, broker.Decode(m, &payload), "Decode returned an error")
+		assert.Equal(t, text, payload.Text)
+	}
+
+	var count int
+	db.DB.Model(&gorm.ScheduledMessage{}).Count(&count)
+	assert.Equal(t, 1, count)
+}
+
+func TestSchedulerRetry(t *testing.T) {
+	b := &FailingBroker{MessageBroker: memory.NewMessageBroker(), topic: "TestFailingTopic"}
+	defer b.Dispose()
+
+	db, s := newScheduler(t, b)
+	defer db.Dispose()
+
+	tx := db.BeginTransaction()
+	err := gorm.Schedule(tx.Context(), broker.Message{Topic: "TestFailingTopic", Value: 1})
+	assert.NoError(t, err, "Schedule returned an error")
+	tx.Commit()
+
+	// message of rolled back transaction is not scheduled
+	tx = db.BeginTransaction()
+	gorm.Schedule(tx.Context(), broker.Message{Topic: "TestSchedulerTopic", Value: 2})
+	tx.Rollback()
+
+	n, err := s.Dispatch(context.Background())
+	assert.NoError(t, err, "Dispatch returned an error")
+	assert.Equal(t, 0, n)
+
+	var failed gorm.ScheduledMessage
+	db.DB.First(&failed, "topic = ?", "TestFailingTopic")
+	assert.Equal(t, 1, failed.Attempts)
+	assert.Equal(t, "test error", failed.LastError)
+	assert.True(t, failed.DeliverAt.After(time.Now().Add(time.Minute)), "Delivery should be postponed")
+
+	var count int
+	db.DB.Model(&gorm.ScheduledMessage{}).Count(&count)
+	assert.Equal(t, 1, count)
+}
@@ -0,0 +1,235 @@
+package quark
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gkarlik/quark-go/logger"
+	"github.com/gkarlik/quark-go/service/discovery"
+	"github.com/gkarlik/quark-go/system"
+)
+
+const (
+	componentName          = "ServiceLifecycle"
+	defaultShutdownTimeout = 30 * time.Second
+)
+
+// Server represents server (e.g. RPC server) which is started and stopped by service lifecycle.
+type Server interface {
+	Start(s RPCService)
+	Stop()
+
+	system.Disposer
+}
+
+// HealthChecker represents component which is able to report its health.
+// Service components implementing this interface are checked by Run before service is registered in service discovery.
+type HealthChecker interface {
+	HealthCheck() error
+}
+
+// LifecycleError represents errors collected during service lifecycle phases.
+type LifecycleError struct {
+	Errors []error // collected errors
+}
+
+// Error returns all collected errors as single message.
+func (e LifecycleError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		msgs = append(msgs, err.Error())
+	}
+
+	return fmt.Sprintf("[%s]: %d error(s) occurred: %s", componentName, len(e.Errors), strings.Join(msgs, "; "))
+}
+
+// Run runs service lifecycle. It checks health of service components, registers service in service discovery and starts attached servers.
+// Then it waits for interrupt signal (SIGINT, SIGTERM), context cancellation or server failure. Finally it stops servers, deregisters service
+// and disposes components in reverse order within configured shutdown timeout.
+// Errors from each phase are collected and returned as LifecycleError. Returns nil if all phases succeed.
+func Run(ctx context.Context, s Service) error {
+	var errs []error
+	servers := s.Options().Servers
+
+	s.Log().InfoWithFields(logger.Fields{
+		"service":   s.Info().Name,
+		"component": componentName,
+	}, "Starting service")
+
+	for _, c := range components(s) {
+		if hc, ok := c.(HealthChecker); ok {
+			if err := hc.HealthCheck(); err != nil {
+				s.Log().ErrorWithFields(logger.Fields{
+					"error":     err,
+					"component": componentName,
+				}, "Component health check failed")
+
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	var rs RPCService
+	if len(servers) > 0 {
+		var ok bool
+		if rs, ok = s.(RPCService); !ok {
+			errs = append(errs, fmt.Errorf("[%s]: Cannot start servers - service must implement RPCService interface", componentName))
+		}
+	}
+
+	if len(errs) > 0 {
+		return newLifecycleError(append(errs, shutdown(s, nil, false)...))
+	}
+
+	registered := false
+	if s.Discovery() != nil {
+		if err := s.Discovery().RegisterService(discovery.WithInfo(s.Info())); err != nil {
+			s.Log().ErrorWithFields(logger.Fields{
+				"error":     err,
+				"component": componentName,
+			}, "Cannot register service")
+
+			errs = append(errs, err)
+			return newLifecycleError(append(errs, shutdown(s, nil, false)...))
+		}
+		registered = true
+	}
+
+	// buffered to not block server goroutines which fail after shutdown was started
+	failures := make(chan error, len(servers))
+	for _, srv := range servers {
+		go func(srv Server) {
+			if err := safeCall("start server", func() { srv.Start(rs) }); err != nil {
+				failures <- err
+			}
+		}(srv)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	select {
+	case <-ctx.Done():
+		s.Log().InfoWithFields(logger.Fields{"component": componentName}, "Service context is done")
+	case sig := <-signals:
+		s.Log().InfoWithFields(logger.Fields{
+			"signal":    sig,
+			"component": componentName,
+		}, "Received interrupt signal")
+	case err := <-failures:
+		s.Log().ErrorWithFields(logger.Fields{
+			"error":     err,
+			"component": componentName,
+		}, "Server failure")
+
+		errs = append(errs, err)
+	}
+
+	return newLifecycleError(append(errs, shutdown(s, servers, registered)...))
+}
+
+func newLifecycleError(errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return LifecycleError{Errors: errs}
+}
+
+func components(s Service) []interface{} {
+	var cs []interface{}
+
+	if s.Tracer() != nil {
+		cs = append(cs, s.Tracer())
+	}
+	if s.Metrics() != nil {
+		cs = append(cs, s.Metrics())
+	}
+	if s.Discovery() != nil {
+		cs = append(cs, s.Discovery())
+	}
+	if s.Broker() != nil {
+		cs = append(cs, s.Broker())
+	}
+	for _, srv := range s.Options().Servers {
+		cs = append(cs, srv)
+	}
+	return cs
+}
+
+// shutdown stops servers, deregisters service and disposes components within configured shutdown timeout.
+func shutdown(s Service, servers []Server, deregister bool) []error {
+	timeout := s.Options().ShutdownTimeout
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+
+	s.Log().InfoWithFields(logger.Fields{
+		"timeout":   timeout,
+		"component": componentName,
+	}, "Shutting down service")
+
+	done := make(chan []error, 1)
+	go func() {
+		var errs []error
+
+		for i := len(servers) - 1; i >= 0; i-- {
+			if err := safeCall("stop server", servers[i].Stop); err != nil {
+				errs = append(errs, err)
+			}
+		}
+
+		if deregister {
+			if err := s.Discovery().DeregisterService(discovery.WithInfo(s.Info())); err != nil {
+				errs = append(errs, err)
+			}
+		}
+
+		for i := len(servers) - 1; i >= 0; i-- {
+			if err := safeCall("dispose server", servers[i].Dispose); err != nil {
+				errs = append(errs, err)
+			}
+		}
+
+		if err := safeCall("dispose service", s.Dispose); err != nil {
+			errs = append(errs, err)
+		}
+
+		done <- errs
+	}()
+
+	select {
+	case errs := <-done:
+		for _, err := range errs {
+			s.Log().ErrorWithFields(logger.Fields{
+				"error":     err,
+				"component": componentName,
+			}, "Error during service shutdown")
+		}
+		return errs
+	case <-time.After(timeout):
+		s.Log().ErrorWithFields(logger.Fields{
+			"timeout":   timeout,
+			"component": componentName,
+		}, "Service shutdown timed out")
+
+		return []error{fmt.Errorf("[%s]: Service shutdown exceeded timeout %v", componentName, timeout)}
+	}
+}
+
+// safeCall calls function f and converts panic (if any) into error.
+func safeCall(phase string, f func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("[%s]: Cannot %s: %v", componentName, phase, r)
+		}
+	}()
+
+	f()
+	return nil
+}
@@ -0,0 +1,244 @@
+package quark_test
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gkarlik/quark-go"
+	"github.com/gkarlik/quark-go/service/discovery"
+	"github.com/stretchr/testify/assert"
+)
+
+type LifecycleDiscovery struct {
+	mu           sync.Mutex
+	registered   int
+	deregistered int
+	registerErr  error
+}
+
+func (sd *LifecycleDiscovery) RegisterService(options ...discovery.Option) error {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+
+	sd.registered++
+	return sd.registerErr
+}
+
+func (sd *LifecycleDiscovery) DeregisterService(options ...discovery.Option) error {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+
+	sd.deregistered++
+	return nil
+}
+
+func (sd *LifecycleDiscovery) GetServiceAddress(options ...discovery.Option) (*url.URL, error) {
+	return nil, nil
+}
+
+func (sd *LifecycleDiscovery) GetServiceInstances(options ...discovery.Option) ([]discovery.Instance, error) {
+	return nil, nil
+}
+
+func (sd *LifecycleDiscovery) Watch(ctx context.Context, options ...discovery.Option) (<-chan []discovery.Instance, error) {
+	return nil, nil
+}
+
+func (sd *LifecycleDiscovery) Dispose() {}
+
+type UnhealthyBroker struct {
+	TestBroker
+}
+
+func (b *UnhealthyBroker) HealthCheck() error {
+	return errors.New("Broker is not healthy")
+}
+
+type TestServer struct {
+	mu       sync.Mutex
+	started  chan bool
+	stop     chan bool
+	fail     bool
+	block    time.Duration
+	events   []string
+	disposed bool
+}
+
+func NewTestServer() *TestServer {
+	return &TestServer{
+		started: make(chan bool, 1),
+		stop:    make(chan bool),
+	}
+}
+
+func (s *TestServer) Start(svc quark.RPCService) {
+	s.started <- true
+	if s.fail {
+		panic("Cannot listen on port")
+	}
+	<-s.stop
+}
+
+func (s *TestServer) Stop() {
+	time.Sleep(s.block)
+
+	s.mu.Lock()
+	s.events = append(s.events, "stop")
+	s.mu.Unlock()
+
+	close(s.stop)
+}
+
+func (s *TestServer) Dispose() {
+	s.mu.Lock()
+	s.events = append(s.events, "dispose")
+	s.mu.Unlock()
+}
+
+func (s *TestServer) Events() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.events
+}
+
+type TestRPCService struct {
+	*quark.ServiceBase
+}
+
+func (s *TestRPCService) RegisterServiceInstance(server interface{}, serviceInstance interface{}) error {
+	return nil
+}
+
+func TestRun(t *testing.T) {
+	a, _ := quark.GetHostAddress(1234)
+
+	d := &LifecycleDiscovery{}
+	srv := NewTestServer()
+
+	s := &TestRPCService{
+		ServiceBase: quark.NewService(
+			quark.Name("TestService"),
+			quark.Version("1.0"),
+			quark.Address(a),
+			quark.Discovery(d),
+			quark.Servers(srv)),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-srv.started
+		cancel()
+	}()
+
+	err := quark.Run(ctx, s)
+	assert.NoError(t, err, "Run returned an error")
+	assert.Equal(t, 1, d.registered)
+	assert.Equal(t, 1, d.deregistered)
+	assert.Equal(t, []string{"stop", "dispose"}, srv.Events())
+}
+
+func TestRunServerFailure(t *testing.T) {
+	a, _ := quark.GetHostAddress(1234)
+
+	d := &LifecycleDiscovery{}
+	srv := NewTestServer()
+	srv.fail = true
+
+	s := &TestRPCService{
+		ServiceBase: quark.NewService(
+			quark.Name("TestService"),
+			quark.Version("1.0"),
+			quark.Address(a),
+			quark.Discovery(d),
+			quark.Servers(srv)),
+	}
+
+	err := quark.Run(context.Background(), s)
+	assert.Error(t, err, "Run should return an error")
+	assert.Len(t, err.(quark.LifecycleError).Errors, 1)
+	assert.Equal(t, 1, d.deregistered)
+}
+
+func TestRunHealthCheckFailure(t *testing.T) {
+	a, _ := quark.GetHostAddress(1234)
+
+	d := &LifecycleDiscovery{}
+
+	s := &TestService{
+		ServiceBase: quark.NewService(
+			quark.Name("TestService"),
+			quark.Version("1.0"),
+			quark.Address(a),
+			quark.Discovery(d),
+			quark.Broker(&UnhealthyBroker{})),
+	}
+
+	err := quark.Run(context.Background(), s)
+	assert.Error(t, err, "Run should return an error")
+	assert.Contains(t, err.Error(), "Broker is not healthy")
+	assert.Equal(t, 0, d.registered)
+}
+
+func TestRunRegistrationFailure(t *testing.T) {
+	a, _ := quark.GetHostAddress(1234)
+
+	d := &LifecycleDiscovery{registerErr: errors.New("Cannot register")}
+
+	s := &TestService{
+		ServiceBase: quark.NewService(
+			quark.Name("TestService"),
+			quark.Version("1.0"),
+			quark.Address(a),
+			quark.Discovery(d)),
+	}
+
+	err := quark.Run(context.Background(), s)
+	assert.Error(t, err, "Run should return an error")
+	assert.Equal(t, 0, d.deregistered)
+}
+
+func TestRunServersWithoutRPCService(t *testing.T) {
+	a, _ := quark.GetHostAddress(1234)
+
+	s := &TestService{
+		ServiceBase: quark.NewService(
+			quark.Name("TestService"),
+			quark.Version("1.0"),
+			quark.Address(a),
+			quark.Servers(NewTestServer())),
+	}
+
+	err := quark.Run(context.Background(), s)
+	assert.Error(t, err, "Run should return an error")
+}
+
+func TestRunShutdownTimeout(t *testing.T) {
+	a, _ := quark.GetHostAddress(1234)
+
+	srv := NewTestServer()
+	srv.block = 500 * time.Millisecond
+
+	s := &TestRPCService{
+		ServiceBase: quark.NewService(
+			quark.Name("TestService"),
+			quark.Version("1.0"),
+			quark.Address(a),
+			quark.Servers(srv),
+			quark.ShutdownTimeout(50*time.Millisecond)),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-srv.started
+		cancel()
+	}()
+
+	err := quark.Run(ctx, s)
+	assert.Error(t, err, "Run should return an error")
+	assert.Contains(t, err.Error(), "timeout")
+}
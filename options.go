@@ -2,6 +2,7 @@ package quark
 
 import (
 	"net/url"
+	"time"
 
 	"context"
 	"github.com/gkarlik/quark-go/broker"
@@ -24,6 +25,9 @@ type Options struct {
 	Metrics   metrics.Exposer            // service metrics collector interface implementation
 	Tracer    trace.Tracer               // service request tracer interface implementation
 
+	Servers         []Server      // servers started and stopped by service lifecycle
+	ShutdownTimeout time.Duration // maximum time for graceful service shutdown
+
 	Context context.Context // service context
 }
 
@@ -89,3 +93,17 @@ func Metrics(e metrics.Exposer) Option {
 		o.Metrics = e
 	}
 }
+
+// Servers allows to attach server(s) (e.g. RPC server) which are started and stopped by service lifecycle (see Run).
+func Servers(servers ...Server) Option {
+	return func(o *Options) {
+		o.Servers = append(o.Servers, servers...)
+	}
+}
+
+// ShutdownTimeout allows to set maximum time for graceful service shutdown. Default timeout is 30 seconds.
+func ShutdownTimeout(timeout time.Duration) Option {
+	return func(o *Options) {
+		o.ShutdownTimeout = timeout
+	}
+}
@@ -40,8 +40,9 @@ type ServiceBase struct {
 func NewService(opts ...Option) *ServiceBase {
 	s := &ServiceBase{
 		options: Options{
-			Info:   service.Info{},
-			Logger: logger.Log(),
+			Info:            service.Info{},
+			Logger:          logger.Log(),
+			ShutdownTimeout: defaultShutdownTimeout,
 		},
 	}
 
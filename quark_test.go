@@ -39,6 +39,14 @@ func (sd *TestServiceDiscovery) GetServiceAddress(options ...discovery.Option) (
 	return nil, nil
 }
 
+func (sd *TestServiceDiscovery) GetServiceInstances(options ...discovery.Option) ([]discovery.Instance, error) {
+	return nil, nil
+}
+
+func (sd *TestServiceDiscovery) Watch(ctx context.Context, options ...discovery.Option) (<-chan []discovery.Instance, error) {
+	return nil, nil
+}
+
 func (sd *TestServiceDiscovery) Dispose() {}
 
 type TestBroker struct{}
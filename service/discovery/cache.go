@@ -0,0 +1,70 @@
+package discovery
+
+import (
+	"context"
+	"net/url"
+	"sync"
+
+	lb "github.com/gkarlik/quark-go/service/loadbalancer"
+)
+
+// Cache represents client-side cache of service instances which is kept up to date by watching service discovery catalog,
+// so service address can be picked without querying the catalog.
+type Cache struct {
+	mu        sync.RWMutex
+	instances []Instance
+	ready     chan struct{} // closed when the first instance set is received
+}
+
+// NewCache creates cache of service instances (selected by options) and starts watching service discovery catalog.
+// Cache is updated until context is done - after that it holds the last received instance set.
+func NewCache(ctx context.Context, sd ServiceDiscovery, options ...Option) (*Cache, error) {
+	updates, err := sd.Watch(ctx, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Cache{
+		ready: make(chan struct{}),
+	}
+
+	go func() {
+		first := true
+
+		for instances := range updates {
+			c.mu.Lock()
+			c.instances = instances
+			c.mu.Unlock()
+
+			if first {
+				close(c.ready)
+				first = false
+			}
+		}
+	}()
+
+	return c, nil
+}
+
+// Wait blocks until cache receives the first instance set or context is done.
+func (c *Cache) Wait(ctx context.Context) error {
+	select {
+	case <-c.ready:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Instances returns current service instances. It returns nil if instances have not been received yet.
+func (c *Cache) Instances() []Instance {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.instances
+}
+
+// GetServiceAddress returns address of healthy service instance picked by load balancing strategy (see PickServiceAddress).
+func (c *Cache) GetServiceAddress(s lb.LoadBalancingStrategy) (*url.URL, error) {
+	return PickServiceAddress(c.Instances(), s)
+}
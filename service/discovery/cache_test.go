@@ -0,0 +1,54 @@
+package discovery_test
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gkarlik/quark-go/service/discovery"
+	"github.com/stretchr/testify/assert"
+)
+
+type WatchedDiscovery struct {
+	discovery.ServiceDiscovery
+
+	updates chan []discovery.Instance
+}
+
+func (sd *WatchedDiscovery) Watch(ctx context.Context, options ...discovery.Option) (<-chan []discovery.Instance, error) {
+	return sd.updates, nil
+}
+
+func TestCache(t *testing.T) {
+	addr1, _ := url.Parse("//10.0.0.1:8080")
+	addr2, _ := url.Parse("//10.0.0.2:8080")
+
+	sd := &WatchedDiscovery{updates: make(chan []discovery.Instance)}
+
+	c, err := discovery.NewCache(context.Background(), sd, discovery.ByName("TestService"))
+	assert.NoError(t, err, "NewCache returns an error")
+
+	// cache is not ready until the first instance set is received
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	assert.Equal(t, context.DeadlineExceeded, c.Wait(ctx))
+	assert.Nil(t, c.Instances())
+
+	sd.updates <- []discovery.Instance{{ID: "1", Address: addr1, Health: discovery.HealthPassing}}
+
+	assert.NoError(t, c.Wait(context.Background()), "Wait returns an error")
+
+	a, err := c.GetServiceAddress(nil)
+	assert.NoError(t, err, "GetServiceAddress returns an error")
+	assert.Equal(t, addr1, a)
+
+	sd.updates <- []discovery.Instance{{ID: "2", Address: addr2, Health: discovery.HealthPassing}}
+	close(sd.updates)
+
+	assert.Eventually(t, func() bool {
+		a, _ := c.GetServiceAddress(nil)
+		return a == addr2
+	}, time.Second, time.Millisecond)
+}
@@ -1,17 +1,26 @@
 package consul
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"net/url"
 	"strconv"
+	"time"
 
 	"github.com/gkarlik/quark-go/logger"
 	"github.com/gkarlik/quark-go/service/discovery"
 	"github.com/hashicorp/consul/api"
 )
 
-const componentName = "ConsulServiceDiscovery"
+const (
+	// VersionMetaKey defines key of service metadata which service version is registered with.
+	VersionMetaKey = "version"
+
+	componentName = "ConsulServiceDiscovery"
+
+	watchWaitTime = 5 * time.Minute
+)
 
 // ServiceDiscovery represents service discovery mechanism based on Consul by Hashicorp.
 type ServiceDiscovery struct {
@@ -43,7 +52,7 @@ func NewServiceDiscovery(address string) *ServiceDiscovery {
 	}
 }
 
-// RegisterService registers service in service discovery catalog.
+// RegisterService registers service in service discovery catalog. Service instance is identified by ID (service name if not set).
 func (c ServiceDiscovery) RegisterService(options ...discovery.Option) error {
 	opts := new(discovery.Options)
 	for _, o := range options {
@@ -55,8 +64,13 @@ func (c ServiceDiscovery) RegisterService(options ...discovery.Option) error {
 	_, port, _ := net.SplitHostPort(opts.Info.Address.Host)
 	p, _ := strconv.Atoi(port)
 
+	id := opts.ID
+	if id == "" {
+		id = opts.Info.Name
+	}
+
 	logger.Log().InfoWithFields(logger.Fields{
-		"ID":        opts.Info.Name,
+		"ID":        id,
 		"Name":      opts.Info.Name,
 		"Tags":      opts.Info.Tags,
 		"Port":      p,
@@ -64,78 +78,174 @@ func (c ServiceDiscovery) RegisterService(options ...discovery.Option) error {
 		"component": componentName,
 	}, "Registering service in Consul server")
 
+	meta := make(map[string]string, len(opts.Metadata)+1)
+	for k, v := range opts.Metadata {
+		meta[k] = v
+	}
+	if opts.Info.Version != "" {
+		meta[VersionMetaKey] = opts.Info.Version
+	}
+
 	return c.Client.Agent().ServiceRegister(&api.AgentServiceRegistration{
-		ID:      opts.Info.Name,
+		ID:      id,
 		Name:    opts.Info.Name,
 		Tags:    opts.Info.Tags,
 		Port:    p,
 		Address: opts.Info.Address.Hostname(),
+		Meta:    meta,
 	})
 }
 
-// DeregisterService unregisters service in service discovery catalog.
+// DeregisterService unregisters service instance (identified by ID or service name) in service discovery catalog.
 func (c ServiceDiscovery) DeregisterService(options ...discovery.Option) error {
 	opts := new(discovery.Options)
 	for _, o := range options {
 		o(opts)
 	}
 
+	id := opts.ID
+	if id == "" {
+		id = opts.Info.Name
+	}
+
 	logger.Log().InfoWithFields(logger.Fields{
-		"ID":        opts.Info.Name,
+		"ID":        id,
 		"component": componentName,
 	}, "Deregistering service in Consul server")
 
-	return c.Client.Agent().ServiceDeregister(opts.Info.Name)
+	return c.Client.Agent().ServiceDeregister(id)
 }
 
-// GetServiceAddress gets service address from service discovery catalog.
+// GetServiceAddress gets address of healthy service instance from service discovery catalog using load balancing strategy.
 func (c ServiceDiscovery) GetServiceAddress(options ...discovery.Option) (*url.URL, error) {
 	opts := new(discovery.Options)
 	for _, o := range options {
 		o(opts)
 	}
 
-	tag := ""
-	if len(opts.Info.Tags) > 0 {
-		tag = opts.Info.Tags[0]
+	instances, err := c.GetServiceInstances(options...)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Strategy == nil {
+		logger.Log().DebugWithFields(logger.Fields{"component": componentName}, "Load balancing strategy is not set. Picking first item from the list.")
+	} else {
+		logger.Log().InfoWithFields(logger.Fields{"component": componentName}, "Picking service using load balancing strategy")
+	}
+
+	sa, err := discovery.PickServiceAddress(instances, opts.Strategy)
+	if sa != nil {
+		logger.Log().InfoWithFields(logger.Fields{"component": componentName, "address": sa.String()}, "Service picked")
+	}
+
+	return sa, err
+}
+
+// GetServiceInstances gets all instances of service (with the first tag and version, if set) from service discovery catalog
+// together with their aggregated health status. Instances registered without version are not filtered by version.
+func (c ServiceDiscovery) GetServiceInstances(options ...discovery.Option) ([]discovery.Instance, error) {
+	opts := new(discovery.Options)
+	for _, o := range options {
+		o(opts)
 	}
 
 	logger.Log().InfoWithFields(logger.Fields{
 		"Name":      opts.Info.Name,
 		"Tags":      opts.Info.Tags,
+		"Version":   opts.Info.Version,
 		"component": componentName,
 	}, "Getting services list from Consul server")
 
-	services, _, err := c.Client.Health().Service(opts.Info.Name, tag, true, nil)
-
+	services, _, err := c.Client.Health().Service(opts.Info.Name, firstTag(opts.Info.Tags), false, nil)
 	if err != nil {
+		logger.Log().ErrorWithFields(logger.Fields{
+			"error":     err,
+			"Name":      opts.Info.Name,
+			"component": componentName,
+		}, "Cannot get list of services")
+
 		return nil, err
 	}
 
-	srvs := make([]*url.URL, 0, len(services))
-	for _, s := range services {
-		addr, _ := url.Parse(fmt.Sprintf("//%s:%d", s.Service.Address, s.Service.Port))
-		srvs = append(srvs, addr)
+	return instances(services, opts.Info.Version), nil
+}
+
+// Watch watches instances of service (with the first tag and version, if set) using Consul blocking queries and returns
+// channel of instance sets. The current instance set is sent first, next sets are sent when instances or their health
+// status change. Channel is closed when context is done.
+func (c ServiceDiscovery) Watch(ctx context.Context, options ...discovery.Option) (<-chan []discovery.Instance, error) {
+	opts := new(discovery.Options)
+	for _, o := range options {
+		o(opts)
 	}
 
-	if len(srvs) == 0 {
-		return nil, nil
+	if opts.Info.Name == "" {
+		logger.Log().ErrorWithFields(logger.Fields{"component": componentName}, "Cannot watch service - service name cannot be empty")
+
+		return nil, fmt.Errorf("[%s]: Cannot watch service - service name cannot be empty", componentName)
 	}
 
-	if opts.Strategy == nil {
-		logger.Log().DebugWithFields(logger.Fields{"component": componentName}, "Load balancing strategy is not set. Picking first item from the list.")
+	logger.Log().InfoWithFields(logger.Fields{
+		"Name":      opts.Info.Name,
+		"Tags":      opts.Info.Tags,
+		"Version":   opts.Info.Version,
+		"component": componentName,
+	}, "Watching service in Consul server")
+
+	health := c.Client.Health()
+
+	return discovery.WatchQuery(ctx, componentName, func(ctx context.Context, index uint64) ([]discovery.Instance, uint64, error) {
+		q := &api.QueryOptions{
+			WaitIndex: index,
+			WaitTime:  watchWaitTime,
+		}
+
+		services, meta, err := health.Service(opts.Info.Name, firstTag(opts.Info.Tags), false, q.WithContext(ctx))
+		if err != nil {
+			return nil, 0, err
+		}
+
+		return instances(services, opts.Info.Version), meta.LastIndex, nil
+	}), nil
+}
 
-		return srvs[0], nil
+// firstTag returns the first tag which services are filtered by (empty if there are no tags).
+func firstTag(tags []string) string {
+	if len(tags) > 0 {
+		return tags[0]
 	}
+	return ""
+}
 
-	logger.Log().InfoWithFields(logger.Fields{"component": componentName}, "Picking service using load balancing strategy")
+// instances converts service entries of version (any version if empty) into service instances. Entries registered
+// without version are not filtered by version.
+func instances(services []*api.ServiceEntry, version string) []discovery.Instance {
+	result := make([]discovery.Instance, 0, len(services))
 
-	sa, err := opts.Strategy.PickServiceAddress(srvs)
-	if sa != nil {
-		logger.Log().InfoWithFields(logger.Fields{"component": componentName, "address": sa.String()})
+	for _, s := range services {
+		if v, ok := s.Service.Meta[VersionMetaKey]; ok && version != "" && v != version {
+			continue
+		}
+
+		address := s.Service.Address
+		if address == "" && s.Node != nil {
+			// service registered without address uses address of the node
+			address = s.Node.Address
+		}
+		addr, _ := url.Parse(fmt.Sprintf("//%s", net.JoinHostPort(address, strconv.Itoa(s.Service.Port))))
+
+		result = append(result, discovery.Instance{
+			ID:       s.Service.ID,
+			Address:  addr,
+			Version:  s.Service.Meta[VersionMetaKey],
+			Tags:     s.Service.Tags,
+			Metadata: s.Service.Meta,
+			Health:   discovery.Health(s.Checks.AggregatedStatus()),
+		})
 	}
 
-	return sa, err
+	return result
 }
 
 // Dispose closes consul client and cleans up ServiceDiscovery instance.
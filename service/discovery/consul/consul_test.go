@@ -2,6 +2,7 @@ package consul_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"io/ioutil"
@@ -9,6 +10,7 @@ import (
 	"net/url"
 	"reflect"
 	"strconv"
+	"sync"
 	"testing"
 
 	"github.com/gkarlik/quark-go/service"
@@ -33,7 +35,31 @@ func (m *HttpTransportMock) RoundTrip(req *http.Request) (res *http.Response, er
 	return m.Response, m.Error
 }
 
-func NewConsulClient(t *HttpTransportMock) *consul.ServiceDiscovery {
+// BlockingQueryMock returns responses of consecutive blocking queries and blocks when there are no more responses.
+type BlockingQueryMock struct {
+	mu        sync.Mutex
+	Indexes   []string         // indexes of received queries
+	Responses []*http.Response // responses of consecutive queries
+}
+
+func (m *BlockingQueryMock) RoundTrip(req *http.Request) (*http.Response, error) {
+	m.mu.Lock()
+	m.Indexes = append(m.Indexes, req.URL.Query().Get("index"))
+
+	if len(m.Responses) == 0 {
+		m.mu.Unlock()
+		<-req.Context().Done()
+		return nil, req.Context().Err()
+	}
+
+	res := m.Responses[0]
+	m.Responses = m.Responses[1:]
+	m.mu.Unlock()
+
+	return res, nil
+}
+
+func NewConsulClient(t http.RoundTripper) *consul.ServiceDiscovery {
 	addr := "consul"
 
 	c, _ := api.NewClient(&api.Config{
@@ -85,6 +111,7 @@ func TestRegisterService(t *testing.T) {
 	assert.Equal(t, info.Name, sr.ID)
 	assert.Equal(t, info.Name, sr.Name)
 	assert.Equal(t, info.Tags, sr.Tags)
+	assert.Equal(t, map[string]string{consul.VersionMetaKey: info.Version}, sr.Meta)
 }
 
 func TestDeregisterService(t *testing.T) {
@@ -246,6 +273,134 @@ func TestGetServiceAddressError(t *testing.T) {
 	assert.Equal(t, tag, m.Request.URL.Query()["tag"][0])
 }
 
+func TestGetServiceInstances(t *testing.T) {
+	name := "ServiceName"
+
+	m := &HttpTransportMock{}
+	services := []*api.ServiceEntry{
+		{
+			Node: &api.Node{Address: "10.0.0.1"},
+			Service: &api.AgentService{
+				Port:    8080,
+				ID:      "instance-1",
+				Service: name,
+				Tags:    []string{"A", "B"},
+				Meta:    map[string]string{consul.VersionMetaKey: "1.0", "zone": "eu"},
+			},
+			Checks: api.HealthChecks{{Status: api.HealthPassing}},
+		},
+		{
+			Service: &api.AgentService{
+				Address: "10.0.0.2",
+				Port:    8080,
+				ID:      "instance-2",
+				Service: name,
+				Tags:    []string{"A", "B"},
+				Meta:    map[string]string{consul.VersionMetaKey: "1.0"},
+			},
+			Checks: api.HealthChecks{{Status: api.HealthPassing}, {Status: api.HealthCritical}},
+		},
+		{
+			Service: &api.AgentService{
+				Address: "10.0.0.3",
+				Port:    8080,
+				ID:      "instance-3",
+				Service: name,
+				Meta:    map[string]string{consul.VersionMetaKey: "2.0"},
+			},
+		},
+		{
+			Service: &api.AgentService{
+				Address: "10.0.0.4",
+				Port:    8080,
+				ID:      "instance-4",
+				Service: name,
+				Tags:    []string{"A"},
+			},
+			Checks: api.HealthChecks{{Status: api.HealthPassing}},
+		},
+	}
+	m.Response = prepareResponse(http.StatusOK, services)
+
+	c := NewConsulClient(m)
+	instances, err := c.GetServiceInstances(discovery.ByName(name), discovery.ByTag("A"), discovery.ByTag("B"), discovery.ByVersion("1.0"))
+
+	assert.NoError(t, err, "GetServiceInstances returns an error")
+	assert.Equal(t, "/v1/health/service/ServiceName", m.Request.URL.Path)
+	// services are filtered by the first tag only
+	assert.Equal(t, []string{"A"}, m.Request.URL.Query()["tag"])
+
+	// instances of other versions are skipped, instances registered without version are not
+	assert.Len(t, instances, 3)
+
+	assert.Equal(t, "instance-1", instances[0].ID)
+	assert.Equal(t, "//10.0.0.1:8080", instances[0].Address.String())
+	assert.Equal(t, "1.0", instances[0].Version)
+	assert.Equal(t, []string{"A", "B"}, instances[0].Tags)
+	assert.Equal(t, "eu", instances[0].Metadata["zone"])
+	assert.Equal(t, discovery.HealthPassing, instances[0].Health)
+
+	assert.Equal(t, "instance-2", instances[1].ID)
+	assert.Equal(t, discovery.HealthCritical, instances[1].Health)
+
+	assert.Equal(t, "instance-4", instances[2].ID)
+	assert.Equal(t, "", instances[2].Version)
+
+	// unhealthy instances are not picked
+	m.Response = prepareResponse(http.StatusOK, services[1:2])
+
+	a, err := c.GetServiceAddress(discovery.ByName(name))
+	assert.NoError(t, err, "GetServiceAddress returns an error")
+	assert.Nil(t, a, "Result should be nil")
+}
+
+func TestWatch(t *testing.T) {
+	name := "ServiceName"
+
+	service := func(id string) []*api.ServiceEntry {
+		return []*api.ServiceEntry{{
+			Service: &api.AgentService{Address: "10.0.0.1", Port: 8080, ID: id, Service: name},
+		}}
+	}
+
+	m := &BlockingQueryMock{
+		Responses: []*http.Response{
+			prepareIndexedResponse("10", service("instance-1")),
+			prepareIndexedResponse("11", service("instance-1")),
+			prepareIndexedResponse("12", service("instance-2")),
+		},
+	}
+
+	c := NewConsulClient(m)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	updates, err := c.Watch(ctx, discovery.ByName(name))
+	assert.NoError(t, err, "Watch returns an error")
+
+	assert.Equal(t, "instance-1", (<-updates)[0].ID)
+	assert.Equal(t, "instance-2", (<-updates)[0].ID)
+
+	cancel()
+	for range updates {
+	}
+
+	m.mu.Lock()
+	assert.Equal(t, []string{"", "10", "11", "12"}, m.Indexes)
+	m.mu.Unlock()
+
+	_, err = c.Watch(context.Background())
+	assert.Error(t, err, "Watch should return an error")
+}
+
+func prepareIndexedResponse(index string, body interface{}) *http.Response {
+	res := prepareResponse(http.StatusOK, body)
+	res.Header = http.Header{"X-Consul-Index": []string{index}}
+
+	return res
+}
+
 func prepareResponse(code int, body interface{}) *http.Response {
 	b, _ := json.Marshal(body)
 
@@ -1,6 +1,7 @@
 package discovery
 
 import (
+	"context"
 	"net/url"
 
 	"github.com/gkarlik/quark-go/system"
@@ -11,6 +12,8 @@ type ServiceDiscovery interface {
 	RegisterService(options ...Option) error
 	DeregisterService(options ...Option) error
 	GetServiceAddress(options ...Option) (*url.URL, error)
+	GetServiceInstances(options ...Option) ([]Instance, error)
+	Watch(ctx context.Context, options ...Option) (<-chan []Instance, error)
 
 	system.Disposer
 }
@@ -0,0 +1,57 @@
+package discovery
+
+import (
+	"net/url"
+
+	lb "github.com/gkarlik/quark-go/service/loadbalancer"
+)
+
+// Health represents health status of service instance.
+type Health string
+
+const (
+	// HealthPassing means that service instance is healthy.
+	HealthPassing Health = "passing"
+	// HealthWarning means that service instance works, but some of its health checks report problems.
+	HealthWarning Health = "warning"
+	// HealthCritical means that service instance is not healthy.
+	HealthCritical Health = "critical"
+	// HealthMaintenance means that service instance is in maintenance mode.
+	HealthMaintenance Health = "maintenance"
+)
+
+// Instance represents registered instance of service.
+type Instance struct {
+	ID       string            // instance identifier
+	Address  *url.URL          // instance address
+	Version  string            // service version
+	Tags     []string          // service tags
+	Metadata map[string]string // instance metadata
+	Health   Health            // instance health status
+}
+
+// Healthy returns true if service instance is healthy.
+func (i Instance) Healthy() bool {
+	return i.Health == HealthPassing
+}
+
+// PickServiceAddress returns address of healthy service instance picked by load balancing strategy. If strategy
+// is not set, address of the first healthy instance is returned. It returns nil if there is no healthy instance.
+func PickServiceAddress(instances []Instance, s lb.LoadBalancingStrategy) (*url.URL, error) {
+	urls := make([]*url.URL, 0, len(instances))
+	for _, i := range instances {
+		if i.Healthy() {
+			urls = append(urls, i.Address)
+		}
+	}
+
+	if len(urls) == 0 {
+		return nil, nil
+	}
+
+	if s == nil {
+		return urls[0], nil
+	}
+
+	return s.PickServiceAddress(urls)
+}
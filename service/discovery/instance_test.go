@@ -0,0 +1,32 @@
+package discovery_test
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/gkarlik/quark-go/service/discovery"
+	"github.com/gkarlik/quark-go/service/loadbalancer/random"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPickServiceAddress(t *testing.T) {
+	addr1, _ := url.Parse("//10.0.0.1:8080")
+	addr2, _ := url.Parse("//10.0.0.2:8080")
+
+	instances := []discovery.Instance{
+		{ID: "1", Address: addr1, Health: discovery.HealthCritical},
+		{ID: "2", Address: addr2, Health: discovery.HealthPassing},
+	}
+
+	a, err := discovery.PickServiceAddress(instances, nil)
+	assert.NoError(t, err, "PickServiceAddress returns an error")
+	assert.Equal(t, addr2, a)
+
+	a, err = discovery.PickServiceAddress(instances, random.NewRandomLBStrategy())
+	assert.NoError(t, err, "PickServiceAddress returns an error")
+	assert.Equal(t, addr2, a)
+
+	a, err = discovery.PickServiceAddress(instances[:1], random.NewRandomLBStrategy())
+	assert.NoError(t, err, "PickServiceAddress returns an error")
+	assert.Nil(t, a, "Result should be nil")
+}
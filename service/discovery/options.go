@@ -10,8 +10,10 @@ type Option func(*Options)
 
 // Options represents service discovery options.
 type Options struct {
+	ID       string                   // service instance identifier
 	Info     service.Info             // service info
 	Strategy lb.LoadBalancingStrategy // load balancing strategy
+	Metadata map[string]string        // service instance metadata
 }
 
 // ByInfo allows to discover service by its info metadata.
@@ -26,6 +28,13 @@ func WithInfo(i service.Info) Option {
 	return ByInfo(i)
 }
 
+// ByID allows to register service instance with identifier or to deregister service instance by its identifier.
+func ByID(id string) Option {
+	return func(opts *Options) {
+		opts.ID = id
+	}
+}
+
 // ByName allows to discover service by its name.
 func ByName(name string) Option {
 	return func(opts *Options) {
@@ -53,3 +62,13 @@ func UsingLBStrategy(s lb.LoadBalancingStrategy) Option {
 		opts.Strategy = s
 	}
 }
+
+// WithMetadata allows to register service instance with metadata.
+func WithMetadata(key, value string) Option {
+	return func(opts *Options) {
+		if opts.Metadata == nil {
+			opts.Metadata = make(map[string]string)
+		}
+		opts.Metadata[key] = value
+	}
+}
@@ -1,2 +1,3 @@
 // Package plain provides support for self-hosted, in-memory, client-server plain discovery service mechanism.
+// Catalog can be persisted in file store and replicated between several discovery servers.
 package plain
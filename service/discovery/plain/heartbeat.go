@@ -0,0 +1,216 @@
+package plain
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gkarlik/quark-go/logger"
+	"github.com/gkarlik/quark-go/service/discovery"
+)
+
+const minEvictionInterval = 10 * time.Millisecond
+
+// heartbeat represents background process which sends heartbeats of registered service.
+type heartbeat struct {
+	info   ServiceInfo        // registered service
+	cancel context.CancelFunc // stops sending heartbeats
+	done   chan struct{}      // closed when heartbeats are stopped
+}
+
+// startHeartbeat starts sending heartbeats of registered service instance. Heartbeats of the same instance sent so far are stopped.
+func (sd *ServiceDiscovery) startHeartbeat(opts *discovery.Options) {
+	sd.stopHeartbeats(opts)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	hb := &heartbeat{
+		info:   sd.serviceInfo(opts),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	sd.hmu.Lock()
+	sd.heartbeats = append(sd.heartbeats, hb)
+	sd.hmu.Unlock()
+
+	go sd.sendHeartbeats(ctx, opts, hb.done)
+}
+
+// stopHeartbeats stops heartbeats of service instances selected by options in the same way as instances which are deregistered
+// (all heartbeats if opts is nil) and waits until they are stopped, so service is not registered again after it is deregistered.
+func (sd *ServiceDiscovery) stopHeartbeats(opts *discovery.Options) {
+	var si ServiceInfo
+	if opts != nil {
+		si = sd.serviceInfo(opts)
+	}
+
+	sd.hmu.Lock()
+
+	var stopped, running []*heartbeat
+	for _, hb := range sd.heartbeats {
+		if opts == nil || (hb.info.Name == si.Name && si.matches(hb.info)) {
+			stopped = append(stopped, hb)
+		} else {
+			running = append(running, hb)
+		}
+	}
+	sd.heartbeats = running
+
+	sd.hmu.Unlock()
+
+	for _, hb := range stopped {
+		hb.cancel()
+		<-hb.done
+	}
+}
+
+// sendHeartbeats sends heartbeats of registered service until context is done. If server does not know the service
+// (e.g. registration was evicted), service is registered again.
+func (sd *ServiceDiscovery) sendHeartbeats(ctx context.Context, opts *discovery.Options, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(sd.opts.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		_, code, err := sd.sendRequest(HeartbeatURL, opts)
+		if err != nil {
+			logger.Log().WarningWithFields(logger.Fields{
+				"error":     err,
+				"info":      opts.Info,
+				"component": componentName,
+			}, "Cannot send heartbeat")
+			continue
+		}
+
+		if code == http.StatusNotFound && ctx.Err() == nil {
+			logger.Log().WarningWithFields(logger.Fields{
+				"info":      opts.Info,
+				"component": componentName,
+			}, "Service is not registered - registering service again")
+
+			if _, _, err := sd.sendRequest(RegisterServiceURL, opts); err != nil {
+				logger.Log().ErrorWithFields(logger.Fields{
+					"error":     err,
+					"info":      opts.Info,
+					"component": componentName,
+				}, "Cannot register service")
+			}
+		}
+	}
+}
+
+func (sd *ServiceDiscovery) heartbeatHandler(w http.ResponseWriter, r *http.Request) {
+	si, err := sd.decodeServiceInfo(*r)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	sd.mu.Lock()
+	info, found := sd.renew(*si)
+	if found {
+		// heartbeats are replicated, so registration does not expire on peers
+		sd.replicate(change{Op: opPut, Info: &info})
+	}
+	sd.mu.Unlock()
+
+	if !found {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// expires returns time when registration of service expires if heartbeat is not received.
+func (sd *ServiceDiscovery) expires(si ServiceInfo) time.Time {
+	ttl := si.TTL
+	if ttl <= 0 {
+		ttl = sd.opts.TTL
+	}
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(ttl)
+}
+
+// renew extends registration of service instance (see ServiceInfo.isInstance) and returns registered instance.
+// It returns false if instance is not registered. It must be called with mu locked.
+func (sd *ServiceDiscovery) renew(si ServiceInfo) (ServiceInfo, bool) {
+	reg := sd.findInstance(si)
+	if reg == nil {
+		return ServiceInfo{}, false
+	}
+
+	reg.expires = sd.expires(si)
+	return reg.info, true
+}
+
+// evict removes expired registrations from catalog and store. Evictions are not replicated, peers evict registrations
+// on their own. It must be called with mu locked.
+func (sd *ServiceDiscovery) evict(now time.Time) {
+	evicted := false
+
+	for name, infos := range sd.catalog {
+		for e := infos.Front(); e != nil; {
+			next := e.Next()
+			reg := e.Value.(*registration)
+
+			if !reg.expires.IsZero() && now.After(reg.expires) {
+				infos.Remove(e)
+				evicted = true
+
+				// evicted registration is removed from catalog even if it cannot be removed from store
+				sd.persist(change{Op: opDelete, Info: &reg.info, ID: reg.info.ID})
+
+				logger.Log().WarningWithFields(logger.Fields{
+					"name":      reg.info.Name,
+					"version":   reg.info.Version,
+					"address":   reg.info.Address,
+					"expired":   reg.expires,
+					"component": componentName,
+				}, "Service evicted - heartbeat was not received within TTL")
+			}
+			e = next
+		}
+
+		if infos.Len() == 0 {
+			delete(sd.catalog, name)
+		}
+	}
+
+	if evicted {
+		sd.changed()
+	}
+}
+
+// evictExpired evicts expired registrations periodically until context is done, so watchers are notified about evictions.
+func (sd *ServiceDiscovery) evictExpired(ctx context.Context) {
+	interval := sd.opts.TTL / 2
+	if interval <= 0 {
+		interval = defaultTTL / 2
+	}
+	if interval < minEvictionInterval {
+		interval = minEvictionInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			sd.mu.Lock()
+			sd.evict(now)
+			sd.mu.Unlock()
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package plain
+
+import (
+	"time"
+)
+
+const (
+	defaultHeartbeatInterval = 10 * time.Second
+	defaultTTL               = 30 * time.Second
+)
+
+// Option represents function which is used to apply plain service discovery options.
+type Option func(*Options)
+
+// Options represents plain service discovery options.
+type Options struct {
+	HeartbeatInterval time.Duration // interval of heartbeats sent by registered services, heartbeats are not sent if zero
+	TTL               time.Duration // time after which registration expires if heartbeat is not received, see TTL option
+	Storage           Store         // store of catalog, catalog is kept only in memory if nil
+	Peers             []string      // addresses of peer discovery servers which catalog changes are replicated to
+	Servers           []string      // addresses of discovery servers which client fails over to if discovery server is not available
+}
+
+// HeartbeatInterval allows to set interval of heartbeats sent by services registered by client. Default interval is 10 seconds.
+func HeartbeatInterval(d time.Duration) Option {
+	return func(o *Options) {
+		o.HeartbeatInterval = d
+	}
+}
+
+// TTL allows to set time after which registration expires if heartbeat is not received. Client registers services with its TTL
+// (30 seconds if TTL is not set and client sends heartbeats), server uses its TTL for registrations without TTL. Server TTL is
+// not set by default, so registrations of clients which do not send heartbeats do not expire.
+func TTL(d time.Duration) Option {
+	return func(o *Options) {
+		o.TTL = d
+	}
+}
+
+// Storage allows to set store of catalog, so registrations survive restart of discovery server (see NewFileStore).
+// Catalog is loaded from store when server is started.
+func Storage(s Store) Option {
+	return func(o *Options) {
+		o.Storage = s
+	}
+}
+
+// Peers allows to set addresses of peer discovery servers (e.g. "http://10.0.0.2:7777"). Server replicates registrations,
+// deregistrations and heartbeats to peers (changes are retried until peer is available) and merges catalog of the first
+// available peer with registered services into its catalog when it is started.
+func Peers(addrs ...string) Option {
+	return func(o *Options) {
+		o.Peers = append(o.Peers, addrs...)
+	}
+}
+
+// Servers allows to set addresses of additional discovery servers. Client sends requests to the next server
+// if discovery server is not available.
+func Servers(addrs ...string) Option {
+	return func(o *Options) {
+		o.Servers = append(o.Servers, addrs...)
+	}
+}
@@ -3,6 +3,7 @@ package plain
 import (
 	"bytes"
 	"container/list"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,14 +11,17 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"reflect"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gkarlik/quark-go/logger"
-	"github.com/gkarlik/quark-go/service"
 	"github.com/gkarlik/quark-go/service/discovery"
+	uuid "github.com/satori/go.uuid"
 )
 
 const (
@@ -27,16 +31,68 @@ const (
 	UnregisterServiceURL = "/unregister"
 	// ListServicesURL is endpoint url for registered services list.
 	ListServicesURL = "/services"
+	// WatchServicesURL is endpoint url for watching registered services list (long-polling).
+	// Request returns when catalog index is different than index passed in query string or wait time elapses.
+	WatchServicesURL = "/watch"
+	// IndexHeader is HTTP header which contains catalog index of returned services list.
+	IndexHeader = "X-Discovery-Index"
+	// HeartbeatURL is endpoint url for heartbeats of registered services. It returns 404 if service is not registered.
+	HeartbeatURL = "/heartbeat"
 
 	componentName = "PlainDiscoveryService"
+
+	defaultWatchWait = 30 * time.Second
+	maxWatchWait     = 5 * time.Minute
 )
 
 // ServiceInfo represents information about service to be registered in service discovery catalog.
 type ServiceInfo struct {
-	Address string   `json:"address"` // service address
-	Name    string   `json:"name"`    // service name
-	Tags    []string `json:"tags"`    // service tags
-	Version string   `json:"version"` // service version
+	ID       string            `json:"id,omitempty"`       // service instance identifier, generated by server if not set
+	Address  string            `json:"address"`            // service address
+	Name     string            `json:"name"`               // service name
+	Tags     []string          `json:"tags"`               // service tags
+	Version  string            `json:"version"`            // service version
+	Metadata map[string]string `json:"metadata,omitempty"` // service instance metadata
+	TTL      time.Duration     `json:"ttl,omitempty"`      // time after which registration expires without heartbeat, server TTL is used if zero
+}
+
+// registration represents service registered in catalog.
+type registration struct {
+	info    ServiceInfo // registered service
+	expires time.Time   // time when registration expires, zero if registration does not expire
+}
+
+// instance converts service info into service instance.
+// Catalog lists only registered instances, so they are considered healthy.
+func (si ServiceInfo) instance() discovery.Instance {
+	addr, _ := url.Parse(si.Address)
+
+	return discovery.Instance{
+		ID:       si.ID,
+		Address:  addr,
+		Version:  si.Version,
+		Tags:     si.Tags,
+		Metadata: si.Metadata,
+		Health:   discovery.HealthPassing,
+	}
+}
+
+// isInstance returns true if service info describes registered service instance - instance with the same identifier or,
+// if identifier is not set, instance with the same version, tags and address.
+func (si ServiceInfo) isInstance(val ServiceInfo) bool {
+	if si.ID != "" {
+		return si.ID == val.ID
+	}
+	return si.Version == val.Version && si.Address == val.Address && si.hasSameTags(val.Tags)
+}
+
+// matches returns true if service info selects registered service instance for deregistration - instance with the same
+// identifier or, if identifier is not set, instance with the same version, tags and address (any address if not set).
+func (si ServiceInfo) matches(val ServiceInfo) bool {
+	if si.ID != "" {
+		return si.ID == val.ID
+	}
+	return si.Version == val.Version && (si.Address == "" || si.Address == val.Address) && si.hasSameTags(val.Tags)
 }
 
 func (si ServiceInfo) includeTags(tags []string) bool {
@@ -75,41 +131,138 @@ func (si ServiceInfo) hasSameTags(tags []string) bool {
 	return true
 }
 
-// ServiceDiscovery represents plain, in-memory, client-server service discovery mechanism.
+// ServiceDiscovery represents plain, client-server service discovery mechanism. Catalog is kept in memory and optionally
+// recorded in store and replicated to peer discovery servers.
 type ServiceDiscovery struct {
+	opts    Options
 	mu      *sync.Mutex
 	client  *http.Client
-	address string
+	watcher *http.Client // client used for long-polling requests
+	servers []string     // addresses of discovery servers, the first one is primary
+	current int32        // index of discovery server which handled the last request
 	catalog map[string]*list.List
+	index   uint64        // catalog index, incremented on each catalog change
+	changes chan struct{} // closed and replaced on each catalog change
 	ln      net.Listener
-}
+	server  *http.Server
+	stop    context.CancelFunc // stops eviction of expired registrations
 
-// NewServiceDiscovery creates plain, in-memory, client-server service registration and localization mechanism.
-func NewServiceDiscovery(address string) *ServiceDiscovery {
-	addr := strings.TrimSuffix(address, "/")
+	hmu        sync.Mutex
+	heartbeats []*heartbeat // heartbeats of services registered by this client
 
-	return &ServiceDiscovery{
+	peers []*peer // peer discovery servers which catalog changes are replicated to
+}
+
+// NewServiceDiscovery creates plain, client-server service registration and localization mechanism.
+// Registered services send heartbeats and server evicts services which stop sending them (see HeartbeatInterval and TTL).
+// Registrations without TTL (e.g. of clients which do not send heartbeats) do not expire unless server TTL is set.
+// Client sends requests to discovery server with address or to next servers (see Servers) if it is not available.
+func NewServiceDiscovery(address string, opts ...Option) *ServiceDiscovery {
+	sd := &ServiceDiscovery{
+		opts: Options{
+			HeartbeatInterval: defaultHeartbeatInterval,
+		},
 		mu: &sync.Mutex{},
 		client: &http.Client{
 			Timeout: 10 * time.Second,
 		},
+		watcher: &http.Client{
+			Timeout: defaultWatchWait + 10*time.Second,
+		},
 		catalog: make(map[string]*list.List),
-		address: addr,
+		index:   1,
+		changes: make(chan struct{}),
 		ln:      nil,
 	}
+
+	for _, opt := range opts {
+		opt(&sd.opts)
+	}
+
+	for _, addr := range append([]string{address}, sd.opts.Servers...) {
+		sd.servers = append(sd.servers, strings.TrimSuffix(addr, "/"))
+	}
+
+	return sd
+}
+
+func (sd *ServiceDiscovery) sendRequest(path string, opts *discovery.Options) ([]byte, int, error) {
+	body, resp, _, err := sd.request(context.Background(), sd.client, path, opts)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	return body, resp.StatusCode, nil
+}
+
+// request sends request to discovery server which handled the last request. If server is not available, request is sent
+// to next servers. It returns response body, response and address of server which handled the request.
+func (sd *ServiceDiscovery) request(ctx context.Context, client *http.Client, path string, opts *discovery.Options) ([]byte, *http.Response, string, error) {
+	var lastErr error
+
+	start := int(atomic.LoadInt32(&sd.current))
+	for i := range sd.servers {
+		n := (start + i) % len(sd.servers)
+
+		req, err := sd.newRequest(sd.servers[n]+path, http.MethodPost, opts)
+		if err != nil {
+			return nil, nil, "", err
+		}
+
+		body, resp, err := sd.do(client, req.WithContext(ctx))
+		if err == nil {
+			atomic.StoreInt32(&sd.current, int32(n))
+			return body, resp, sd.servers[n], nil
+		}
+		if ctx.Err() != nil {
+			return nil, nil, "", err
+		}
+		lastErr = err
+
+		if len(sd.servers) > 1 {
+			logger.Log().WarningWithFields(logger.Fields{
+				"error":     err,
+				"server":    sd.servers[n],
+				"component": componentName,
+			}, "Discovery server is not available - sending request to next server")
+		}
+	}
+
+	return nil, nil, "", lastErr
+}
+
+// serviceInfo returns information about service described by options.
+func (sd *ServiceDiscovery) serviceInfo(opts *discovery.Options) ServiceInfo {
+	si := ServiceInfo{
+		ID:       opts.ID,
+		Address:  "",
+		Name:     opts.Info.Name,
+		Tags:     opts.Info.Tags,
+		Version:  opts.Info.Version,
+		Metadata: opts.Metadata,
+		TTL:      sd.ttl(),
+	}
+
+	if opts.Info.Address != nil {
+		si.Address = opts.Info.Address.String()
+	}
+	return si
 }
 
-func (sd *ServiceDiscovery) sendRequest(address string, method string, info service.Info) ([]byte, int, error) {
-	si := &ServiceInfo{
-		Address: "",
-		Name:    info.Name,
-		Tags:    info.Tags,
-		Version: info.Version,
+// ttl returns TTL of services registered by client. If TTL is not set, services of client which sends heartbeats expire
+// after default TTL (or three heartbeat intervals if it is longer).
+func (sd *ServiceDiscovery) ttl() time.Duration {
+	if sd.opts.TTL > 0 || sd.opts.HeartbeatInterval <= 0 {
+		return sd.opts.TTL
 	}
 
-	if info.Address != nil {
-		si.Address = info.Address.String()
+	if ttl := 3 * sd.opts.HeartbeatInterval; ttl > defaultTTL {
+		return ttl
 	}
+	return defaultTTL
+}
+
+func (sd *ServiceDiscovery) newRequest(address string, method string, opts *discovery.Options) (*http.Request, error) {
+	si := sd.serviceInfo(opts)
 
 	data, err := json.Marshal(si)
 	if err != nil {
@@ -118,7 +271,7 @@ func (sd *ServiceDiscovery) sendRequest(address string, method string, info serv
 			"info":      si,
 			"component": componentName,
 		}, "Cannot convert service info to JSON")
-		return nil, http.StatusInternalServerError, err
+		return nil, err
 	}
 
 	req, err := http.NewRequest(method, address, bytes.NewBuffer(data))
@@ -130,18 +283,22 @@ func (sd *ServiceDiscovery) sendRequest(address string, method string, info serv
 			"data":      data,
 			"component": componentName,
 		}, "Cannot prepare HTTP request")
-		return nil, http.StatusInternalServerError, err
+		return nil, err
 	}
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := sd.client.Do(req)
+	return req, nil
+}
+
+func (sd *ServiceDiscovery) do(client *http.Client, req *http.Request) ([]byte, *http.Response, error) {
+	resp, err := client.Do(req)
 	if err != nil {
 		logger.Log().ErrorWithFields(logger.Fields{
 			"error":     err,
 			"request":   req,
 			"component": componentName,
 		}, "Cannot process HTTP request")
-		return nil, http.StatusInternalServerError, err
+		return nil, nil, err
 	}
 	defer resp.Body.Close()
 
@@ -152,20 +309,20 @@ func (sd *ServiceDiscovery) sendRequest(address string, method string, info serv
 			"response":  resp,
 			"component": componentName,
 		}, "Cannot read HTTP response body")
-		return nil, http.StatusInternalServerError, err
+		return nil, nil, err
 	}
-	return body, resp.StatusCode, nil
+	return body, resp, nil
 }
 
-// RegisterService registers service in service discovery catalog.
+// RegisterService registers service in service discovery catalog and starts sending heartbeats of the service in background.
+// Heartbeats are sent until service is deregistered or ServiceDiscovery is disposed.
 func (sd *ServiceDiscovery) RegisterService(options ...discovery.Option) error {
 	opts := new(discovery.Options)
 	for _, o := range options {
 		o(opts)
 	}
 
-	addr := fmt.Sprintf("%s%s", sd.address, RegisterServiceURL)
-	_, _, err := sd.sendRequest(addr, http.MethodPost, opts.Info)
+	data, _, err := sd.sendRequest(RegisterServiceURL, opts)
 	if err != nil {
 		logger.Log().ErrorWithFields(logger.Fields{
 			"error":     err,
@@ -174,18 +331,36 @@ func (sd *ServiceDiscovery) RegisterService(options ...discovery.Option) error {
 		}, "Cannot register service")
 		return err
 	}
+
+	// server returns registered instance, so the same instance is renewed by heartbeats
+	var registered ServiceInfo
+	if err := json.Unmarshal(data, &registered); err == nil && registered.ID != "" {
+		opts.ID = registered.ID
+
+		logger.Log().InfoWithFields(logger.Fields{
+			"ID":        registered.ID,
+			"info":      opts.Info,
+			"component": componentName,
+		}, "Service registered")
+	}
+
+	if sd.opts.HeartbeatInterval > 0 {
+		sd.startHeartbeat(opts)
+	}
 	return nil
 }
 
-// DeregisterService unregisters service in service discovery catalog.
+// DeregisterService unregisters service instance (identified by ID or selected by version, tags and address) in service
+// discovery catalog and stops sending its heartbeats. If address is not set, all matching instances are unregistered.
 func (sd *ServiceDiscovery) DeregisterService(options ...discovery.Option) error {
 	opts := new(discovery.Options)
 	for _, o := range options {
 		o(opts)
 	}
 
-	addr := fmt.Sprintf("%s%s", sd.address, UnregisterServiceURL)
-	_, _, err := sd.sendRequest(addr, http.MethodPost, opts.Info)
+	sd.stopHeartbeats(opts)
+
+	_, _, err := sd.sendRequest(UnregisterServiceURL, opts)
 	if err != nil {
 		logger.Log().ErrorWithFields(logger.Fields{
 			"error":     err,
@@ -197,15 +372,35 @@ func (sd *ServiceDiscovery) DeregisterService(options ...discovery.Option) error
 	return nil
 }
 
-// GetServiceAddress gets service address from service discovery catalog.
+// GetServiceAddress gets address of service instance from service discovery catalog using load balancing strategy.
 func (sd *ServiceDiscovery) GetServiceAddress(options ...discovery.Option) (*url.URL, error) {
 	opts := new(discovery.Options)
 	for _, o := range options {
 		o(opts)
 	}
 
-	addr := fmt.Sprintf("%s%s", sd.address, ListServicesURL)
-	data, _, err := sd.sendRequest(addr, http.MethodPost, opts.Info)
+	instances, err := sd.GetServiceInstances(options...)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Strategy == nil {
+		logger.Log().DebugWithFields(logger.Fields{"component": componentName}, "Load balancing strategy is not set. Picking first item from the list.")
+	} else {
+		logger.Log().InfoWithFields(logger.Fields{"component": componentName}, "Picking service using load balancing strategy")
+	}
+
+	return discovery.PickServiceAddress(instances, opts.Strategy)
+}
+
+// GetServiceInstances gets all instances of service from service discovery catalog.
+func (sd *ServiceDiscovery) GetServiceInstances(options ...discovery.Option) ([]discovery.Instance, error) {
+	opts := new(discovery.Options)
+	for _, o := range options {
+		o(opts)
+	}
+
+	data, _, err := sd.sendRequest(ListServicesURL, opts)
 	if err != nil {
 		logger.Log().ErrorWithFields(logger.Fields{
 			"error":     err,
@@ -215,8 +410,55 @@ func (sd *ServiceDiscovery) GetServiceAddress(options ...discovery.Option) (*url
 		return nil, err
 	}
 
+	return decodeInstances(data)
+}
+
+// Watch watches instances of service using long-polling requests and returns channel of instance sets. The current instance set
+// is sent first, next sets are sent when instances change. Channel is closed when context is done.
+func (sd *ServiceDiscovery) Watch(ctx context.Context, options ...discovery.Option) (<-chan []discovery.Instance, error) {
+	opts := new(discovery.Options)
+	for _, o := range options {
+		o(opts)
+	}
+
+	if opts.Info.Name == "" {
+		logger.Log().ErrorWithFields(logger.Fields{"component": componentName}, "Cannot watch service - service name cannot be empty")
+
+		return nil, fmt.Errorf("[%s]: Cannot watch service - service name cannot be empty", componentName)
+	}
+
+	var server string // discovery server which handled the last request
+
+	return discovery.WatchQuery(ctx, componentName, func(ctx context.Context, index uint64) ([]discovery.Instance, uint64, error) {
+		path := fmt.Sprintf("%s?index=%d&wait=%s", WatchServicesURL, index, defaultWatchWait)
+
+		data, resp, handledBy, err := sd.request(ctx, sd.watcher, path, opts)
+		if err != nil {
+			return nil, 0, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, 0, fmt.Errorf("[%s]: Cannot watch service - %s", componentName, resp.Status)
+		}
+
+		instances, err := decodeInstances(data)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		next, _ := strconv.ParseUint(resp.Header.Get(IndexHeader), 10, 64)
+
+		// catalog indexes of different servers are not related, so index is reset when request is handled by other server
+		if handledBy != server {
+			server, next = handledBy, 0
+		}
+
+		return instances, next, nil
+	}), nil
+}
+
+func decodeInstances(data []byte) ([]discovery.Instance, error) {
 	var infos []ServiceInfo
-	err = json.Unmarshal(data, &infos)
+	err := json.Unmarshal(data, &infos)
 	if err != nil {
 		logger.Log().ErrorWithFields(logger.Fields{
 			"error":     err,
@@ -225,43 +467,43 @@ func (sd *ServiceDiscovery) GetServiceAddress(options ...discovery.Option) (*url
 		return nil, errors.New(http.StatusText(http.StatusInternalServerError))
 	}
 
-	var urls []*url.URL
+	instances := make([]discovery.Instance, 0, len(infos))
 	for _, info := range infos {
-		url, _ := url.Parse(info.Address)
-		urls = append(urls, url)
-	}
-
-	if len(urls) == 0 {
-		return nil, nil
-	}
-
-	if opts.Strategy == nil {
-		logger.Log().DebugWithFields(logger.Fields{"component": componentName}, "Load balancing strategy is not set. Picking first item from the list.")
-
-		return urls[0], nil
+		instances = append(instances, info.instance())
 	}
-	logger.Log().InfoWithFields(logger.Fields{"component": componentName}, "Picking service using load balancing strategy")
 
-	return opts.Strategy.PickServiceAddress(urls)
+	return instances, nil
 }
 
 // Dispose cleans up ServiceDiscovery instance.
 func (sd *ServiceDiscovery) Dispose() {
 	logger.Log().InfoWithFields(logger.Fields{"component": componentName}, "Disposing service discovery component")
 
-	if sd.client != nil {
-		sd.client = nil
-	}
+	sd.stopHeartbeats(nil)
+
 	sd.Stop()
+
+	if sd.opts.Storage != nil {
+		sd.opts.Storage.Dispose()
+	}
 }
 
-// Serve starts service discovery HTTP host.
+// Serve starts service discovery HTTP host. Registrations which are not renewed by heartbeats within TTL are evicted.
+// Catalog is loaded from store (see Storage) and changes of catalog are replicated to peer discovery servers (see Peers).
 func (sd *ServiceDiscovery) Serve(address string) error {
 	mux := http.NewServeMux()
 
 	mux.HandleFunc(RegisterServiceURL, sd.registerHandler)
 	mux.HandleFunc(UnregisterServiceURL, sd.unregisterHandler)
 	mux.HandleFunc(ListServicesURL, sd.listServicesHandler)
+	mux.HandleFunc(WatchServicesURL, sd.watchServicesHandler)
+	mux.HandleFunc(HeartbeatURL, sd.heartbeatHandler)
+	mux.HandleFunc(ReplicateURL, sd.replicateHandler)
+	mux.HandleFunc(CatalogURL, sd.catalogHandler)
+
+	if err := sd.load(); err != nil {
+		return err
+	}
 
 	ln, err := net.Listen("tcp", address)
 	if err != nil {
@@ -273,18 +515,32 @@ func (sd *ServiceDiscovery) Serve(address string) error {
 		return err
 	}
 	sd.ln = ln
+	sd.server = &http.Server{Handler: mux}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sd.stop = cancel
+
+	go sd.evictExpired(ctx)
+
+	sd.startReplication(ctx)
+	go sd.syncPeers(ctx)
 
 	go func() {
-		http.Serve(sd.ln, mux)
+		sd.server.Serve(sd.ln)
 	}()
 	return nil
 }
 
 // Stop stops service discovery HTTP host.
 func (sd *ServiceDiscovery) Stop() {
+	if sd.stop != nil {
+		sd.stop()
+	}
+
 	go func() {
-		if sd.ln != nil {
-			sd.ln.Close()
+		// open connections are closed too, so clients fail over to other discovery servers
+		if sd.server != nil {
+			sd.server.Close()
 		}
 	}()
 }
@@ -313,7 +569,7 @@ func (sd *ServiceDiscovery) findByServiceInfo(si ServiceInfo) []ServiceInfo {
 	infos, ok := sd.catalog[si.Name]
 	if ok {
 		for e := infos.Front(); e != nil; e = e.Next() {
-			val := e.Value.(ServiceInfo)
+			val := e.Value.(*registration).info
 
 			if si.Version == val.Version && si.includeTags(val.Tags) {
 				result = append(result, val)
@@ -323,40 +579,159 @@ func (sd *ServiceDiscovery) findByServiceInfo(si ServiceInfo) []ServiceInfo {
 	return result
 }
 
-func (sd *ServiceDiscovery) findExactByServiceInfo(si ServiceInfo) []ServiceInfo {
-	// must use make here to return [] instead of null
-	result := make([]ServiceInfo, 0)
-
+// findInstance returns registration of service instance (see ServiceInfo.isInstance) or nil if instance is not registered.
+// It must be called with mu locked.
+func (sd *ServiceDiscovery) findInstance(si ServiceInfo) *registration {
 	infos, ok := sd.catalog[si.Name]
 	if ok {
 		for e := infos.Front(); e != nil; e = e.Next() {
-			val := e.Value.(ServiceInfo)
+			reg := e.Value.(*registration)
 
-			if si.Version == val.Version && si.hasSameTags(val.Tags) {
-				result = append(result, val)
+			if si.isInstance(reg.info) {
+				return reg
 			}
 		}
 	}
-	return result
+	return nil
 }
 
-func (sd *ServiceDiscovery) deleteByServiceInfo(si ServiceInfo) {
+// register adds service instance to catalog or updates registered instance (see ServiceInfo.isInstance) and renews
+// its registration. New and updated registrations are recorded in store. It returns registered instance.
+// It must be called with mu locked.
+func (sd *ServiceDiscovery) register(si ServiceInfo) (ServiceInfo, error) {
+	reg := sd.findInstance(si)
+	if reg == nil {
+		// new replica of the service is added to the catalog
+		if si.ID == "" {
+			si.ID = uuid.NewV4().String()
+		}
+		if err := sd.persist(change{Op: opPut, Info: &si}); err != nil {
+			return ServiceInfo{}, err
+		}
+		reg = &registration{info: si}
+		sd.add(reg)
+	} else {
+		// registered instance is updated
+		si.ID = reg.info.ID
+		if !reflect.DeepEqual(reg.info, si) {
+			if err := sd.persist(change{Op: opPut, Info: &si}); err != nil {
+				return ServiceInfo{}, err
+			}
+			reg.info = si
+			sd.changed()
+		}
+	}
+	reg.expires = sd.expires(si)
+
+	return reg.info, nil
+}
+
+// add adds registration to catalog. It must be called with mu locked.
+func (sd *ServiceDiscovery) add(reg *registration) {
+	infos, ok := sd.catalog[reg.info.Name]
+	if !ok {
+		infos = list.New()
+		sd.catalog[reg.info.Name] = infos
+	}
+	infos.PushBack(reg)
+	sd.changed()
+}
+
+// deleteByServiceInfo removes service instances selected by service info (see ServiceInfo.matches) from catalog and store.
+// Removed instances are replicated to peers if replicate is true.
+func (sd *ServiceDiscovery) deleteByServiceInfo(si ServiceInfo, replicate bool) error {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+
 	infos, ok := sd.catalog[si.Name]
 	if ok {
 		var toDelete []*list.Element
 		for e := infos.Front(); e != nil; e = e.Next() {
-			val := e.Value.(ServiceInfo)
+			val := e.Value.(*registration).info
 
-			if si.Version == val.Version && si.hasSameTags(val.Tags) {
+			if si.matches(val) {
 				toDelete = append(toDelete, e)
 			}
 		}
-		sd.mu.Lock()
 		for _, d := range toDelete {
+			info := d.Value.(*registration).info
+
+			c := change{Op: opDelete, Info: &info, ID: info.ID}
+			if err := sd.persist(c); err != nil {
+				return err
+			}
+			if replicate {
+				sd.replicate(c)
+			}
 			infos.Remove(d)
+			sd.changed()
 		}
-		sd.mu.Unlock()
+		if infos.Len() == 0 {
+			delete(sd.catalog, si.Name)
+		}
+	}
+	return nil
+}
+
+// persist records change of catalog in store. It must be called with mu locked, so changes are recorded in order.
+func (sd *ServiceDiscovery) persist(c change) error {
+	if sd.opts.Storage == nil {
+		return nil
+	}
+
+	var err error
+	switch c.Op {
+	case opPut:
+		err = sd.opts.Storage.Put(*c.Info)
+	case opDelete:
+		err = sd.opts.Storage.Delete(c.ID)
+	}
+	if err != nil {
+		logger.Log().ErrorWithFields(logger.Fields{
+			"error":     err,
+			"op":        c.Op,
+			"info":      c.Info,
+			"component": componentName,
+		}, "Cannot record catalog change in store")
 	}
+	return err
+}
+
+// load adds services recorded in store to catalog. Their registrations expire if they are not renewed within TTL.
+// Loaded services are already recorded in store, so they are not recorded again.
+func (sd *ServiceDiscovery) load() error {
+	if sd.opts.Storage == nil {
+		return nil
+	}
+
+	infos, err := sd.opts.Storage.Load()
+	if err != nil {
+		logger.Log().ErrorWithFields(logger.Fields{
+			"error":     err,
+			"component": componentName,
+		}, "Cannot load catalog from store")
+		return err
+	}
+
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+
+	for _, si := range infos {
+		sd.add(&registration{info: si, expires: sd.expires(si)})
+	}
+
+	logger.Log().InfoWithFields(logger.Fields{
+		"services":  len(infos),
+		"component": componentName,
+	}, "Catalog loaded from store")
+	return nil
+}
+
+// changed increments catalog index and wakes up watchers. It must be called with mu locked.
+func (sd *ServiceDiscovery) changed() {
+	sd.index++
+	close(sd.changes)
+	sd.changes = make(chan struct{})
 }
 
 func (sd *ServiceDiscovery) registerHandler(w http.ResponseWriter, r *http.Request) {
@@ -365,15 +740,29 @@ func (sd *ServiceDiscovery) registerHandler(w http.ResponseWriter, r *http.Reque
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
-	infos := sd.findExactByServiceInfo(*si)
-	if len(infos) == 0 {
-		sd.mu.Lock()
-		srvs := list.New()
-		srvs.PushBack(*si)
-		sd.catalog[si.Name] = srvs
-		sd.mu.Unlock()
+	sd.mu.Lock()
+	info, err := sd.register(*si)
+	if err == nil {
+		sd.replicate(change{Op: opPut, Info: &info})
+	}
+	sd.mu.Unlock()
+
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	data, err := json.Marshal(info)
+	if err != nil {
+		logger.Log().ErrorWithFields(logger.Fields{
+			"error":     err,
+			"component": componentName,
+		}, "Cannot convert service info into JSON")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
 	}
 	w.WriteHeader(http.StatusOK)
+	w.Write(data)
 }
 
 func (sd *ServiceDiscovery) unregisterHandler(w http.ResponseWriter, r *http.Request) {
@@ -382,7 +771,10 @@ func (sd *ServiceDiscovery) unregisterHandler(w http.ResponseWriter, r *http.Req
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
-	sd.deleteByServiceInfo(*si)
+	if err := sd.deleteByServiceInfo(*si, true); err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
 
 	w.WriteHeader(http.StatusOK)
 }
@@ -394,7 +786,65 @@ func (sd *ServiceDiscovery) listServicesHandler(w http.ResponseWriter, r *http.R
 		return
 
 	}
+	sd.mu.Lock()
+	sd.evict(time.Now())
 	infos := sd.findByServiceInfo(*si)
+	sd.mu.Unlock()
+
+	data, err := json.Marshal(infos)
+	if err != nil {
+		logger.Log().ErrorWithFields(logger.Fields{
+			"error":     err,
+			"component": componentName,
+		}, "Cannot convert service info array into JSON")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+func (sd *ServiceDiscovery) watchServicesHandler(w http.ResponseWriter, r *http.Request) {
+	si, err := sd.decodeServiceInfo(*r)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	index, _ := strconv.ParseUint(r.URL.Query().Get("index"), 10, 64)
+
+	wait, err := time.ParseDuration(r.URL.Query().Get("wait"))
+	if err != nil || wait <= 0 {
+		wait = defaultWatchWait
+	}
+	if wait > maxWatchWait {
+		wait = maxWatchWait
+	}
+
+	sd.mu.Lock()
+	sd.evict(time.Now())
+	if index == sd.index {
+		// catalog has not changed since last request - wait for change
+		changes := sd.changes
+		sd.mu.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-changes:
+		case <-timer.C:
+		case <-r.Context().Done():
+			timer.Stop()
+			return
+		}
+		timer.Stop()
+
+		sd.mu.Lock()
+		sd.evict(time.Now())
+	}
+	infos := sd.findByServiceInfo(*si)
+	index = sd.index
+	sd.mu.Unlock()
+
 	data, err := json.Marshal(infos)
 	if err != nil {
 		logger.Log().ErrorWithFields(logger.Fields{
@@ -404,6 +854,7 @@ func (sd *ServiceDiscovery) listServicesHandler(w http.ResponseWriter, r *http.R
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
+	w.Header().Set(IndexHeader, strconv.FormatUint(index, 10))
 	w.WriteHeader(http.StatusOK)
 	w.Write(data)
 }
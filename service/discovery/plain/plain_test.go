@@ -2,11 +2,19 @@ package plain_test
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
 	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
 	"testing"
 	"time"
 
 	"github.com/gkarlik/quark-go"
+	"github.com/gkarlik/quark-go/service"
 	sd "github.com/gkarlik/quark-go/service/discovery"
 	"github.com/gkarlik/quark-go/service/discovery/plain"
 	"github.com/gkarlik/quark-go/service/loadbalancer/random"
@@ -102,9 +110,191 @@ func TestPlainDiscoveryServiceTags(t *testing.T) {
 	err = ts.Discovery().RegisterService(sd.ByName("TestService"), sd.ByVersion("1.0"))
 	assert.NoError(t, err, "Unexpected error during service registration")
 
-	url, err = ts.Discovery().GetServiceAddress(sd.ByName("TestService"), sd.ByVersion("1.0"))
+	// service without tags and address is registered as another replica
+	instances, err := ts.Discovery().GetServiceInstances(sd.ByName("TestService"), sd.ByVersion("1.0"))
 	assert.NoError(t, err, "Unexpected error while getting services list")
-	assert.Equal(t, "", url.String())
+	assert.Len(t, instances, 2)
+	assert.Equal(t, "", instances[1].Address.String())
+}
+
+func TestPlainDiscoveryServiceInstances(t *testing.T) {
+	ts := getTestService()
+
+	err := ts.Discovery().RegisterService(sd.ByInfo(ts.Info()), sd.WithMetadata("zone", "eu"))
+	assert.NoError(t, err, "Unexpected error during service registration")
+
+	instances, err := ts.Discovery().GetServiceInstances(sd.ByName("TestService"), sd.ByTag("A"), sd.ByVersion("1.0"))
+	assert.NoError(t, err, "Unexpected error while getting services list")
+	assert.Len(t, instances, 1)
+
+	i := instances[0]
+	assert.NotEmpty(t, i.ID)
+	assert.Equal(t, ts.Options().Info.Address.String(), i.Address.String())
+	assert.Equal(t, "1.0", i.Version)
+	assert.Equal(t, []string{"A", "B"}, i.Tags)
+	assert.Equal(t, "eu", i.Metadata["zone"])
+	assert.Equal(t, sd.HealthPassing, i.Health)
+
+	err = ts.Discovery().DeregisterService(sd.ByInfo(ts.Info()))
+	assert.NoError(t, err, "Unexpected error while service deregistration")
+
+	instances, err = ts.Discovery().GetServiceInstances(sd.ByName("TestService"), sd.ByTag("A"), sd.ByVersion("1.0"))
+	assert.NoError(t, err, "Unexpected error while getting services list")
+	assert.Empty(t, instances)
+}
+
+func TestPlainDiscoveryServiceReplicas(t *testing.T) {
+	getTestService()
+
+	sa1, _ := quark.GetHostAddress(6001)
+	sa2, _ := quark.GetHostAddress(6002)
+
+	for _, sa := range []*url.URL{sa1, sa2, sa1} {
+		err := discoveryService.RegisterService(sd.WithInfo(service.Info{Name: "ReplicatedService", Version: "1.0", Tags: []string{"A"}, Address: sa}))
+		assert.NoError(t, err, "Unexpected error during service registration")
+	}
+
+	// instance with the same address is registered once
+	instances, err := discoveryService.GetServiceInstances(sd.ByName("ReplicatedService"), sd.ByTag("A"), sd.ByVersion("1.0"))
+	assert.NoError(t, err, "Unexpected error while getting services list")
+	assert.Len(t, instances, 2)
+	assert.Equal(t, sa1.String(), instances[0].Address.String())
+	assert.Equal(t, sa2.String(), instances[1].Address.String())
+	assert.NotEqual(t, instances[0].ID, instances[1].ID)
+
+	picked := map[string]bool{}
+	for i := 0; i < 50; i++ {
+		a, err := discoveryService.GetServiceAddress(sd.ByName("ReplicatedService"), sd.ByVersion("1.0"), sd.UsingLBStrategy(random.NewRandomLBStrategy()))
+		assert.NoError(t, err, "Unexpected error while getting services list")
+		picked[a.String()] = true
+	}
+	assert.Len(t, picked, 2, "Both replicas should be picked")
+
+	err = discoveryService.DeregisterService(sd.ByName("ReplicatedService"), sd.ByID(instances[0].ID))
+	assert.NoError(t, err, "Unexpected error while service deregistration")
+
+	remaining, err := discoveryService.GetServiceInstances(sd.ByName("ReplicatedService"), sd.ByVersion("1.0"))
+	assert.NoError(t, err, "Unexpected error while getting services list")
+	assert.Len(t, remaining, 1)
+	assert.Equal(t, instances[1].ID, remaining[0].ID)
+
+	// instance can be registered with identifier
+	err = discoveryService.RegisterService(sd.WithInfo(service.Info{Name: "ReplicatedService", Version: "1.0", Address: sa1}), sd.ByID("replica-1"))
+	assert.NoError(t, err, "Unexpected error during service registration")
+
+	remaining, err = discoveryService.GetServiceInstances(sd.ByName("ReplicatedService"), sd.ByVersion("1.0"))
+	assert.NoError(t, err, "Unexpected error while getting services list")
+	assert.Len(t, remaining, 2)
+	assert.Equal(t, "replica-1", remaining[1].ID)
+
+	for _, i := range remaining {
+		err = discoveryService.DeregisterService(sd.ByName("ReplicatedService"), sd.ByID(i.ID))
+		assert.NoError(t, err, "Unexpected error while service deregistration")
+	}
+}
+
+func TestPlainDiscoveryServiceWatch(t *testing.T) {
+	getTestService()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	updates, err := discoveryService.Watch(ctx, sd.ByName("WatchedService"), sd.ByVersion("1.0"))
+	assert.NoError(t, err, "Unexpected error while watching service")
+
+	assert.Empty(t, <-updates)
+
+	sa, _ := quark.GetHostAddress(4321)
+	err = discoveryService.RegisterService(sd.WithInfo(service.Info{Name: "WatchedService", Version: "1.0", Address: sa}))
+	assert.NoError(t, err, "Unexpected error during service registration")
+
+	instances := <-updates
+	assert.Len(t, instances, 1)
+	assert.Equal(t, sa.String(), instances[0].Address.String())
+
+	// changes of other services are not sent
+	err = discoveryService.RegisterService(sd.ByName("OtherService"), sd.ByVersion("1.0"))
+	assert.NoError(t, err, "Unexpected error during service registration")
+
+	err = discoveryService.DeregisterService(sd.ByName("WatchedService"), sd.ByVersion("1.0"))
+	assert.NoError(t, err, "Unexpected error while service deregistration")
+
+	assert.Empty(t, <-updates)
+
+	cancel()
+	for range updates {
+	}
+
+	_, err = discoveryService.Watch(context.Background())
+	assert.Error(t, err, "Watch should return an error")
+}
+
+func TestPlainDiscoveryServiceHeartbeat(t *testing.T) {
+	addr, _ := quark.GetHostAddress(7778)
+
+	server := plain.NewServiceDiscovery("http://"+addr.Host, plain.TTL(100*time.Millisecond))
+	server.Serve(addr.Host)
+	defer server.Dispose()
+
+	alive := plain.NewServiceDiscovery("http://"+addr.Host, plain.HeartbeatInterval(20*time.Millisecond), plain.TTL(100*time.Millisecond))
+	defer alive.Dispose()
+
+	// service which does not send heartbeats simulates crashed service
+	crashed := plain.NewServiceDiscovery("http://"+addr.Host, plain.HeartbeatInterval(0), plain.TTL(100*time.Millisecond))
+	defer crashed.Dispose()
+
+	sa1, _ := quark.GetHostAddress(5001)
+	sa2, _ := quark.GetHostAddress(5002)
+
+	err := alive.RegisterService(sd.WithInfo(service.Info{Name: "AliveService", Version: "1.0", Address: sa1}))
+	assert.NoError(t, err, "Unexpected error during service registration")
+
+	err = crashed.RegisterService(sd.WithInfo(service.Info{Name: "CrashedService", Version: "1.0", Address: sa2}))
+	assert.NoError(t, err, "Unexpected error during service registration")
+
+	assert.Eventually(t, func() bool {
+		instances, err := server.GetServiceInstances(sd.ByName("CrashedService"), sd.ByVersion("1.0"))
+		return err == nil && len(instances) == 0
+	}, 2*time.Second, 10*time.Millisecond, "Crashed service should be evicted")
+
+	instances, err := server.GetServiceInstances(sd.ByName("AliveService"), sd.ByVersion("1.0"))
+	assert.NoError(t, err, "Unexpected error while getting services list")
+	assert.Len(t, instances, 1)
+
+	// service is not registered again by heartbeats after deregistration
+	err = alive.DeregisterService(sd.ByName("AliveService"), sd.ByVersion("1.0"))
+	assert.NoError(t, err, "Unexpected error while service deregistration")
+
+	time.Sleep(200 * time.Millisecond)
+
+	instances, err = server.GetServiceInstances(sd.ByName("AliveService"), sd.ByVersion("1.0"))
+	assert.NoError(t, err, "Unexpected error while getting services list")
+	assert.Empty(t, instances)
+}
+
+func TestPlainDiscoveryServiceReregistration(t *testing.T) {
+	addr, _ := quark.GetHostAddress(7779)
+
+	server := plain.NewServiceDiscovery("http://" + addr.Host)
+	server.Serve(addr.Host)
+	defer server.Dispose()
+
+	client := plain.NewServiceDiscovery("http://"+addr.Host, plain.HeartbeatInterval(20*time.Millisecond))
+	defer client.Dispose()
+
+	info := sd.WithInfo(service.Info{Name: "ReregisteredService", Version: "1.0"})
+
+	err := client.RegisterService(info)
+	assert.NoError(t, err, "Unexpected error during service registration")
+
+	// registration lost by server is restored by heartbeats
+	err = server.DeregisterService(info)
+	assert.NoError(t, err, "Unexpected error while service deregistration")
+
+	assert.Eventually(t, func() bool {
+		instances, err := server.GetServiceInstances(info)
+		return err == nil && len(instances) == 1
+	}, 2*time.Second, 10*time.Millisecond, "Service should be registered again")
 }
 
 func TestPlainDiscoveryServiceIncorrectAddress(t *testing.T) {
@@ -170,3 +360,331 @@ func TestPlainDiscoveryHandlers(t *testing.T) {
 	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
 	assert.NoError(t, err, "Unexpected error during HTTP call")
 }
+
+func TestPlainDiscoveryServiceFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "catalog")
+	assert.NoError(t, err, "Unexpected error while creating directory")
+	defer os.RemoveAll(dir)
+
+	addr, _ := quark.GetHostAddress(7780)
+
+	store, err := plain.NewFileStore(dir)
+	assert.NoError(t, err, "Unexpected error while opening catalog store")
+
+	server := plain.NewServiceDiscovery("http://"+addr.Host, plain.Storage(store), plain.HeartbeatInterval(0))
+	err = server.Serve(addr.Host)
+	assert.NoError(t, err, "Unexpected error while starting server")
+
+	sa1, _ := quark.GetHostAddress(5003)
+	sa2, _ := quark.GetHostAddress(5004)
+
+	for _, sa := range []*url.URL{sa1, sa2} {
+		err = server.RegisterService(sd.WithInfo(service.Info{Name: "StoredService", Version: "1.0", Address: sa}), sd.WithMetadata("zone", "eu"))
+		assert.NoError(t, err, "Unexpected error during service registration")
+	}
+
+	err = server.DeregisterService(sd.WithInfo(service.Info{Name: "StoredService", Version: "1.0", Address: sa1}))
+	assert.NoError(t, err, "Unexpected error while service deregistration")
+
+	registered, err := server.GetServiceInstances(sd.ByName("StoredService"), sd.ByVersion("1.0"))
+	assert.NoError(t, err, "Unexpected error while getting services list")
+	assert.Len(t, registered, 1)
+
+	server.Dispose()
+
+	// restarted server loads catalog from store
+	addr, _ = quark.GetHostAddress(7781)
+
+	store, err = plain.NewFileStore(dir)
+	assert.NoError(t, err, "Unexpected error while opening catalog store")
+
+	server = plain.NewServiceDiscovery("http://"+addr.Host, plain.Storage(store), plain.HeartbeatInterval(0))
+	err = server.Serve(addr.Host)
+	assert.NoError(t, err, "Unexpected error while starting server")
+	defer server.Dispose()
+
+	instances, err := server.GetServiceInstances(sd.ByName("StoredService"), sd.ByVersion("1.0"))
+	assert.NoError(t, err, "Unexpected error while getting services list")
+	assert.Len(t, instances, 1)
+	assert.Equal(t, registered[0].ID, instances[0].ID)
+	assert.Equal(t, sa2.String(), instances[0].Address.String())
+	assert.Equal(t, "eu", instances[0].Metadata["zone"])
+
+	// loaded services are not recorded again
+	fi, err := os.Stat(filepath.Join(dir, "catalog.log"))
+	assert.NoError(t, err, "Unexpected error while reading catalog log")
+	assert.Equal(t, int64(0), fi.Size())
+}
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "catalog")
+	assert.NoError(t, err, "Unexpected error while creating directory")
+	defer os.RemoveAll(dir)
+
+	store, err := plain.NewFileStore(dir)
+	assert.NoError(t, err, "Unexpected error while opening catalog store")
+
+	for i := 0; i < 1500; i++ {
+		err = store.Put(plain.ServiceInfo{ID: strconv.Itoa(i % 3), Name: "StoredService", Version: strconv.Itoa(i)})
+		assert.NoError(t, err, "Unexpected error while recording registration")
+	}
+	err = store.Delete("1")
+	assert.NoError(t, err, "Unexpected error while recording deregistration")
+
+	store.Dispose()
+
+	// record written during crash is skipped
+	f, err := os.OpenFile(filepath.Join(dir, "catalog.log"), os.O_WRONLY|os.O_APPEND, 0644)
+	assert.NoError(t, err, "Unexpected error while opening catalog log")
+	f.WriteString(`{"op":"delete","id":"0"}` + "\n" + `{"op":"put","info":{"id":"3",`)
+	f.Close()
+
+	store, err = plain.NewFileStore(dir)
+	assert.NoError(t, err, "Unexpected error while opening catalog store")
+	defer store.Dispose()
+
+	infos, err := store.Load()
+	assert.NoError(t, err, "Unexpected error while loading catalog")
+	assert.Len(t, infos, 1)
+	assert.Equal(t, "2", infos[0].ID)
+	assert.Equal(t, "1499", infos[0].Version)
+}
+
+func TestFileStoreCompaction(t *testing.T) {
+	dir, err := ioutil.TempDir("", "catalog")
+	assert.NoError(t, err, "Unexpected error while creating directory")
+	defer os.RemoveAll(dir)
+
+	store, err := plain.NewFileStore(dir)
+	assert.NoError(t, err, "Unexpected error while opening catalog store")
+
+	// the 1000th record triggers compaction
+	for i := 0; i < 1000; i++ {
+		err = store.Put(plain.ServiceInfo{ID: strconv.Itoa(i), Name: "StoredService", Version: "1.0"})
+		assert.NoError(t, err, "Unexpected error while recording registration")
+	}
+	store.Dispose()
+
+	store, err = plain.NewFileStore(dir)
+	assert.NoError(t, err, "Unexpected error while opening catalog store")
+
+	infos, err := store.Load()
+	assert.NoError(t, err, "Unexpected error while loading catalog")
+	assert.Len(t, infos, 1000)
+
+	for i := 0; i < 999; i++ {
+		err = store.Put(plain.ServiceInfo{ID: strconv.Itoa(1000 + i), Name: "StoredService", Version: "1.0"})
+		assert.NoError(t, err, "Unexpected error while recording registration")
+	}
+	err = store.Delete("0")
+	assert.NoError(t, err, "Unexpected error while recording deregistration")
+	store.Dispose()
+
+	store, err = plain.NewFileStore(dir)
+	assert.NoError(t, err, "Unexpected error while opening catalog store")
+	defer store.Dispose()
+
+	infos, err = store.Load()
+	assert.NoError(t, err, "Unexpected error while loading catalog")
+	assert.Len(t, infos, 1998)
+	assert.Equal(t, "1", infos[0].ID)
+}
+
+func TestPlainDiscoveryServiceReplication(t *testing.T) {
+	addr1, _ := quark.GetHostAddress(7782)
+	addr2, _ := quark.GetHostAddress(7783)
+
+	server1 := plain.NewServiceDiscovery("http://"+addr1.Host, plain.Peers("http://"+addr2.Host))
+	err := server1.Serve(addr1.Host)
+	assert.NoError(t, err, "Unexpected error while starting server")
+	defer server1.Dispose()
+
+	client := plain.NewServiceDiscovery("http://"+addr1.Host, plain.Servers("http://"+addr2.Host), plain.HeartbeatInterval(0))
+	defer client.Dispose()
+
+	sa1, _ := quark.GetHostAddress(5005)
+	sa2, _ := quark.GetHostAddress(5006)
+
+	err = client.RegisterService(sd.WithInfo(service.Info{Name: "ReplicatedCatalogService", Version: "1.0", Address: sa1}))
+	assert.NoError(t, err, "Unexpected error during service registration")
+
+	// server started later copies catalog of peer
+	server2 := plain.NewServiceDiscovery("http://"+addr2.Host, plain.Peers("http://"+addr1.Host))
+	err = server2.Serve(addr2.Host)
+	assert.NoError(t, err, "Unexpected error while starting server")
+	defer server2.Dispose()
+
+	err = client.RegisterService(sd.WithInfo(service.Info{Name: "ReplicatedCatalogService", Version: "1.0", Address: sa2}))
+	assert.NoError(t, err, "Unexpected error during service registration")
+
+	assert.Eventually(t, func() bool {
+		instances, err := server2.GetServiceInstances(sd.ByName("ReplicatedCatalogService"), sd.ByVersion("1.0"))
+		return err == nil && len(instances) == 2
+	}, 2*time.Second, 10*time.Millisecond, "Services should be replicated")
+
+	// client fails over to the next server
+	server1.Stop()
+
+	assert.Eventually(t, func() bool {
+		_, err := server1.GetServiceInstances(sd.ByName("ReplicatedCatalogService"), sd.ByVersion("1.0"))
+		return err != nil
+	}, 2*time.Second, 10*time.Millisecond, "Server should be stopped")
+
+	instances, err := client.GetServiceInstances(sd.ByName("ReplicatedCatalogService"), sd.ByVersion("1.0"))
+	assert.NoError(t, err, "Unexpected error while getting services list")
+	assert.Len(t, instances, 2)
+
+	err = client.DeregisterService(sd.WithInfo(service.Info{Name: "ReplicatedCatalogService", Version: "1.0", Address: sa1}))
+	assert.NoError(t, err, "Unexpected error while service deregistration")
+
+	assert.Eventually(t, func() bool {
+		instances, err := server2.GetServiceInstances(sd.ByName("ReplicatedCatalogService"), sd.ByVersion("1.0"))
+		return err == nil && len(instances) == 1 && instances[0].Address.String() == sa2.String()
+	}, 2*time.Second, 10*time.Millisecond, "Service should be deregistered")
+}
+
+func TestPlainDiscoveryServiceReplicationRetry(t *testing.T) {
+	addr1, _ := quark.GetHostAddress(7784)
+	addr2, _ := quark.GetHostAddress(7785)
+
+	server1 := plain.NewServiceDiscovery("http://"+addr1.Host, plain.Peers("http://"+addr2.Host), plain.TTL(0), plain.HeartbeatInterval(0))
+	err := server1.Serve(addr1.Host)
+	assert.NoError(t, err, "Unexpected error while starting server")
+	defer server1.Dispose()
+
+	info := sd.WithInfo(service.Info{Name: "RetriedService", Version: "1.0"})
+
+	err = server1.RegisterService(info)
+	assert.NoError(t, err, "Unexpected error during service registration")
+
+	// change is replicated when peer is available
+	server2 := plain.NewServiceDiscovery("http://"+addr2.Host, plain.TTL(0))
+	err = server2.Serve(addr2.Host)
+	assert.NoError(t, err, "Unexpected error while starting server")
+	defer server2.Dispose()
+
+	assert.Eventually(t, func() bool {
+		instances, err := server2.GetServiceInstances(info)
+		return err == nil && len(instances) == 1
+	}, 5*time.Second, 10*time.Millisecond, "Service should be replicated")
+}
+
+func TestPlainDiscoveryServiceReplicationSync(t *testing.T) {
+	dir, err := ioutil.TempDir("", "catalog")
+	assert.NoError(t, err, "Unexpected error while creating directory")
+	defer os.RemoveAll(dir)
+
+	addr1, _ := quark.GetHostAddress(7786)
+	addr2, _ := quark.GetHostAddress(7787)
+
+	server1 := plain.NewServiceDiscovery("http://"+addr1.Host, plain.TTL(0))
+	err = server1.Serve(addr1.Host)
+	assert.NoError(t, err, "Unexpected error while starting server")
+	defer server1.Dispose()
+
+	client := plain.NewServiceDiscovery("http://"+addr1.Host, plain.HeartbeatInterval(0))
+	defer client.Dispose()
+
+	err = client.RegisterService(sd.WithInfo(service.Info{Name: "PeerService", Version: "1.0"}))
+	assert.NoError(t, err, "Unexpected error during service registration")
+
+	// service registered before server was stopped is recorded in its store
+	store, err := plain.NewFileStore(dir)
+	assert.NoError(t, err, "Unexpected error while opening catalog store")
+
+	err = store.Put(plain.ServiceInfo{ID: "stored-1", Name: "StoredService", Version: "1.0"})
+	assert.NoError(t, err, "Unexpected error while recording registration")
+
+	server2 := plain.NewServiceDiscovery("http://"+addr2.Host, plain.Peers("http://"+addr1.Host), plain.Storage(store), plain.TTL(0))
+	err = server2.Serve(addr2.Host)
+	assert.NoError(t, err, "Unexpected error while starting server")
+	defer server2.Dispose()
+
+	assert.Eventually(t, func() bool {
+		instances, err := server2.GetServiceInstances(sd.ByName("PeerService"), sd.ByVersion("1.0"))
+		return err == nil && len(instances) == 1
+	}, 2*time.Second, 10*time.Millisecond, "Catalog of peer should be merged")
+
+	// services loaded from store are kept
+	instances, err := server2.GetServiceInstances(sd.ByName("StoredService"), sd.ByVersion("1.0"))
+	assert.NoError(t, err, "Unexpected error while getting services list")
+	assert.Len(t, instances, 1)
+
+	infos, err := store.Load()
+	assert.NoError(t, err, "Unexpected error while loading catalog")
+	assert.Len(t, infos, 2)
+}
+
+func TestPlainDiscoveryServiceReplicationSyncEmptyPeer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "catalog")
+	assert.NoError(t, err, "Unexpected error while creating directory")
+	defer os.RemoveAll(dir)
+
+	addr1, _ := quark.GetHostAddress(7789)
+	addr2, _ := quark.GetHostAddress(7790)
+
+	store, err := plain.NewFileStore(dir)
+	assert.NoError(t, err, "Unexpected error while opening catalog store")
+
+	err = store.Put(plain.ServiceInfo{ID: "stored-1", Name: "StoredService", Version: "1.0"})
+	assert.NoError(t, err, "Unexpected error while recording registration")
+
+	// both servers are started at the same time
+	server1 := plain.NewServiceDiscovery("http://"+addr1.Host, plain.Peers("http://"+addr2.Host), plain.Storage(store), plain.TTL(0))
+	err = server1.Serve(addr1.Host)
+	assert.NoError(t, err, "Unexpected error while starting server")
+	defer server1.Dispose()
+
+	server2 := plain.NewServiceDiscovery("http://"+addr2.Host, plain.Peers("http://"+addr1.Host), plain.TTL(0))
+	err = server2.Serve(addr2.Host)
+	assert.NoError(t, err, "Unexpected error while starting server")
+	defer server2.Dispose()
+
+	assert.Eventually(t, func() bool {
+		instances, err := server2.GetServiceInstances(sd.ByName("StoredService"), sd.ByVersion("1.0"))
+		return err == nil && len(instances) == 1
+	}, 2*time.Second, 10*time.Millisecond, "Catalog of peer should be merged")
+
+	// catalog loaded from store is not replaced by empty catalog of peer
+	infos, err := store.Load()
+	assert.NoError(t, err, "Unexpected error while loading catalog")
+	assert.Len(t, infos, 1)
+}
+
+func TestPlainDiscoveryServiceDefaultTTL(t *testing.T) {
+	addr, _ := quark.GetHostAddress(7788)
+
+	server := plain.NewServiceDiscovery("http://" + addr.Host)
+	err := server.Serve(addr.Host)
+	assert.NoError(t, err, "Unexpected error while starting server")
+	defer server.Dispose()
+
+	// client which does not send heartbeats registers services which do not expire
+	legacy := plain.NewServiceDiscovery("http://"+addr.Host, plain.HeartbeatInterval(0))
+	defer legacy.Dispose()
+
+	err = legacy.RegisterService(sd.WithInfo(service.Info{Name: "LegacyService", Version: "1.0"}))
+	assert.NoError(t, err, "Unexpected error during service registration")
+
+	client := plain.NewServiceDiscovery("http://" + addr.Host)
+	defer client.Dispose()
+
+	err = client.RegisterService(sd.WithInfo(service.Info{Name: "HeartbeatService", Version: "1.0"}))
+	assert.NoError(t, err, "Unexpected error during service registration")
+
+	ttl := func(name string) time.Duration {
+		resp, err := http.Post("http://"+addr.Host+plain.ListServicesURL, "application/json", bytes.NewBufferString(`{"name":"`+name+`","version":"1.0"}`))
+		assert.NoError(t, err, "Unexpected error during HTTP call")
+		defer resp.Body.Close()
+
+		var infos []plain.ServiceInfo
+		err = json.NewDecoder(resp.Body).Decode(&infos)
+		assert.NoError(t, err, "Unexpected error while decoding services list")
+		assert.Len(t, infos, 1)
+
+		return infos[0].TTL
+	}
+
+	assert.Equal(t, time.Duration(0), ttl("LegacyService"))
+	assert.Equal(t, 30*time.Second, ttl("HeartbeatService"))
+}
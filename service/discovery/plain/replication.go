@@ -0,0 +1,341 @@
+package plain
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gkarlik/quark-go/logger"
+)
+
+const (
+	// ReplicateURL is endpoint url for catalog changes replicated by peer discovery servers.
+	ReplicateURL = "/replicate"
+	// CatalogURL is endpoint url for all registered services. Peer discovery servers get catalog (GET) when they are started
+	// and replace catalog (POST) when changes could not be replicated.
+	CatalogURL = "/catalog"
+
+	// number of catalog changes waiting for replication to peer, whole catalog is replicated if queue is full
+	replicationQueueSize = 1024
+	// interval of replication attempts to peer which is not available
+	replicationRetryInterval = time.Second
+)
+
+// peer represents discovery server which catalog changes are replicated to.
+type peer struct {
+	address string
+	changes chan change // changes waiting for replication
+	resync  int32       // set to 1 if changes were dropped and whole catalog must be replicated
+}
+
+// startReplication starts replication of catalog changes to peers until context is done.
+func (sd *ServiceDiscovery) startReplication(ctx context.Context) {
+	sd.peers = nil
+
+	for _, addr := range sd.opts.Peers {
+		p := &peer{
+			address: strings.TrimSuffix(addr, "/"),
+			changes: make(chan change, replicationQueueSize),
+		}
+		sd.peers = append(sd.peers, p)
+
+		go sd.replicateTo(ctx, p)
+	}
+}
+
+// replicate queues change of catalog for replication to peers. If queue of peer is full, change is dropped and whole
+// catalog is replicated to peer instead. It must be called with mu locked, so changes are replicated in order.
+func (sd *ServiceDiscovery) replicate(c change) {
+	for _, p := range sd.peers {
+		select {
+		case p.changes <- c:
+		default:
+			if atomic.CompareAndSwapInt32(&p.resync, 0, 1) {
+				logger.Log().WarningWithFields(logger.Fields{
+					"peer":      p.address,
+					"op":        c.Op,
+					"component": componentName,
+				}, "Replication queue is full - whole catalog will be replicated to peer")
+			}
+		}
+	}
+}
+
+// replicateTo sends queued changes of catalog (or whole catalog if changes were dropped) to peer until context is done.
+// Changes which cannot be sent are retried, so peer which is not available receives them when it is available again.
+func (sd *ServiceDiscovery) replicateTo(ctx context.Context, p *peer) {
+	for {
+		if atomic.LoadInt32(&p.resync) == 1 {
+			sd.mu.Lock()
+			atomic.StoreInt32(&p.resync, 0)
+			// queued changes are included in catalog
+			for len(p.changes) > 0 {
+				<-p.changes
+			}
+			infos := sd.infos()
+			sd.mu.Unlock()
+
+			if !sd.retry(ctx, p, CatalogURL, infos) {
+				return
+			}
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case c := <-p.changes:
+			if !sd.retry(ctx, p, ReplicateURL, c) {
+				return
+			}
+		}
+	}
+}
+
+// retry sends value to endpoint of peer until it is sent or context is done. It returns false if context is done.
+func (sd *ServiceDiscovery) retry(ctx context.Context, p *peer, path string, v interface{}) bool {
+	for {
+		err := sd.sendToPeer(ctx, p, path, v)
+		if err == nil {
+			return true
+		}
+
+		logger.Log().WarningWithFields(logger.Fields{
+			"error":     err,
+			"peer":      p.address,
+			"url":       path,
+			"component": componentName,
+		}, "Cannot replicate catalog to peer - retrying")
+
+		timer := time.NewTimer(replicationRetryInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return false
+		case <-timer.C:
+		}
+	}
+}
+
+func (sd *ServiceDiscovery) sendToPeer(ctx context.Context, p *peer, path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, p.address+path, bytes.NewBuffer(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	_, resp, err := sd.do(sd.client, req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("[%s]: Cannot replicate catalog - %s", componentName, resp.Status)
+	}
+	return nil
+}
+
+// syncPeers merges catalog of the first available peer which has registered services into catalog, so server which is started
+// again does not miss registrations replicated when it was not available. Registrations loaded from store or accepted since
+// server was started are kept - services deregistered when server was not available expire if they are registered with TTL.
+func (sd *ServiceDiscovery) syncPeers(ctx context.Context) {
+	for _, p := range sd.peers {
+		req, err := http.NewRequest(http.MethodGet, p.address+CatalogURL, nil)
+		if err != nil {
+			continue
+		}
+
+		data, resp, err := sd.do(sd.client, req.WithContext(ctx))
+		if err != nil || resp.StatusCode != http.StatusOK {
+			logger.Log().WarningWithFields(logger.Fields{
+				"error":     err,
+				"peer":      p.address,
+				"component": componentName,
+			}, "Cannot copy catalog of peer")
+			continue
+		}
+
+		var infos []ServiceInfo
+		if err := json.Unmarshal(data, &infos); err != nil {
+			logger.Log().ErrorWithFields(logger.Fields{
+				"error":     err,
+				"peer":      p.address,
+				"component": componentName,
+			}, "Cannot convert JSON string to service info array")
+			continue
+		}
+
+		if len(infos) == 0 {
+			// peer which is started at the same time may not have catalog yet
+			logger.Log().InfoWithFields(logger.Fields{
+				"peer":      p.address,
+				"component": componentName,
+			}, "Catalog of peer is empty")
+			continue
+		}
+
+		sd.mu.Lock()
+		err = sd.merge(infos)
+		sd.mu.Unlock()
+
+		if err != nil {
+			logger.Log().ErrorWithFields(logger.Fields{
+				"error":     err,
+				"peer":      p.address,
+				"component": componentName,
+			}, "Cannot merge catalog of peer")
+			continue
+		}
+
+		logger.Log().InfoWithFields(logger.Fields{
+			"peer":      p.address,
+			"services":  len(infos),
+			"component": componentName,
+		}, "Catalog copied from peer")
+		return
+	}
+}
+
+func (sd *ServiceDiscovery) replicateHandler(w http.ResponseWriter, r *http.Request) {
+	var c change
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil || c.Info == nil {
+		logger.Log().ErrorWithFields(logger.Fields{
+			"error":     err,
+			"component": componentName,
+		}, "Cannot decode catalog change from HTTP request")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	defer r.Body.Close()
+
+	// replicated changes are applied locally only, so they are not sent back to peers
+	var err error
+	switch c.Op {
+	case opPut:
+		sd.mu.Lock()
+		_, err = sd.register(*c.Info)
+		sd.mu.Unlock()
+	case opDelete:
+		err = sd.deleteByServiceInfo(ServiceInfo{ID: c.ID, Name: c.Info.Name}, false)
+	default:
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// infos returns all registered services. It must be called with mu locked.
+func (sd *ServiceDiscovery) infos() []ServiceInfo {
+	// must use make here to return [] instead of null
+	infos := make([]ServiceInfo, 0)
+
+	sd.evict(time.Now())
+	for _, l := range sd.catalog {
+		for e := l.Front(); e != nil; e = e.Next() {
+			infos = append(infos, e.Value.(*registration).info)
+		}
+	}
+	return infos
+}
+
+// merge registers services copied from peer. It must be called with mu locked.
+func (sd *ServiceDiscovery) merge(infos []ServiceInfo) error {
+	for _, si := range infos {
+		if _, err := sd.register(si); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replace replaces catalog with services sent by peer. Services which are not registered on peer are removed.
+// It must be called with mu locked.
+func (sd *ServiceDiscovery) replace(infos []ServiceInfo) error {
+	ids := make(map[string]bool, len(infos))
+	for _, si := range infos {
+		ids[si.ID] = true
+	}
+
+	for name, l := range sd.catalog {
+		for e := l.Front(); e != nil; {
+			next := e.Next()
+			reg := e.Value.(*registration)
+
+			if !ids[reg.info.ID] {
+				if err := sd.persist(change{Op: opDelete, Info: &reg.info, ID: reg.info.ID}); err != nil {
+					return err
+				}
+				l.Remove(e)
+				sd.changed()
+			}
+			e = next
+		}
+
+		if l.Len() == 0 {
+			delete(sd.catalog, name)
+		}
+	}
+
+	return sd.merge(infos)
+}
+
+func (sd *ServiceDiscovery) catalogHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		sd.replaceCatalogHandler(w, r)
+		return
+	}
+
+	sd.mu.Lock()
+	infos := sd.infos()
+	sd.mu.Unlock()
+
+	data, err := json.Marshal(infos)
+	if err != nil {
+		logger.Log().ErrorWithFields(logger.Fields{
+			"error":     err,
+			"component": componentName,
+		}, "Cannot convert service info array into JSON")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// replaceCatalogHandler replaces catalog with catalog sent by peer which could not replicate single changes.
+func (sd *ServiceDiscovery) replaceCatalogHandler(w http.ResponseWriter, r *http.Request) {
+	var infos []ServiceInfo
+	if err := json.NewDecoder(r.Body).Decode(&infos); err != nil {
+		logger.Log().ErrorWithFields(logger.Fields{
+			"error":     err,
+			"component": componentName,
+		}, "Cannot decode service info array from HTTP request")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	defer r.Body.Close()
+
+	sd.mu.Lock()
+	err := sd.replace(infos)
+	sd.mu.Unlock()
+
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
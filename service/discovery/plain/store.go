@@ -0,0 +1,340 @@
+package plain
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/gkarlik/quark-go/logger"
+	"github.com/gkarlik/quark-go/system"
+)
+
+const (
+	snapshotFileName = "catalog.snapshot"
+	logFileName      = "catalog.log"
+
+	// number of log records after which snapshot is written and log is truncated
+	compactionThreshold = 1000
+
+	opPut    = "put"
+	opDelete = "delete"
+)
+
+// Store represents persistent store of service discovery catalog. Discovery server loads catalog from store when it is started
+// and records every registration (or its update) and deregistration. Heartbeats are not recorded - loaded registrations
+// expire if they are not renewed within TTL after server is started.
+type Store interface {
+	Load() ([]ServiceInfo, error) // returns registered services in order of registration
+	Put(si ServiceInfo) error     // records registration of service instance
+	Delete(id string) error       // records deregistration of service instance
+	system.Disposer
+}
+
+// change represents single change of catalog which is recorded in append log and replicated to peer discovery servers.
+type change struct {
+	Op   string       `json:"op"`
+	Info *ServiceInfo `json:"info,omitempty"` // registered or deregistered service instance
+	ID   string       `json:"id,omitempty"`   // identifier of deregistered service instance
+}
+
+// storedInfo represents service instance kept by FileStore.
+type storedInfo struct {
+	info ServiceInfo
+	seq  uint64 // order of registration
+}
+
+// FileStore represents catalog store which keeps snapshot of catalog and append log of changes made since the snapshot
+// in directory. Snapshot is written and log is truncated when store is opened and after every 1000 changes.
+type FileStore struct {
+	mu      sync.Mutex
+	dir     string
+	log     *os.File
+	records int // number of records in log
+	seq     uint64
+	catalog map[string]*storedInfo
+}
+
+// NewFileStore opens catalog store in directory. Directory is created if it does not exist.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		logger.Log().ErrorWithFields(logger.Fields{
+			"error":     err,
+			"dir":       dir,
+			"component": componentName,
+		}, "Cannot create catalog store directory")
+		return nil, err
+	}
+
+	fs := &FileStore{
+		dir:     dir,
+		catalog: make(map[string]*storedInfo),
+	}
+
+	if err := fs.readSnapshot(); err != nil {
+		return nil, err
+	}
+	if err := fs.replayLog(); err != nil {
+		return nil, err
+	}
+
+	log, err := os.OpenFile(filepath.Join(dir, logFileName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		logger.Log().ErrorWithFields(logger.Fields{
+			"error":     err,
+			"dir":       dir,
+			"component": componentName,
+		}, "Cannot open catalog log")
+		return nil, err
+	}
+	fs.log = log
+
+	// replayed log is compacted, so incomplete record written during crash is dropped
+	if err := fs.compact(); err != nil {
+		log.Close()
+		return nil, err
+	}
+	return fs, nil
+}
+
+func (fs *FileStore) readSnapshot() error {
+	data, err := ioutil.ReadFile(filepath.Join(fs.dir, snapshotFileName))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		logger.Log().ErrorWithFields(logger.Fields{
+			"error":     err,
+			"dir":       fs.dir,
+			"component": componentName,
+		}, "Cannot read catalog snapshot")
+		return err
+	}
+
+	var infos []ServiceInfo
+	if err := json.Unmarshal(data, &infos); err != nil {
+		logger.Log().ErrorWithFields(logger.Fields{
+			"error":     err,
+			"dir":       fs.dir,
+			"component": componentName,
+		}, "Cannot convert catalog snapshot into service info array")
+		return err
+	}
+
+	for _, si := range infos {
+		fs.put(si)
+	}
+	return nil
+}
+
+func (fs *FileStore) replayLog() error {
+	f, err := os.Open(filepath.Join(fs.dir, logFileName))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		logger.Log().ErrorWithFields(logger.Fields{
+			"error":     err,
+			"dir":       fs.dir,
+			"component": componentName,
+		}, "Cannot read catalog log")
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	for scanner.Scan() {
+		var c change
+		if err := json.Unmarshal(scanner.Bytes(), &c); err != nil {
+			logger.Log().WarningWithFields(logger.Fields{
+				"error":     err,
+				"dir":       fs.dir,
+				"component": componentName,
+			}, "Incomplete catalog log record - remaining records are skipped")
+			break
+		}
+
+		switch {
+		case c.Op == opPut && c.Info != nil:
+			fs.put(*c.Info)
+		case c.Op == opDelete:
+			delete(fs.catalog, c.ID)
+		}
+	}
+	return scanner.Err()
+}
+
+// put adds service instance to catalog or updates it. It must be called with mu locked.
+func (fs *FileStore) put(si ServiceInfo) {
+	if s, ok := fs.catalog[si.ID]; ok {
+		s.info = si
+		return
+	}
+
+	fs.seq++
+	fs.catalog[si.ID] = &storedInfo{info: si, seq: fs.seq}
+}
+
+// infos returns service instances in order of registration. It must be called with mu locked.
+func (fs *FileStore) infos() []ServiceInfo {
+	stored := make([]*storedInfo, 0, len(fs.catalog))
+	for _, s := range fs.catalog {
+		stored = append(stored, s)
+	}
+	sort.Slice(stored, func(i, j int) bool {
+		return stored[i].seq < stored[j].seq
+	})
+
+	infos := make([]ServiceInfo, 0, len(stored))
+	for _, s := range stored {
+		infos = append(infos, s.info)
+	}
+	return infos
+}
+
+// compact writes snapshot of catalog and truncates log. Snapshot is replaced atomically, so log which is not truncated
+// because of crash is replayed over new snapshot. It must be called with mu locked.
+func (fs *FileStore) compact() error {
+	data, err := json.Marshal(fs.infos())
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(fs.dir, snapshotFileName)
+	tmp := path + ".tmp"
+
+	if err := writeFile(tmp, data); err != nil {
+		logger.Log().ErrorWithFields(logger.Fields{
+			"error":     err,
+			"dir":       fs.dir,
+			"component": componentName,
+		}, "Cannot write catalog snapshot")
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		logger.Log().ErrorWithFields(logger.Fields{
+			"error":     err,
+			"dir":       fs.dir,
+			"component": componentName,
+		}, "Cannot replace catalog snapshot")
+		return err
+	}
+
+	if err := fs.log.Truncate(0); err != nil {
+		logger.Log().ErrorWithFields(logger.Fields{
+			"error":     err,
+			"dir":       fs.dir,
+			"component": componentName,
+		}, "Cannot truncate catalog log")
+		return err
+	}
+	fs.records = 0
+	return nil
+}
+
+func writeFile(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// append writes record to log. It must be called with mu locked.
+func (fs *FileStore) append(c change) error {
+	if fs.log == nil {
+		return fmt.Errorf("[%s]: Cannot write catalog log - store is disposed", componentName)
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	if _, err := fs.log.Write(append(data, '\n')); err != nil {
+		logger.Log().ErrorWithFields(logger.Fields{
+			"error":     err,
+			"dir":       fs.dir,
+			"component": componentName,
+		}, "Cannot write catalog log")
+		return err
+	}
+	if err := fs.log.Sync(); err != nil {
+		return err
+	}
+
+	fs.records++
+	return nil
+}
+
+// compactIfNeeded compacts log if it is too long. It must be called with mu locked after catalog is updated,
+// so snapshot contains change which is the last record of truncated log.
+func (fs *FileStore) compactIfNeeded() error {
+	if fs.records >= compactionThreshold {
+		return fs.compact()
+	}
+	return nil
+}
+
+// Load returns registered services in order of registration.
+func (fs *FileStore) Load() ([]ServiceInfo, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	return fs.infos(), nil
+}
+
+// Put records registration of service instance.
+func (fs *FileStore) Put(si ServiceInfo) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if err := fs.append(change{Op: opPut, Info: &si}); err != nil {
+		return err
+	}
+	fs.put(si)
+
+	return fs.compactIfNeeded()
+}
+
+// Delete records deregistration of service instance.
+func (fs *FileStore) Delete(id string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if _, ok := fs.catalog[id]; !ok {
+		return nil
+	}
+
+	if err := fs.append(change{Op: opDelete, ID: id}); err != nil {
+		return err
+	}
+	delete(fs.catalog, id)
+
+	return fs.compactIfNeeded()
+}
+
+// Dispose closes catalog log.
+func (fs *FileStore) Dispose() {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.log != nil {
+		fs.log.Close()
+		fs.log = nil
+	}
+}
@@ -0,0 +1,75 @@
+package discovery
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"github.com/gkarlik/quark-go/logger"
+)
+
+const watchRetryDelay = 1 * time.Second
+
+// Query represents blocking query of service instances. Query returns current instances when catalog index is different
+// than index (or wait time elapses) together with new catalog index. Index 0 means that query should return immediately.
+type Query func(ctx context.Context, index uint64) ([]Instance, uint64, error)
+
+// WatchQuery runs blocking query repeatedly until context is done and returns channel of instance sets. The first instance set
+// is sent after the first successful query and next sets are sent only if they differ from the previous one. Failed queries
+// are logged (component is used as log field) and retried. Channel is closed when context is done.
+// It is used by ServiceDiscovery implementations to implement Watch.
+func WatchQuery(ctx context.Context, component string, q Query) <-chan []Instance {
+	updates := make(chan []Instance)
+
+	go func() {
+		defer close(updates)
+
+		var index uint64
+		var last []Instance
+		sent := false
+
+		for {
+			instances, next, err := q(ctx, index)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+
+				logger.Log().WarningWithFields(logger.Fields{
+					"error":     err,
+					"retry":     watchRetryDelay,
+					"component": component,
+				}, "Cannot watch service instances")
+
+				index = 0
+
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(watchRetryDelay):
+				}
+				continue
+			}
+
+			// index going backwards means that catalog was reset, so next query should not block
+			if next < index {
+				index = 0
+			} else {
+				index = next
+			}
+
+			if sent && reflect.DeepEqual(instances, last) {
+				continue
+			}
+
+			select {
+			case updates <- instances:
+				last, sent = instances, true
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return updates
+}
@@ -0,0 +1,53 @@
+package discovery_test
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/gkarlik/quark-go/service/discovery"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatchQuery(t *testing.T) {
+	addr1, _ := url.Parse("//10.0.0.1:8080")
+	addr2, _ := url.Parse("//10.0.0.2:8080")
+
+	results := []struct {
+		instances []discovery.Instance
+		index     uint64
+	}{
+		{[]discovery.Instance{{ID: "1", Address: addr1, Health: discovery.HealthPassing}}, 5},
+		{[]discovery.Instance{{ID: "1", Address: addr1, Health: discovery.HealthPassing}}, 6},
+		{[]discovery.Instance{{ID: "1", Address: addr1, Health: discovery.HealthCritical}}, 7},
+		{[]discovery.Instance{{ID: "2", Address: addr2, Health: discovery.HealthPassing}}, 3},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var indexes []uint64
+	updates := discovery.WatchQuery(ctx, "TestComponent", func(ctx context.Context, index uint64) ([]discovery.Instance, uint64, error) {
+		indexes = append(indexes, index)
+
+		if len(indexes) > len(results) {
+			<-ctx.Done()
+			return nil, 0, ctx.Err()
+		}
+
+		r := results[len(indexes)-1]
+		return r.instances, r.index, nil
+	})
+
+	// unchanged instance set is not sent again
+	assert.Equal(t, results[0].instances, <-updates)
+	assert.Equal(t, results[2].instances, <-updates)
+	assert.Equal(t, results[3].instances, <-updates)
+
+	cancel()
+	for range updates {
+	}
+
+	// index going backwards resets index
+	assert.Equal(t, []uint64{0, 5, 6, 7, 0}, indexes)
+}
@@ -52,10 +52,10 @@ type Tracer struct {
 }
 
 // NewTracer creates an instance of tracer based on opentracing zipkin framework.
-// Additional options passed as arguments are used to configure circuit breaker pattern to connect to zipkin instance.
+// Additional options passed as arguments are used to configure retry policy (backoff, jitter, cancellation context etc.) to connect to zipkin instance.
 // Panics if cannot connect to collector or cannot create zipkin instance.
 func NewTracer(address string, serviceName string, serviceAddress *url.URL, opts ...cb.Option) trace.Tracer {
-	collector, err := new(cb.DefaultCircuitBreaker).Execute(func() (interface{}, error) {
+	collector, err := new(cb.RetryPolicy).Execute(func() (interface{}, error) {
 		return zipkin.NewHTTPCollector(address)
 	}, opts...)
 